@@ -0,0 +1,618 @@
+// Package algo provides execution algorithms which place a large parent quantity
+// as a series of small child orders: TWAP/VWAP schedules, iceberg and pegged limit orders.
+//
+// Algo tracks fills by child order events, so pass the events received from
+// 'child_order_events' to Algo.OnChildOrderEvents, and the board to Algo.OnBoard for peg.
+package algo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/mitsutoshi/bitflyergo"
+)
+
+// defaultTick is the interval to check the schedule and the board.
+const defaultTick = 200 * time.Millisecond
+
+// maxPlaceFailures is the number of consecutive failures of placing child orders until Algo fails.
+const maxPlaceFailures = 5
+
+// maxBackoff is the longest interval to wait before placing child order again after a failure.
+const maxBackoff = 10 * time.Second
+
+// maxOrphanEvents is the number of events kept for the orders whose acknowledgements haven't returned yet.
+const maxOrphanEvents = 256
+
+// ErrAlgoFinished is returned when Algo is started twice.
+var ErrAlgoFinished = errors.New("algo has already finished")
+
+// ErrAlgoFailed is returned by Run when placing child orders failed maxPlaceFailures times in a row.
+var ErrAlgoFailed = errors.New("algo failed to place child orders")
+
+// State is the state of Algo.
+type State int
+
+const (
+	StateRunning   State = iota // placing child orders
+	StatePaused                 // not placing new child orders
+	StateCompleted              // the parent quantity was filled
+	StateCanceled               // canceled before completion
+	StateFailed                 // stopped because child orders couldn't be placed
+)
+
+// String returns the name of state.
+func (s State) String() string {
+	switch s {
+	case StateRunning:
+		return "RUNNING"
+	case StatePaused:
+		return "PAUSED"
+	case StateCompleted:
+		return "COMPLETED"
+	case StateCanceled:
+		return "CANCELED"
+	case StateFailed:
+		return "FAILED"
+	}
+	return "UNKNOWN"
+}
+
+// OrderClient places and cancels child orders. *bitflyergo.Bitflyer implements it.
+type OrderClient interface {
+	PlaceChildOrder(req *bitflyergo.ChildOrderRequest) (*bitflyergo.OrderAck, error)
+	CancelChildOrder(productCode string, childOrderAcceptanceId string) error
+}
+
+// Order is the parent order executed by Algo.
+type Order struct {
+	ProductCode string             // product_code
+	Side        string             // side, SideBuy or SideSell
+	Size        bitflyergo.Decimal // parent quantity
+	LimitPrice  bitflyergo.Decimal // the worst price of child orders. zero means market orders for schedules
+}
+
+// Progress is the snapshot of Algo's progress.
+type Progress struct {
+	State        State              // state
+	Target       bitflyergo.Decimal // parent quantity
+	Filled       bitflyergo.Decimal // executed size
+	Working      bitflyergo.Decimal // outstanding size of working child orders
+	AveragePrice bitflyergo.Decimal // average price of executions
+	ChildOrders  int                // number of child orders placed
+	StartedAt    time.Time          // time when Algo started
+	LastError    error              // the last error of placing or canceling child orders
+}
+
+// Remaining returns the size not executed yet.
+func (p Progress) Remaining() bitflyergo.Decimal {
+	return p.Target.Sub(p.Filled)
+}
+
+type mode int
+
+const (
+	modeSchedule mode = iota
+	modeIceberg
+	modePeg
+)
+
+// childOrder is the working child order placed by Algo.
+type childOrder struct {
+	price     bitflyergo.Decimal
+	size      bitflyergo.Decimal
+	filled    bitflyergo.Decimal
+	canceling bool
+}
+
+// Algo executes the parent order by child orders.
+type Algo struct {
+	client OrderClient
+	order  Order
+	mode   mode
+	tick   time.Duration
+	now    func() time.Time
+
+	schedule Schedule
+	slices   []Slice
+	next     int
+	due      bitflyergo.Decimal // sum of the sizes of slices whose time has come
+
+	visible bitflyergo.Decimal // size of the child order shown on the board for iceberg and peg
+	offset  bitflyergo.Decimal // distance from the best price for peg
+	bestBid bitflyergo.Decimal
+	bestAsk bitflyergo.Decimal
+
+	mu        sync.Mutex
+	state     State
+	working   map[string]*childOrder
+	placing   bitflyergo.Decimal
+	filled    bitflyergo.Decimal
+	notional  bitflyergo.Decimal
+	count     int
+	startedAt time.Time
+	lastErr   error
+	failures  int       // consecutive failures of placing child orders
+	retryAt   time.Time // time to place child order again after a failure
+	orphans   []bitflyergo.ChildOrderEvent
+	done      chan struct{}
+	started   bool
+}
+
+func newAlgo(client OrderClient, order Order, m mode) *Algo {
+	return &Algo{
+		client:  client,
+		order:   order,
+		mode:    m,
+		tick:    defaultTick,
+		now:     time.Now,
+		working: map[string]*childOrder{},
+		done:    make(chan struct{}),
+	}
+}
+
+// NewScheduled creates Algo sending child orders according to schedule such as TWAP or VWAP.
+//
+// If order.LimitPrice is set, child orders are IOC limit orders and the unfilled size is
+// sent again with the next slice. Otherwise child orders are market orders.
+func NewScheduled(client OrderClient, order Order, schedule Schedule) (*Algo, error) {
+	if err := order.validate(false); err != nil {
+		return nil, err
+	}
+	if schedule == nil {
+		return nil, errors.New("schedule is required")
+	}
+	if v, ok := schedule.(interface{ validate() error }); ok {
+		if err := v.validate(); err != nil {
+			return nil, err
+		}
+	}
+	a := newAlgo(client, order, modeSchedule)
+	a.schedule = schedule
+	return a, nil
+}
+
+// NewIceberg creates Algo showing only visible size of the parent order at order.LimitPrice.
+//
+// The next clip is placed when the previous one is filled.
+func NewIceberg(client OrderClient, order Order, visible bitflyergo.Decimal) (*Algo, error) {
+	if err := order.validate(true); err != nil {
+		return nil, err
+	}
+	if err := order.validateVisible(visible); err != nil {
+		return nil, err
+	}
+	a := newAlgo(client, order, modeIceberg)
+	a.visible = visible
+	return a, nil
+}
+
+// NewPeg creates Algo keeping a limit order of visible size at the best bid (buy) or the best ask (sell).
+//
+// offset moves the price to the inside of the spread. The order is re-quoted when the best price
+// changes, but never beyond order.LimitPrice if it's set.
+func NewPeg(client OrderClient, order Order, visible bitflyergo.Decimal, offset bitflyergo.Decimal) (*Algo, error) {
+	if err := order.validate(false); err != nil {
+		return nil, err
+	}
+	if err := order.validateVisible(visible); err != nil {
+		return nil, err
+	}
+	if offset.Sign() < 0 {
+		return nil, fmt.Errorf("offset must not be negative. [%v]", offset)
+	}
+	a := newAlgo(client, order, modePeg)
+	a.visible = visible
+	a.offset = offset
+	return a, nil
+}
+
+// validate checks the parent order. If limit is true, LimitPrice is required.
+func (o Order) validate(limit bool) error {
+	if o.ProductCode == "" {
+		return errors.New("product_code is required")
+	}
+	if o.Side != bitflyergo.SideBuy && o.Side != bitflyergo.SideSell {
+		return fmt.Errorf("invalid side. [%v]", o.Side)
+	}
+	if o.Size.Sign() <= 0 {
+		return fmt.Errorf("size must be positive. [%v]", o.Size)
+	}
+	if o.LimitPrice.Sign() < 0 || (limit && o.LimitPrice.IsZero()) {
+		return fmt.Errorf("limit price must be positive. [%v]", o.LimitPrice)
+	}
+	return nil
+}
+
+// validateVisible checks that visible is positive and not more than the parent quantity.
+func (o Order) validateVisible(visible bitflyergo.Decimal) error {
+	if visible.Sign() <= 0 || visible.GreaterThan(o.Size) {
+		return fmt.Errorf("visible size must be positive and not more than %v. [%v]", o.Size, visible)
+	}
+	return nil
+}
+
+// Run runs Algo until the parent order is completed, Cancel is called or ctx is done.
+//
+// When ctx is done, working child orders are canceled.
+func (a *Algo) Run(ctx context.Context) error {
+	a.mu.Lock()
+	if a.started {
+		a.mu.Unlock()
+		return ErrAlgoFinished
+	}
+	a.started = true
+	a.startedAt = a.now()
+	if a.schedule != nil {
+		a.slices = a.schedule.Slices(a.order.Size, a.startedAt)
+	}
+	a.mu.Unlock()
+
+	ticker := time.NewTicker(a.tick)
+	defer ticker.Stop()
+	for {
+		a.step()
+		select {
+		case <-a.done:
+			a.mu.Lock()
+			defer a.mu.Unlock()
+			if a.state == StateFailed {
+				return fmt.Errorf("%w: %v", ErrAlgoFailed, a.lastErr)
+			}
+			return nil
+		case <-ctx.Done():
+			a.Cancel()
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Done returns the channel closed when Algo is completed, canceled or failed.
+func (a *Algo) Done() <-chan struct{} {
+	return a.done
+}
+
+// Pause stops placing new child orders. Working child orders are kept.
+func (a *Algo) Pause() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.state == StateRunning {
+		a.state = StatePaused
+	}
+}
+
+// Resume resumes placing child orders.
+func (a *Algo) Resume() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.state == StatePaused {
+		a.state = StateRunning
+	}
+}
+
+// Cancel stops Algo and cancels all working child orders.
+func (a *Algo) Cancel() {
+	a.stop(StateCanceled)
+}
+
+// stop changes the state to state and cancels all working child orders unless Algo has finished.
+func (a *Algo) stop(state State) {
+	a.mu.Lock()
+	if a.finished() {
+		a.mu.Unlock()
+		return
+	}
+	a.state = state
+	close(a.done)
+	ids := make([]string, 0, len(a.working))
+	for id := range a.working {
+		ids = append(ids, id)
+	}
+	a.mu.Unlock()
+
+	for _, id := range ids {
+		if err := a.client.CancelChildOrder(a.order.ProductCode, id); err != nil {
+			a.setError(err)
+		}
+	}
+}
+
+// Progress returns the progress of Algo.
+func (a *Algo) Progress() Progress {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	averagePrice := bitflyergo.Zero
+	if !a.filled.IsZero() {
+		averagePrice = a.notional.Div(a.filled)
+	}
+	return Progress{
+		State:        a.state,
+		Target:       a.order.Size,
+		Filled:       a.filled,
+		Working:      a.outstanding(),
+		AveragePrice: averagePrice,
+		ChildOrders:  a.count,
+		StartedAt:    a.startedAt,
+		LastError:    a.lastErr,
+	}
+}
+
+// OnBoard updates the best prices used by peg. board must be the whole board, not the difference.
+func (a *Algo) OnBoard(board *bitflyergo.Board) {
+	bid, _, bidOk := board.BestBid()
+	ask, _, askOk := board.BestAsk()
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if bidOk {
+		a.bestBid = bitflyergo.NewDecimalFromFloat(bid)
+	}
+	if askOk {
+		a.bestAsk = bitflyergo.NewDecimalFromFloat(ask)
+	}
+}
+
+// OnChildOrderEvents tracks fills and the end of child orders placed by Algo.
+func (a *Algo) OnChildOrderEvents(events []bitflyergo.ChildOrderEvent) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, e := range events {
+		if e.ProductCode != "" && e.ProductCode != a.order.ProductCode {
+			continue
+		}
+		if _, ok := a.working[e.ChildOrderAcceptanceId]; !ok {
+			if a.placing.Sign() > 0 {
+				a.orphans = append(a.orphans, e)
+				if len(a.orphans) > maxOrphanEvents {
+					a.orphans = a.orphans[1:]
+				}
+			}
+			continue
+		}
+		a.applyEvent(e)
+	}
+}
+
+// applyEvent applies the event of the working order. a.mu must be held.
+func (a *Algo) applyEvent(e bitflyergo.ChildOrderEvent) {
+	o := a.working[e.ChildOrderAcceptanceId]
+	switch e.EventType {
+	case bitflyergo.EventTypeExecution:
+		o.filled = o.filled.Add(e.Size)
+		a.filled = a.filled.Add(e.Size)
+		a.notional = a.notional.Add(e.Price.Mul(e.Size))
+		if !o.filled.LessThan(o.size) {
+			delete(a.working, e.ChildOrderAcceptanceId)
+		}
+		if !a.filled.LessThan(a.order.Size) && !a.finished() {
+			a.state = StateCompleted
+			close(a.done)
+		}
+	case bitflyergo.EventTypeCancel, bitflyergo.EventTypeExpire, bitflyergo.EventTypeOrderFailed:
+		delete(a.working, e.ChildOrderAcceptanceId)
+	case bitflyergo.EventTypeCancelFailed:
+		o.canceling = false
+	}
+}
+
+// step places or re-quotes child orders if needed.
+func (a *Algo) step() {
+	a.mu.Lock()
+	if a.state != StateRunning {
+		a.mu.Unlock()
+		return
+	}
+	now := a.now()
+	if now.Before(a.retryAt) {
+		a.mu.Unlock()
+		return
+	}
+	var req *bitflyergo.ChildOrderRequest
+	var cancels []string
+	switch a.mode {
+	case modeSchedule:
+		req = a.nextScheduled(now)
+	case modeIceberg:
+		if len(a.working) == 0 {
+			req = a.limitOrder(a.order.LimitPrice, a.clip())
+		}
+	case modePeg:
+		req, cancels = a.nextPeg()
+	}
+	if req != nil {
+		a.placing = a.placing.Add(req.Size)
+	}
+	a.mu.Unlock()
+
+	for _, id := range cancels {
+		if err := a.client.CancelChildOrder(a.order.ProductCode, id); err != nil {
+			a.setError(err)
+			a.mu.Lock()
+			if o, ok := a.working[id]; ok {
+				o.canceling = false
+			}
+			a.mu.Unlock()
+		}
+	}
+	if req != nil {
+		a.place(req)
+	}
+}
+
+// place sends the child order and registers it as working.
+//
+// After a failure, the next child order waits for the backoff, and Algo fails
+// when it fails maxPlaceFailures times in a row.
+func (a *Algo) place(req *bitflyergo.ChildOrderRequest) {
+	ack, err := a.client.PlaceChildOrder(req)
+	a.mu.Lock()
+	a.placing = a.placing.Sub(req.Size)
+	if err != nil {
+		a.lastErr = err
+		a.failures++
+		failed := a.failures >= maxPlaceFailures
+		if !failed {
+			a.retryAt = a.now().Add(backoff(a.tick, a.failures))
+		}
+		a.mu.Unlock()
+		if failed {
+			a.stop(StateFailed)
+		}
+		return
+	}
+	defer a.mu.Unlock()
+	a.failures = 0
+	a.retryAt = time.Time{}
+	a.count++
+	a.working[ack.ChildOrderAcceptanceId] = &childOrder{price: req.Price, size: req.Size}
+
+	// Algo was stopped while the order was being placed
+	if a.state == StateCanceled || a.state == StateFailed {
+		go func() {
+			if err := a.client.CancelChildOrder(a.order.ProductCode, ack.ChildOrderAcceptanceId); err != nil {
+				a.setError(err)
+			}
+		}()
+		return
+	}
+
+	// apply the events received before the acknowledgement
+	var rest []bitflyergo.ChildOrderEvent
+	for _, e := range a.orphans {
+		if _, ok := a.working[e.ChildOrderAcceptanceId]; ok {
+			a.applyEvent(e)
+		} else {
+			rest = append(rest, e)
+		}
+	}
+	a.orphans = rest
+}
+
+// backoff returns the interval doubled from tick for each failure, up to maxBackoff.
+func backoff(tick time.Duration, failures int) time.Duration {
+	d := tick
+	for i := 0; i < failures && d < maxBackoff; i++ {
+		d *= 2
+	}
+	if d > maxBackoff {
+		return maxBackoff
+	}
+	return d
+}
+
+// finished returns true if Algo is completed, canceled or failed. a.mu must be held.
+func (a *Algo) finished() bool {
+	return a.state == StateCompleted || a.state == StateCanceled || a.state == StateFailed
+}
+
+// outstanding returns the size of working and placing orders. a.mu must be held.
+func (a *Algo) outstanding() bitflyergo.Decimal {
+	size := a.placing
+	for _, o := range a.working {
+		size = size.Add(o.size.Sub(o.filled))
+	}
+	return size
+}
+
+// clip returns the size of the next child order of iceberg and peg. a.mu must be held.
+func (a *Algo) clip() bitflyergo.Decimal {
+	remaining := a.order.Size.Sub(a.filled).Sub(a.outstanding())
+	if a.visible.Sign() > 0 && a.visible.LessThan(remaining) {
+		return a.visible
+	}
+	return remaining
+}
+
+// nextScheduled returns the child order due at now. a.mu must be held.
+func (a *Algo) nextScheduled(now time.Time) *bitflyergo.ChildOrderRequest {
+	for a.next < len(a.slices) && !a.slices[a.next].At.After(now) {
+		a.due = a.due.Add(a.slices[a.next].Size)
+		a.next++
+	}
+	size := a.due.Sub(a.filled).Sub(a.outstanding())
+	if size.LessThan(bitflyergo.NewDecimalFromFloat(bitflyergo.MinimumOrderbleSize)) {
+		return nil
+	}
+	if a.order.LimitPrice.IsZero() {
+		return &bitflyergo.ChildOrderRequest{
+			ProductCode:    a.order.ProductCode,
+			ChildOrderType: bitflyergo.ChildOrderTypeMarket,
+			Side:           a.order.Side,
+			Size:           size,
+		}
+	}
+	req := a.limitOrder(a.order.LimitPrice, size)
+	req.TimeInForce = bitflyergo.TimeInForceIoc
+	return req
+}
+
+// nextPeg returns the order to place and the orders to cancel to follow the best price. a.mu must be held.
+func (a *Algo) nextPeg() (*bitflyergo.ChildOrderRequest, []string) {
+	price := a.pegPrice()
+	if price.Sign() <= 0 {
+		return nil, nil
+	}
+	var cancels []string
+	for id, o := range a.working {
+		if !o.canceling && !o.price.Equal(price) {
+			o.canceling = true
+			cancels = append(cancels, id)
+		}
+	}
+	if len(a.working) > 0 || a.placing.Sign() > 0 {
+		return nil, cancels
+	}
+	return a.limitOrder(price, a.clip()), cancels
+}
+
+// pegPrice returns the price to quote. a.mu must be held.
+func (a *Algo) pegPrice() bitflyergo.Decimal {
+	var price bitflyergo.Decimal
+	if a.order.Side == bitflyergo.SideBuy {
+		if a.bestBid.IsZero() {
+			return bitflyergo.Zero
+		}
+		price = a.bestBid.Add(a.offset)
+		if !a.bestAsk.IsZero() && !price.LessThan(a.bestAsk) {
+			price = a.bestBid
+		}
+		if !a.order.LimitPrice.IsZero() && price.GreaterThan(a.order.LimitPrice) {
+			price = a.order.LimitPrice
+		}
+	} else {
+		if a.bestAsk.IsZero() {
+			return bitflyergo.Zero
+		}
+		price = a.bestAsk.Sub(a.offset)
+		if !a.bestBid.IsZero() && !price.GreaterThan(a.bestBid) {
+			price = a.bestAsk
+		}
+		if !a.order.LimitPrice.IsZero() && price.LessThan(a.order.LimitPrice) {
+			price = a.order.LimitPrice
+		}
+	}
+	return price
+}
+
+// limitOrder returns limit order of price and size, or nil if size is less than the minimum. a.mu must be held.
+func (a *Algo) limitOrder(price bitflyergo.Decimal, size bitflyergo.Decimal) *bitflyergo.ChildOrderRequest {
+	if size.LessThan(bitflyergo.NewDecimalFromFloat(bitflyergo.MinimumOrderbleSize)) {
+		return nil
+	}
+	return &bitflyergo.ChildOrderRequest{
+		ProductCode:    a.order.ProductCode,
+		ChildOrderType: bitflyergo.ChildOrderTypeLimit,
+		Side:           a.order.Side,
+		Price:          price,
+		Size:           size,
+	}
+}
+
+func (a *Algo) setError(err error) {
+	a.mu.Lock()
+	a.lastErr = err
+	a.mu.Unlock()
+}
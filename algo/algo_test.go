@@ -0,0 +1,277 @@
+package algo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mitsutoshi/bitflyergo"
+)
+
+type fakeClient struct {
+	mu       sync.Mutex
+	orders   []bitflyergo.ChildOrderRequest
+	canceled []string
+	err      error // returned by PlaceChildOrder if set
+}
+
+func (c *fakeClient) PlaceChildOrder(req *bitflyergo.ChildOrderRequest) (*bitflyergo.OrderAck, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.orders = append(c.orders, *req)
+	if c.err != nil {
+		return nil, c.err
+	}
+	return &bitflyergo.OrderAck{ChildOrderAcceptanceId: fmt.Sprintf("JRF-%d", len(c.orders))}, nil
+}
+
+func (c *fakeClient) CancelChildOrder(productCode string, childOrderAcceptanceId string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.canceled = append(c.canceled, childOrderAcceptanceId)
+	return nil
+}
+
+func dec(s string) bitflyergo.Decimal {
+	return bitflyergo.MustParseDecimal(s)
+}
+
+func execution(id string, price string, size string) bitflyergo.ChildOrderEvent {
+	return bitflyergo.ChildOrderEvent{ChildOrderAcceptanceId: id, EventType: bitflyergo.EventTypeExecution,
+		Price: dec(price), Size: dec(size)}
+}
+
+func TestTWAPSlices(t *testing.T) {
+	start := time.Date(2019, 3, 1, 0, 0, 0, 0, time.UTC)
+	slices := TWAP{Duration: time.Minute, Count: 3}.Slices(dec("1"), start)
+	if len(slices) != 3 {
+		t.Fatalf("%v\n", slices)
+	}
+	if slices[0].Size.String() != "0.33" || slices[2].Size.String() != "0.34" || !slices[2].At.Equal(start.Add(40*time.Second)) {
+		t.Fatalf("%v\n", slices)
+	}
+
+	// slices smaller than minimum size are merged
+	slices = VWAP{Duration: time.Minute, Profile: []float64{1, 1, 1, 1}}.Slices(dec("0.03"), start)
+	total := bitflyergo.Zero
+	for _, s := range slices {
+		if s.Size.LessThan(dec("0.01")) {
+			t.Fatalf("%v\n", slices)
+		}
+		total = total.Add(s.Size)
+	}
+	if total.String() != "0.03" {
+		t.Fatalf("%v\n", slices)
+	}
+}
+
+func TestScheduled(t *testing.T) {
+	client := &fakeClient{}
+	now := time.Date(2019, 3, 1, 0, 0, 0, 0, time.UTC)
+	a, err := NewScheduled(client, Order{ProductCode: bitflyergo.ProductCodeFxBtcJpy, Side: bitflyergo.SideBuy,
+		Size: dec("0.2"), LimitPrice: dec("1000000")}, TWAP{Duration: time.Minute, Count: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.now = func() time.Time { return now }
+	a.started = true
+	a.slices = a.schedule.Slices(a.order.Size, now)
+
+	a.step()
+	if len(client.orders) != 1 || client.orders[0].Size.String() != "0.1" || client.orders[0].TimeInForce != bitflyergo.TimeInForceIoc {
+		t.Fatalf("%v\n", client.orders)
+	}
+
+	// unfilled size of IOC order is sent with the next slice
+	a.OnChildOrderEvents([]bitflyergo.ChildOrderEvent{
+		execution("JRF-1", "1000000", "0.04"),
+		{ChildOrderAcceptanceId: "JRF-1", EventType: bitflyergo.EventTypeCancel},
+	})
+	now = now.Add(30 * time.Second)
+	a.step()
+	if len(client.orders) != 2 || client.orders[1].Size.String() != "0.16" {
+		t.Fatalf("%v\n", client.orders)
+	}
+
+	a.OnChildOrderEvents([]bitflyergo.ChildOrderEvent{execution("JRF-2", "1000100", "0.16")})
+	p := a.Progress()
+	if p.State != StateCompleted || p.Filled.String() != "0.2" || p.AveragePrice.String() != "1000080" {
+		t.Fatalf("%v\n", p)
+	}
+	select {
+	case <-a.Done():
+	default:
+		t.Fatal("Done must be closed.")
+	}
+}
+
+func TestIceberg(t *testing.T) {
+	client := &fakeClient{}
+	a, err := NewIceberg(client, Order{ProductCode: bitflyergo.ProductCodeFxBtcJpy, Side: bitflyergo.SideSell,
+		Size: dec("0.25"), LimitPrice: dec("1000000")}, dec("0.1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a.step()
+	a.step()
+	if len(client.orders) != 1 || client.orders[0].Size.String() != "0.1" {
+		t.Fatalf("%v\n", client.orders)
+	}
+	a.OnChildOrderEvents([]bitflyergo.ChildOrderEvent{execution("JRF-1", "1000000", "0.1")})
+	a.Pause()
+	a.step()
+	if len(client.orders) != 1 {
+		t.Fatal("paused algo must not place orders.")
+	}
+	a.Resume()
+	a.step()
+	a.OnChildOrderEvents([]bitflyergo.ChildOrderEvent{execution("JRF-2", "1000000", "0.1")})
+	a.step()
+	if len(client.orders) != 3 || client.orders[2].Size.String() != "0.05" {
+		t.Fatalf("%v\n", client.orders)
+	}
+}
+
+func TestPeg(t *testing.T) {
+	client := &fakeClient{}
+	a, err := NewPeg(client, Order{ProductCode: bitflyergo.ProductCodeFxBtcJpy, Side: bitflyergo.SideBuy,
+		Size: dec("0.1"), LimitPrice: dec("1000005")}, dec("0.1"), dec("1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	board := &bitflyergo.Board{
+		Bids: map[float64]float64{1000000: 1, 999999: 1},
+		Asks: map[float64]float64{1000010: 1},
+	}
+	a.OnBoard(board)
+	a.step()
+	if len(client.orders) != 1 || client.orders[0].Price.String() != "1000001" {
+		t.Fatalf("%v\n", client.orders)
+	}
+
+	// re-quote when the best bid moves, but not beyond the limit price
+	board.Merge(&bitflyergo.Board{Bids: map[float64]float64{1000008: 1}})
+	a.OnBoard(board)
+	a.step()
+	a.step()
+	if len(client.canceled) != 1 || len(client.orders) != 1 {
+		t.Fatalf("orders: %v, canceled: %v", client.orders, client.canceled)
+	}
+	a.OnChildOrderEvents([]bitflyergo.ChildOrderEvent{{ChildOrderAcceptanceId: "JRF-1", EventType: bitflyergo.EventTypeCancel}})
+	a.step()
+	if len(client.orders) != 2 || client.orders[1].Price.String() != "1000005" {
+		t.Fatalf("%v\n", client.orders)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	a.started = false
+	if err := a.Run(ctx); err != context.Canceled {
+		t.Fatal(err)
+	}
+	if a.Progress().State != StateCanceled || client.canceled[len(client.canceled)-1] != "JRF-2" {
+		t.Fatalf("%v %v\n", a.Progress(), client.canceled)
+	}
+}
+
+func TestNewAlgoValidation(t *testing.T) {
+	client := &fakeClient{}
+	order := Order{ProductCode: bitflyergo.ProductCodeFxBtcJpy, Side: bitflyergo.SideBuy, Size: dec("0.1"), LimitPrice: dec("1000000")}
+	market := order
+	market.LimitPrice = bitflyergo.Zero
+	negative := order
+	negative.LimitPrice = dec("-1")
+	noSize := order
+	noSize.Size = bitflyergo.Zero
+
+	if _, err := NewScheduled(client, market, TWAP{Duration: time.Minute, Count: 2}); err != nil {
+		t.Errorf("market schedule: %v", err)
+	}
+	if _, err := NewIceberg(client, order, dec("0.1")); err != nil {
+		t.Errorf("iceberg: %v", err)
+	}
+	invalid := map[string]func() error{
+		"limit price of schedule": func() error {
+			_, err := NewScheduled(client, negative, TWAP{Duration: time.Minute, Count: 2})
+			return err
+		},
+		"size of schedule": func() error {
+			_, err := NewScheduled(client, noSize, TWAP{Duration: time.Minute, Count: 2})
+			return err
+		},
+		"count of TWAP": func() error {
+			_, err := NewScheduled(client, order, TWAP{Duration: time.Minute})
+			return err
+		},
+		"profile of VWAP": func() error {
+			_, err := NewScheduled(client, order, VWAP{Duration: time.Minute, Profile: []float64{1, -1}})
+			return err
+		},
+		"limit price of iceberg": func() error {
+			_, err := NewIceberg(client, market, dec("0.1"))
+			return err
+		},
+		"zero visible": func() error {
+			_, err := NewIceberg(client, order, bitflyergo.Zero)
+			return err
+		},
+		"visible over size": func() error {
+			_, err := NewIceberg(client, order, dec("0.2"))
+			return err
+		},
+		"visible of peg": func() error {
+			_, err := NewPeg(client, market, dec("0.2"), bitflyergo.Zero)
+			return err
+		},
+		"offset of peg": func() error {
+			_, err := NewPeg(client, market, dec("0.1"), dec("-1"))
+			return err
+		},
+	}
+	for name, fn := range invalid {
+		if err := fn(); err == nil {
+			t.Errorf("%v must be rejected.", name)
+		}
+	}
+}
+
+func TestPlaceFailure(t *testing.T) {
+	client := &fakeClient{err: fmt.Errorf("server error")}
+	now := time.Date(2019, 3, 1, 0, 0, 0, 0, time.UTC)
+	a, err := NewIceberg(client, Order{ProductCode: bitflyergo.ProductCodeFxBtcJpy, Side: bitflyergo.SideSell,
+		Size: dec("0.25"), LimitPrice: dec("1000000")}, dec("0.1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.now = func() time.Time { return now }
+
+	// backoff after a failure
+	a.step()
+	a.step()
+	if len(client.orders) != 1 || a.Progress().LastError == nil {
+		t.Fatalf("%v\n", client.orders)
+	}
+	now = now.Add(2 * a.tick)
+	a.step()
+	if len(client.orders) != 2 {
+		t.Fatalf("%v\n", client.orders)
+	}
+
+	// fails after consecutive failures
+	for i := 0; i < maxPlaceFailures; i++ {
+		now = now.Add(maxBackoff)
+		a.step()
+	}
+	if len(client.orders) != maxPlaceFailures || a.Progress().State != StateFailed {
+		t.Fatalf("orders: %v, progress: %v", len(client.orders), a.Progress())
+	}
+	a.started = false
+	if err := a.Run(context.Background()); !errors.Is(err, ErrAlgoFailed) {
+		t.Fatal(err)
+	}
+}
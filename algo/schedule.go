@@ -0,0 +1,119 @@
+package algo
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/mitsutoshi/bitflyergo"
+)
+
+// Slice is one of the child orders scheduled by Schedule.
+type Slice struct {
+	At   time.Time          // time to send the child order
+	Size bitflyergo.Decimal // size of the child order
+}
+
+// Schedule decides how the parent quantity is sliced over time.
+type Schedule interface {
+
+	// Slices returns the child orders of total starting at start. The sum of sizes equals total.
+	Slices(total bitflyergo.Decimal, start time.Time) []Slice
+}
+
+// TWAP slices the parent quantity into Count equal child orders sent evenly over Duration.
+type TWAP struct {
+	Duration time.Duration // duration to complete the parent order
+	Count    int           // number of child orders
+}
+
+// validate checks Count and Duration.
+func (s TWAP) validate() error {
+	if s.Count <= 0 {
+		return fmt.Errorf("count of TWAP must be positive. [%v]", s.Count)
+	}
+	if s.Duration < 0 {
+		return fmt.Errorf("duration of TWAP must not be negative. [%v]", s.Duration)
+	}
+	return nil
+}
+
+// Slices returns equal slices.
+func (s TWAP) Slices(total bitflyergo.Decimal, start time.Time) []Slice {
+	weights := make([]float64, s.Count)
+	for i := range weights {
+		weights[i] = 1
+	}
+	return slice(total, start, s.Duration, weights)
+}
+
+// VWAP slices the parent quantity in proportion to the expected volume profile over Duration.
+//
+// e.g. Profile of []float64{3, 1, 1, 3} sends 3/8 of the quantity at the beginning and the end.
+type VWAP struct {
+	Duration time.Duration // duration to complete the parent order
+	Profile  []float64     // relative volume of each interval
+}
+
+// validate checks Profile and Duration.
+func (s VWAP) validate() error {
+	sum := 0.0
+	for _, w := range s.Profile {
+		if w < 0 {
+			return fmt.Errorf("profile of VWAP must not be negative. [%v]", s.Profile)
+		}
+		sum += w
+	}
+	if sum <= 0 {
+		return fmt.Errorf("profile of VWAP must have positive volume. [%v]", s.Profile)
+	}
+	if s.Duration < 0 {
+		return fmt.Errorf("duration of VWAP must not be negative. [%v]", s.Duration)
+	}
+	return nil
+}
+
+// Slices returns slices weighted by Profile.
+func (s VWAP) Slices(total bitflyergo.Decimal, start time.Time) []Slice {
+	return slice(total, start, s.Duration, s.Profile)
+}
+
+// slice divides total by weights. Sizes less than the minimum orderable size are carried over
+// to the next slice, and the remainder is added to the last slice.
+func slice(total bitflyergo.Decimal, start time.Time, duration time.Duration, weights []float64) []Slice {
+	if len(weights) == 0 {
+		return []Slice{{At: start, Size: total}}
+	}
+	sum := 0.0
+	for _, w := range weights {
+		sum += w
+	}
+	if sum <= 0 {
+		return []Slice{{At: start, Size: total}}
+	}
+
+	min := bitflyergo.NewDecimalFromFloat(bitflyergo.MinimumOrderbleSize)
+	interval := duration / time.Duration(len(weights))
+	var slices []Slice
+	allocated := bitflyergo.Zero
+	carry := bitflyergo.Zero
+	for i, w := range weights {
+		size := total.Mul(bitflyergo.NewDecimalFromFloat(w / sum)).Truncate(2).Add(carry)
+		if allocated.Add(size).GreaterThan(total) {
+			size = total.Sub(allocated)
+		}
+		if size.LessThan(min) {
+			carry = size
+			continue
+		}
+		carry = bitflyergo.Zero
+		slices = append(slices, Slice{At: start.Add(interval * time.Duration(i)), Size: size})
+		allocated = allocated.Add(size)
+	}
+	if rest := total.Sub(allocated); rest.Sign() > 0 {
+		if len(slices) == 0 {
+			return []Slice{{At: start, Size: total}}
+		}
+		slices[len(slices)-1].Size = slices[len(slices)-1].Size.Add(rest)
+	}
+	return slices
+}
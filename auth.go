@@ -0,0 +1,69 @@
+package bitflyergo
+
+import (
+	"context"
+)
+
+// AuthCallback is the optional interface of Callback to be notified of the result of authentication.
+type AuthCallback interface {
+
+	// OnAuth is called when the result of authentication is received.
+	// err is nil if it succeeded, or *RPCError with the error of the server if it failed.
+	OnAuth(err error)
+}
+
+// OnAuth calls OnAuth of the callbacks implementing AuthCallback.
+func (cbs MultiCallback) OnAuth(err error) {
+	for _, cb := range cbs {
+		if cb, ok := cb.(AuthCallback); ok {
+			cb.OnAuth(err)
+		}
+	}
+}
+
+// AuthContext authenticates client with the current credentials of provider, and waits for the result until ctx is done.
+//
+// When it returns nil, AuthChannels have been requested to subscribe.
+func (bf *WebSocketClient) AuthContext(ctx context.Context, provider CredentialsProvider) error {
+	call, err := bf.auth(provider, true)
+	if err != nil {
+		return err
+	}
+	return bf.wait(ctx, call)
+}
+
+// authChannels returns the private channels subscribed after authentication.
+func (bf *WebSocketClient) authChannels() []string {
+	if bf.AuthChannels == nil {
+		return []string{ChannelChildOrderEvents}
+	}
+	return bf.AuthChannels
+}
+
+// onAuth subscribes the private channels if authentication succeeded, and notifies the result to Cb.
+func (bf *WebSocketClient) onAuth(err error) {
+	if err != nil {
+		bf.logger().Error("failed to authenticate", "error", err)
+	} else {
+		bf.logger().Info("succeeded to authenticate")
+		channels := bf.authChannels()
+		subscribed := map[string]bool{}
+		for _, ch := range channels {
+			subscribed[ch] = true
+		}
+		// the private channels subscribed before reconnecting
+		for _, ch := range bf.feeds.list() {
+			if isPrivateChannel(ch) && !subscribed[ch] {
+				channels = append(channels, ch)
+			}
+		}
+		for _, ch := range channels {
+			if err := bf.subscribe(ch); err != nil {
+				bf.logger().Error("failed to subscribe", "channel", ch, "error", err)
+			}
+		}
+	}
+	if cb, ok := bf.Cb.(AuthCallback); ok {
+		cb.OnAuth(err)
+	}
+}
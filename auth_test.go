@@ -0,0 +1,193 @@
+package bitflyergo
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// authCallback stores the results of authentication.
+type authCallback struct {
+	errorCallback
+	results chan error
+}
+
+func (c *authCallback) OnAuth(err error) {
+	c.results <- err
+}
+
+// authServer responds to auth requests of api key "key" with success, and records subscribed channels.
+type authServer struct {
+	mu       sync.Mutex
+	channels []string
+}
+
+func (s *authServer) respond(req rpcRequest) map[string]interface{} {
+	switch req.Method {
+	case "auth":
+		if req.Params.ApiKey != "key" {
+			return map[string]interface{}{"error": map[string]interface{}{"code": -32000, "message": "invalid api key"}}
+		}
+	case "subscribe":
+		s.mu.Lock()
+		s.channels = append(s.channels, req.Params.Channel)
+		s.mu.Unlock()
+	}
+	return map[string]interface{}{"result": true}
+}
+
+func (s *authServer) subscribed() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	channels := append([]string(nil), s.channels...)
+	sort.Strings(channels)
+	return channels
+}
+
+func TestAuthContext(t *testing.T) {
+	for _, tt := range []struct {
+		authChannels []string
+		expected     []string
+	}{
+		{nil, []string{ChannelChildOrderEvents}},
+		{[]string{ChannelChildOrderEvents, ChannelParentOrderEvents}, []string{ChannelChildOrderEvents, ChannelParentOrderEvents}},
+		{[]string{}, nil},
+	} {
+		server := &authServer{}
+		cb := &authCallback{results: make(chan error, 1)}
+		ws, closeClient := newRPCTestClient(t, cb, server.respond)
+		ws.AuthChannels = tt.authChannels
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		if err := ws.AuthContext(ctx, StaticCredentials{ApiKey: "key", ApiSecret: "secret"}); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+		cancel()
+		if err := <-cb.results; err != nil {
+			t.Errorf("OnAuth: %v", err)
+		}
+		time.Sleep(50 * time.Millisecond)
+		closeClient()
+
+		if actual := server.subscribed(); len(actual) != len(tt.expected) ||
+			(len(actual) > 0 && actual[len(actual)-1] != tt.expected[len(tt.expected)-1]) {
+			t.Errorf("AuthChannels=%v: expected=%v, actual=%v", tt.authChannels, tt.expected, actual)
+		}
+	}
+}
+
+func TestAuthFailure(t *testing.T) {
+	server := &authServer{}
+	cb := &authCallback{results: make(chan error, 2)}
+	ws, closeClient := newRPCTestClient(t, cb, server.respond)
+	defer closeClient()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	err := ws.AuthContext(ctx, StaticCredentials{ApiKey: "invalid", ApiSecret: "secret"})
+	if rpcErr, ok := err.(*RPCError); !ok || rpcErr.Method != "auth" || rpcErr.Message != "invalid api key" {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := <-cb.results; err == nil {
+		t.Error("OnAuth isn't notified of the failure")
+	}
+
+	// without waiting
+	if err := ws.Auth("invalid", "secret"); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	select {
+	case err := <-cb.results:
+		if _, ok := err.(*RPCError); !ok {
+			t.Errorf("expected RPCError, actual=%v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("OnAuth isn't called")
+	}
+	if channels := server.subscribed(); len(channels) != 0 {
+		t.Errorf("subscribed after the failure: %v", channels)
+	}
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	if len(cb.errors) != 0 {
+		t.Errorf("OnErrorOccur is called: %v", cb.errors)
+	}
+}
+
+func TestMultiCallbackOnAuth(t *testing.T) {
+	cb := &authCallback{results: make(chan error, 1)}
+	MultiCallback{NopCallback{}, cb}.OnAuth(ErrNoCredentials)
+	if err := <-cb.results; err != ErrNoCredentials {
+		t.Errorf("expected=%v, actual=%v", ErrNoCredentials, err)
+	}
+}
+
+func TestReauthFailure(t *testing.T) {
+	var mu sync.Mutex
+	connections := 0
+	endpoint, closeServer := newTestWebSocketServer(t, func(con *websocket.Conn) {
+		mu.Lock()
+		connections++
+		n := connections
+		mu.Unlock()
+		respondRPC(con, func(req rpcRequest) map[string]interface{} {
+			if req.Method == "auth" && n > 1 {
+				return map[string]interface{}{"error": map[string]interface{}{"code": -32000, "message": "expired"}}
+			}
+			if req.Method == "subscribe" && n == 1 {
+				defer con.Close() // drops the first connection after subscribing
+			}
+			return map[string]interface{}{"result": true}
+		})
+	})
+	defer closeServer()
+
+	cb := &authCallback{results: make(chan error, 2)}
+	ws := &WebSocketClient{Cb: cb, EndpointUrl: endpoint, Reconnect: true, ReconnectInterval: 10 * time.Millisecond}
+	ws.Logger = NewStdLogger(nil)
+	ws.Logger.(*StdLogger).Level = LevelError + 1
+	if err := ws.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	go ws.Receive()
+	defer ws.Close(context.Background())
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := ws.AuthContext(ctx, StaticCredentials{ApiKey: "key", ApiSecret: "secret"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-cb.results; err != nil {
+		t.Fatalf("OnAuth: %v", err)
+	}
+	select {
+	case err := <-cb.results:
+		if _, ok := err.(*RPCError); !ok {
+			t.Errorf("expected RPCError, actual=%v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("OnAuth isn't called after reconnecting")
+	}
+
+	// the private channel which isn't subscribed again is notified
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		cb.mu.Lock()
+		for i, ch := range cb.channels {
+			if ch == ChannelChildOrderEvents {
+				if _, ok := cb.errors[i].(*RPCError); !ok {
+					t.Errorf("expected RPCError, actual=%v", cb.errors[i])
+				}
+				cb.mu.Unlock()
+				return
+			}
+		}
+		cb.mu.Unlock()
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Error("the failure of authentication isn't notified to OnErrorOccur")
+}
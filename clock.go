@@ -0,0 +1,138 @@
+package bitflyergo
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// DefaultDriftThreshold is the default threshold of the clock offset to warn.
+const DefaultDriftThreshold = time.Second
+
+// clockSamples is the number of samples used to estimate the offset.
+const clockSamples = 8
+
+// Clock estimates the offset of the server clock from the local clock.
+//
+// Private API and websocket auth are signed with Clock.Now() so that machines with clock drift can
+// authenticate. The offset is estimated from HTTP Date headers of API responses, and ticker
+// timestamps push it forward when the server clock is ahead of the estimate.
+type Clock struct {
+	DriftThreshold time.Duration // OnDrift is called when the offset exceeds it. zero means never
+
+	// OnDrift is called when the absolute offset exceeds DriftThreshold.
+	// It's called again only after the offset returns within the threshold. It logs the offset if nil.
+	OnDrift func(offset time.Duration)
+
+	// Logger logs the drift when OnDrift is nil. The default logger is used if nil.
+	Logger LeveledLogger
+
+	now func() time.Time
+
+	mu      sync.Mutex
+	samples []time.Duration
+	offset  time.Duration
+	rtt     time.Duration
+	drifted bool
+}
+
+// NewClock creates Clock whose offset is zero until it's sampled.
+func NewClock() *Clock {
+	return &Clock{DriftThreshold: DefaultDriftThreshold, now: time.Now}
+}
+
+// Now returns the estimated server time. It returns the local time if c is nil.
+func (c *Clock) Now() time.Time {
+	if c == nil {
+		return time.Now()
+	}
+	return c.localNow().Add(c.Offset())
+}
+
+// Offset returns the estimated server time minus the local time.
+func (c *Clock) Offset() time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.offset
+}
+
+// RoundTripTime returns the round-trip time of the last sampled request.
+func (c *Clock) RoundTripTime() time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.rtt
+}
+
+// Sample adds the server time observed by the request sent at sent and responded at received.
+//
+// The server time is assumed to be at the midpoint of the round trip.
+func (c *Clock) Sample(server time.Time, sent time.Time, received time.Time) {
+	rtt := received.Sub(sent)
+	offset := server.Sub(sent.Add(rtt / 2))
+
+	c.mu.Lock()
+	c.rtt = rtt
+	c.samples = append(c.samples, offset)
+	if len(c.samples) > clockSamples {
+		c.samples = c.samples[1:]
+	}
+	sorted := append([]time.Duration{}, c.samples...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	c.offset = sorted[len(sorted)/2]
+	c.mu.Unlock()
+	c.checkDrift()
+}
+
+// SampleDateHeader adds the time of HTTP Date header. It's truncated to seconds,
+// so the middle of the second is used as the server time.
+func (c *Clock) SampleDateHeader(date time.Time, sent time.Time, received time.Time) {
+	c.Sample(date.Add(500*time.Millisecond), sent, received)
+}
+
+// Observe adds the server time of the message received at received, e.g. ticker timestamp.
+//
+// The latency of the message is unknown, so it only moves the offset forward when the message is
+// newer than the estimated server time.
+func (c *Clock) Observe(server time.Time, received time.Time) {
+	offset := server.Sub(received)
+	c.mu.Lock()
+	updated := len(c.samples) == 0 || offset > c.offset
+	if updated {
+		c.offset = offset
+	}
+	c.mu.Unlock()
+	if updated {
+		c.checkDrift()
+	}
+}
+
+func (c *Clock) localNow() time.Time {
+	if c.now == nil {
+		return time.Now()
+	}
+	return c.now()
+}
+
+// checkDrift calls OnDrift when the offset exceeds DriftThreshold.
+func (c *Clock) checkDrift() {
+	if c.DriftThreshold <= 0 {
+		return
+	}
+	c.mu.Lock()
+	offset := c.offset
+	abs := offset
+	if abs < 0 {
+		abs = -abs
+	}
+	notify := abs > c.DriftThreshold && !c.drifted
+	c.drifted = abs > c.DriftThreshold
+	c.mu.Unlock()
+
+	if notify {
+		if c.OnDrift != nil {
+			c.OnDrift(offset)
+		} else {
+			loggerOf(c.Logger).Warn("local clock differs from server", "offset", offset)
+		}
+	}
+}
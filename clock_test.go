@@ -0,0 +1,103 @@
+package bitflyergo
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestClockSample(t *testing.T) {
+	c := NewClock()
+	c.DriftThreshold = 0
+	sent := time.Date(2019, 10, 16, 12, 0, 0, 0, time.UTC)
+	received := sent.Add(100 * time.Millisecond)
+
+	// server is 2 seconds ahead at the midpoint of the round trip
+	c.Sample(sent.Add(2050*time.Millisecond), sent, received)
+	if c.Offset() != 2*time.Second {
+		t.Errorf("unexpected offset: %v", c.Offset())
+	}
+	if c.RoundTripTime() != 100*time.Millisecond {
+		t.Errorf("unexpected rtt: %v", c.RoundTripTime())
+	}
+
+	// an outlier doesn't move the median
+	c.Sample(sent.Add(2050*time.Millisecond), sent, received)
+	c.Sample(sent.Add(10*time.Second), sent, received)
+	if c.Offset() != 2*time.Second {
+		t.Errorf("unexpected offset: %v", c.Offset())
+	}
+
+	// Date header is truncated to seconds
+	c = NewClock()
+	c.SampleDateHeader(sent.Add(-time.Second), sent, sent)
+	if c.Offset() != -500*time.Millisecond {
+		t.Errorf("unexpected offset: %v", c.Offset())
+	}
+}
+
+func TestClockObserve(t *testing.T) {
+	c := NewClock()
+	now := time.Date(2019, 10, 16, 12, 0, 0, 0, time.UTC)
+	c.Sample(now, now, now)
+
+	c.Observe(now.Add(-time.Second), now)
+	if c.Offset() != 0 {
+		t.Errorf("older message moved the offset: %v", c.Offset())
+	}
+	c.Observe(now.Add(300*time.Millisecond), now)
+	if c.Offset() != 300*time.Millisecond {
+		t.Errorf("unexpected offset: %v", c.Offset())
+	}
+}
+
+func TestClockOnDrift(t *testing.T) {
+	var drifts []time.Duration
+	c := NewClock()
+	c.OnDrift = func(offset time.Duration) { drifts = append(drifts, offset) }
+	now := time.Date(2019, 10, 16, 12, 0, 0, 0, time.UTC)
+
+	for _, offset := range []time.Duration{3 * time.Second, 0, -3 * time.Second} {
+		for i := 0; i < clockSamples; i++ {
+			c.Sample(now.Add(offset), now, now)
+		}
+	}
+	if len(drifts) != 2 || drifts[0] != 3*time.Second || drifts[1] != -3*time.Second {
+		t.Errorf("unexpected drifts: %v", drifts)
+	}
+}
+
+func TestClockNil(t *testing.T) {
+	var c *Clock
+	if d := time.Since(c.Now()); d < 0 || d > time.Second {
+		t.Errorf("nil clock is not local time: %v", d)
+	}
+}
+
+func TestSignWithServerTime(t *testing.T) {
+	ahead := time.Hour
+	bf, server := newTestBitflyer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Date", time.Now().Add(ahead).UTC().Format(http.TimeFormat))
+		if ts := r.Header.Get("ACCESS-TIMESTAMP"); ts != "" {
+			sec, _ := strconv.ParseInt(ts, 10, 64)
+			if d := time.Unix(sec, 0).Sub(time.Now().Add(ahead)); d < -2*time.Second || d > 2*time.Second {
+				t.Errorf("ACCESS-TIMESTAMP is not server time: %v", d)
+			}
+		}
+		fmt.Fprint(w, `[]`)
+	})
+	defer server.Close()
+	bf.Clock.DriftThreshold = 0
+
+	if _, err := bf.GetMarkets(); err != nil {
+		t.Fatal(err)
+	}
+	if d := bf.Clock.Offset() - ahead; d < -2*time.Second || d > 2*time.Second {
+		t.Errorf("unexpected offset: %v", bf.Clock.Offset())
+	}
+	if _, err := bf.GetPositions(productCode); err != nil {
+		t.Fatal(err)
+	}
+}
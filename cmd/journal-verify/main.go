@@ -0,0 +1,45 @@
+// Command journal-verify verifies the journal written by journal.Writer.
+//
+// It prints the problems such as modified records and gaps, and exits with 1 if any is found.
+// Pass the checkpoint kept outside of the journal by -seq and -hash to detect the records removed from the end.
+//
+//	journal-verify -dir /var/log/bitflyer -prefix journal -seq 1024 -hash 5f3c...
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/mitsutoshi/bitflyergo/journal"
+)
+
+func main() {
+	dir := flag.String("dir", ".", "directory of the journal")
+	prefix := flag.String("prefix", "journal", "prefix of the journal files")
+	seq := flag.Uint64("seq", 0, "seq of the checkpoint")
+	hash := flag.String("hash", "", "hash of the checkpoint")
+	flag.Parse()
+
+	var report *journal.Report
+	var err error
+	if *seq > 0 {
+		report, err = journal.VerifyCheckpoint(*dir, *prefix, journal.Checkpoint{Seq: *seq, Hash: *hash})
+	} else {
+		report, err = journal.Verify(*dir, *prefix)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	for _, p := range report.Problems {
+		fmt.Println(p)
+	}
+	fmt.Printf("%v files, %v records, last seq %v, last hash %v\n",
+		report.Files, report.Records, report.LastSeq, report.LastHash)
+	if !report.OK() {
+		fmt.Printf("NG: %v problems found\n", len(report.Problems))
+		os.Exit(1)
+	}
+	fmt.Println("OK")
+}
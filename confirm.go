@@ -0,0 +1,167 @@
+package bitflyergo
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// cancelPollInterval is the interval to poll child order while waiting for the cancel.
+const cancelPollInterval = 500 * time.Millisecond
+
+// ErrCancelTimeout is returned when the cancel of child order isn't confirmed within timeout.
+var ErrCancelTimeout = errors.New("timed out waiting for the cancel of child order")
+
+// ErrCancelFailed is returned when the exchange couldn't cancel child order, e.g. it was already executed.
+var ErrCancelFailed = errors.New("failed to cancel child order")
+
+// ErrWaitTimeout is returned by ChildOrderEventWaiter.Wait when the event isn't received within timeout.
+var ErrWaitTimeout = errors.New("timed out waiting for child order event")
+
+// ChildOrderEventWaiter waits for child order events received from websocket.
+//
+// Pass events to Notify in Callback.OnReceiveChildOrderEvents.
+type ChildOrderEventWaiter struct {
+	mu      sync.Mutex
+	waiters map[string][]*eventWaiter
+}
+
+// eventWaiter is the goroutine waiting for one of eventTypes.
+type eventWaiter struct {
+	eventTypes []string
+	ch         chan ChildOrderEvent // receives the first matching event only
+}
+
+// matches returns true if the type of e is one of eventTypes, or eventTypes is empty.
+func (w *eventWaiter) matches(e ChildOrderEvent) bool {
+	if len(w.eventTypes) == 0 {
+		return true
+	}
+	for _, t := range w.eventTypes {
+		if e.EventType == t {
+			return true
+		}
+	}
+	return false
+}
+
+// NewChildOrderEventWaiter creates ChildOrderEventWaiter.
+func NewChildOrderEventWaiter() *ChildOrderEventWaiter {
+	return &ChildOrderEventWaiter{waiters: map[string][]*eventWaiter{}}
+}
+
+// Notify passes events to the goroutines waiting for them.
+//
+// Only the events of the types waited for are passed, and each waiter gets the first of them,
+// so that the event isn't lost however many other events of the order are received.
+func (w *ChildOrderEventWaiter) Notify(events []ChildOrderEvent) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, e := range events {
+		for _, ew := range w.waiters[e.ChildOrderAcceptanceId] {
+			if !ew.matches(e) {
+				continue
+			}
+			select {
+			case ew.ch <- e:
+			default: // already has the first matching event
+			}
+		}
+	}
+}
+
+// Wait waits for the event of child order specified by childOrderAcceptanceId whose type is one of eventTypes.
+// If eventTypes is empty, it waits for any event of the order. It returns ErrWaitTimeout if the event isn't received within timeout.
+func (w *ChildOrderEventWaiter) Wait(childOrderAcceptanceId string, timeout time.Duration, eventTypes ...string) (*ChildOrderEvent, error) {
+	ew := w.register(childOrderAcceptanceId, eventTypes...)
+	defer w.unregister(childOrderAcceptanceId, ew)
+	return waitEvent(ew, timeout)
+}
+
+func (w *ChildOrderEventWaiter) register(childOrderAcceptanceId string, eventTypes ...string) *eventWaiter {
+	ew := &eventWaiter{eventTypes: eventTypes, ch: make(chan ChildOrderEvent, 1)}
+	w.mu.Lock()
+	w.waiters[childOrderAcceptanceId] = append(w.waiters[childOrderAcceptanceId], ew)
+	w.mu.Unlock()
+	return ew
+}
+
+func (w *ChildOrderEventWaiter) unregister(childOrderAcceptanceId string, ew *eventWaiter) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	ews := w.waiters[childOrderAcceptanceId]
+	for i, e := range ews {
+		if e == ew {
+			ews = append(ews[:i], ews[i+1:]...)
+			break
+		}
+	}
+	if len(ews) == 0 {
+		delete(w.waiters, childOrderAcceptanceId)
+	} else {
+		w.waiters[childOrderAcceptanceId] = ews
+	}
+}
+
+func waitEvent(ew *eventWaiter, timeout time.Duration) (*ChildOrderEvent, error) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case e := <-ew.ch:
+		return &e, nil
+	case <-timer.C:
+		return nil, ErrWaitTimeout
+	}
+}
+
+// CancelChildOrderAndConfirm cancels child order and waits until the cancel is confirmed.
+//
+// If waiter is not nil, it waits for the CANCEL event from 'child_order_events',
+// otherwise it polls '/me/getchildorders'. It returns ErrCancelFailed if the order
+// couldn't be canceled and ErrCancelTimeout if the result isn't known within timeout.
+func (bf *Bitflyer) CancelChildOrderAndConfirm(productCode string, childOrderAcceptanceId string,
+	waiter *ChildOrderEventWaiter, timeout time.Duration) error {
+
+	if waiter != nil {
+
+		// register before canceling not to miss the event
+		ew := waiter.register(childOrderAcceptanceId, EventTypeCancel, EventTypeCancelFailed, EventTypeExpire)
+		defer waiter.unregister(childOrderAcceptanceId, ew)
+		if err := bf.CancelChildOrder(productCode, childOrderAcceptanceId); err != nil {
+			return err
+		}
+		e, err := waitEvent(ew, timeout)
+		if err == ErrWaitTimeout {
+			return ErrCancelTimeout
+		} else if err != nil {
+			return err
+		}
+		if e.EventType == EventTypeCancelFailed {
+			return ErrCancelFailed
+		}
+		return nil
+	}
+
+	if err := bf.CancelChildOrder(productCode, childOrderAcceptanceId); err != nil {
+		return err
+	}
+	filter := &ChildOrderFilter{ProductCode: productCode, ChildOrderAcceptanceId: childOrderAcceptanceId}
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		orders, err := bf.GetChildOrdersByFilter(filter)
+		if err != nil {
+			return err
+		}
+		if len(orders) > 0 {
+			switch orders[0].ChildOrderState {
+			case ChildOrderStateCanceled, ChildOrderStateExpired:
+				return nil
+			case ChildOrderStateComplete, ChildOrderStateRejected:
+				return fmt.Errorf("%w: child order is %v", ErrCancelFailed, orders[0].ChildOrderState)
+			}
+		}
+		time.Sleep(cancelPollInterval)
+	}
+	return ErrCancelTimeout
+}
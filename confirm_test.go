@@ -0,0 +1,94 @@
+package bitflyergo
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestCancelChildOrderAndConfirmWithWaiter(t *testing.T) {
+	waiter := NewChildOrderEventWaiter()
+	bf, server := newTestBitflyer(t, func(w http.ResponseWriter, r *http.Request) {
+		go waiter.Notify([]ChildOrderEvent{
+			{ChildOrderAcceptanceId: "JRF-1", EventType: EventTypeExecution},
+			{ChildOrderAcceptanceId: "JRF-1", EventType: EventTypeCancel},
+		})
+	})
+	defer server.Close()
+
+	if err := bf.CancelChildOrderAndConfirm(productCode, "JRF-1", waiter, time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if len(waiter.waiters) != 0 {
+		t.Fatalf("waiter must be unregistered: %v", waiter.waiters)
+	}
+	if err := bf.CancelChildOrderAndConfirm(productCode, "JRF-2", waiter, 10*time.Millisecond); err != ErrCancelTimeout {
+		t.Fatalf("Expect: %v, Actual: %v", ErrCancelTimeout, err)
+	}
+}
+
+func TestCancelChildOrderAndConfirmByPolling(t *testing.T) {
+	bf, server := newTestBitflyer(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "GET" {
+			fmt.Fprint(w, `[{"child_order_acceptance_id":"JRF-1","child_order_state":"CANCELED"}]`)
+		}
+	})
+	defer server.Close()
+
+	if err := bf.CancelChildOrderAndConfirm(productCode, "JRF-1", nil, time.Second); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCancelChildOrderAndConfirmManyEvents(t *testing.T) {
+	waiter := NewChildOrderEventWaiter()
+	bf, server := newTestBitflyer(t, func(w http.ResponseWriter, r *http.Request) {
+		events := make([]ChildOrderEvent, 100)
+		for i := range events {
+			events[i] = ChildOrderEvent{ChildOrderAcceptanceId: "JRF-1", EventType: EventTypeExecution}
+		}
+		events = append(events, ChildOrderEvent{ChildOrderAcceptanceId: "JRF-1", EventType: EventTypeCancelFailed})
+		waiter.Notify(events)
+	})
+	defer server.Close()
+
+	if err := bf.CancelChildOrderAndConfirm(productCode, "JRF-1", waiter, time.Second); err != ErrCancelFailed {
+		t.Fatalf("Expect: %v, Actual: %v", ErrCancelFailed, err)
+	}
+}
+
+func TestChildOrderEventWaiterWait(t *testing.T) {
+	waiter := NewChildOrderEventWaiter()
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		waiter.Notify([]ChildOrderEvent{
+			{ChildOrderAcceptanceId: "JRF-1", EventType: EventTypeOrder},
+			{ChildOrderAcceptanceId: "JRF-1", EventType: EventTypeExecution, ExecId: 1},
+			{ChildOrderAcceptanceId: "JRF-1", EventType: EventTypeExecution, ExecId: 2},
+		})
+	}()
+	e, err := waiter.Wait("JRF-1", time.Second, EventTypeExecution)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.ExecId != 1 {
+		t.Errorf("Expect: first execution, Actual: %+v", e)
+	}
+	if _, err := waiter.Wait("JRF-2", 10*time.Millisecond, EventTypeExecution); err != ErrWaitTimeout {
+		t.Fatalf("Expect: %v, Actual: %v", ErrWaitTimeout, err)
+	}
+
+	// any event without event types
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		waiter.Notify([]ChildOrderEvent{{ChildOrderAcceptanceId: "JRF-3", EventType: EventTypeOrder}})
+	}()
+	e, err = waiter.Wait("JRF-3", time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.EventType != EventTypeOrder {
+		t.Errorf("Expect: %v, Actual: %+v", EventTypeOrder, e)
+	}
+}
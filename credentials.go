@@ -0,0 +1,186 @@
+package bitflyergo
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"sync"
+	"time"
+)
+
+const (
+	EnvApiKey    = "BITFLYER_API_KEY"    // default environment variable of api key
+	EnvApiSecret = "BITFLYER_API_SECRET" // default environment variable of api secret
+)
+
+// ErrNoCredentials is returned when private API is called without credentials.
+var ErrNoCredentials = errors.New("credentials are not set")
+
+// Credentials is api key and api secret. String() doesn't print them.
+type Credentials struct {
+	ApiKey    string `json:"api_key"`    // api_key
+	ApiSecret string `json:"api_secret"` // api_secret
+}
+
+// String returns the redacted credentials.
+func (c Credentials) String() string {
+	return "Credentials{ApiKey: " + redact(c.ApiKey) + ", ApiSecret: " + redact(c.ApiSecret) + "}"
+}
+
+// GoString returns the redacted credentials for %#v.
+func (c Credentials) GoString() string {
+	return c.String()
+}
+
+func redact(s string) string {
+	if s == "" {
+		return `""`
+	}
+	return "[REDACTED]"
+}
+
+// CredentialsProvider provides the credentials every time private API or websocket auth is signed.
+type CredentialsProvider interface {
+	Credentials() (Credentials, error)
+}
+
+// StaticCredentials is the credentials which never change.
+type StaticCredentials Credentials
+
+// Credentials returns c. It returns ErrNoCredentials if api key is blank.
+func (c StaticCredentials) Credentials() (Credentials, error) {
+	if c.ApiKey == "" {
+		return Credentials{}, ErrNoCredentials
+	}
+	return Credentials(c), nil
+}
+
+// String returns the redacted credentials.
+func (c StaticCredentials) String() string {
+	return Credentials(c).String()
+}
+
+// GoString returns the redacted credentials for %#v.
+func (c StaticCredentials) GoString() string {
+	return c.String()
+}
+
+// EnvCredentials reads the credentials from environment variables.
+type EnvCredentials struct {
+	ApiKeyVar    string // name of variable of api key. EnvApiKey if blank
+	ApiSecretVar string // name of variable of api secret. EnvApiSecret if blank
+}
+
+// Credentials returns the credentials in environment variables.
+func (e EnvCredentials) Credentials() (Credentials, error) {
+	keyVar, secretVar := e.ApiKeyVar, e.ApiSecretVar
+	if keyVar == "" {
+		keyVar = EnvApiKey
+	}
+	if secretVar == "" {
+		secretVar = EnvApiSecret
+	}
+	c := Credentials{ApiKey: os.Getenv(keyVar), ApiSecret: os.Getenv(secretVar)}
+	if c.ApiKey == "" || c.ApiSecret == "" {
+		return Credentials{}, fmt.Errorf("%w: %v or %v is empty", ErrNoCredentials, keyVar, secretVar)
+	}
+	return c, nil
+}
+
+// FileCredentials reads the credentials from JSON file such as {"api_key": "...", "api_secret": "..."}.
+//
+// The file must not be accessible by group or others. It's read again when it's modified,
+// so keys can be rotated by replacing the file.
+type FileCredentials struct {
+	Path string // path of the file
+
+	mu      sync.Mutex
+	modTime time.Time
+	cached  Credentials
+}
+
+// NewFileCredentials creates FileCredentials of path.
+func NewFileCredentials(path string) *FileCredentials {
+	return &FileCredentials{Path: path}
+}
+
+// Credentials returns the credentials in the file.
+func (f *FileCredentials) Credentials() (Credentials, error) {
+	info, err := os.Stat(f.Path)
+	if err != nil {
+		return Credentials{}, err
+	}
+	if perm := info.Mode().Perm(); perm&0077 != 0 {
+		return Credentials{}, fmt.Errorf("permissions %v of %v are too open, it must not be accessible by others", perm, f.Path)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if info.ModTime().Equal(f.modTime) {
+		return f.cached, nil
+	}
+	data, err := ioutil.ReadFile(f.Path)
+	if err != nil {
+		return Credentials{}, err
+	}
+	var c Credentials
+	if err := json.Unmarshal(data, &c); err != nil {
+		return Credentials{}, fmt.Errorf("failed to parse %v: %w", f.Path, err)
+	}
+	if c.ApiKey == "" || c.ApiSecret == "" {
+		return Credentials{}, fmt.Errorf("%w: api_key or api_secret is empty in %v", ErrNoCredentials, f.Path)
+	}
+	f.cached = c
+	f.modTime = info.ModTime()
+	return c, nil
+}
+
+// RotatingCredentials is the credentials which can be swapped at runtime.
+type RotatingCredentials struct {
+	mu      sync.RWMutex
+	current Credentials
+}
+
+// NewRotatingCredentials creates RotatingCredentials.
+func NewRotatingCredentials(apiKey string, apiSecret string) *RotatingCredentials {
+	return &RotatingCredentials{current: Credentials{ApiKey: apiKey, ApiSecret: apiSecret}}
+}
+
+// Credentials returns the current credentials.
+func (r *RotatingCredentials) Credentials() (Credentials, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if r.current.ApiKey == "" {
+		return Credentials{}, ErrNoCredentials
+	}
+	return r.current, nil
+}
+
+// Rotate swaps the credentials. Requests signed after it use the new ones.
+func (r *RotatingCredentials) Rotate(apiKey string, apiSecret string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.current = Credentials{ApiKey: apiKey, ApiSecret: apiSecret}
+}
+
+// String returns the redacted credentials.
+func (r *RotatingCredentials) String() string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.current.String()
+}
+
+// secretHeaders matches the authentication headers in dumps of requests.
+var secretHeaders = regexp.MustCompile(`(?mi)^(Access-Key|Access-Sign):[^\r\n]*`)
+
+// secretFields matches the secret fields of JSON in dumps, e.g. websocket auth and withdraw.
+var secretFields = regexp.MustCompile(`"(api_key|api_secret|signature|code)"\s*:\s*"[^"]*"`)
+
+// redactDump replaces the authentication headers and the secret fields in the dump.
+func redactDump(dump []byte) []byte {
+	dump = secretHeaders.ReplaceAll(dump, []byte("$1: [REDACTED]"))
+	return secretFields.ReplaceAll(dump, []byte(`"$1":"[REDACTED]"`))
+}
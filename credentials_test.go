@@ -0,0 +1,118 @@
+package bitflyergo
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCredentialsString(t *testing.T) {
+	c := Credentials{ApiKey: "key", ApiSecret: "secret"}
+	for _, s := range []string{
+		fmt.Sprint(c), fmt.Sprintf("%+v", c), fmt.Sprintf("%#v", c),
+		fmt.Sprintf("%+v", StaticCredentials(c)), fmt.Sprint(NewRotatingCredentials("key", "secret")),
+		fmt.Sprintf("%+v", *New(WithCredentials("key", "secret"))),
+	} {
+		if strings.Contains(s, "key\"") || strings.Contains(s, "secret") {
+			t.Errorf("credentials are printed: %v", s)
+		}
+	}
+}
+
+func TestEnvCredentials(t *testing.T) {
+	os.Setenv("TEST_BF_KEY", "key")
+	os.Setenv("TEST_BF_SECRET", "secret")
+	defer os.Unsetenv("TEST_BF_KEY")
+	defer os.Unsetenv("TEST_BF_SECRET")
+
+	c, err := EnvCredentials{ApiKeyVar: "TEST_BF_KEY", ApiSecretVar: "TEST_BF_SECRET"}.Credentials()
+	if err != nil || c.ApiKey != "key" || c.ApiSecret != "secret" {
+		t.Errorf("unexpected credentials: %v, %v", c, err)
+	}
+	if _, err := (EnvCredentials{ApiKeyVar: "TEST_BF_NONE"}).Credentials(); !errors.Is(err, ErrNoCredentials) {
+		t.Errorf("expected ErrNoCredentials: %v", err)
+	}
+}
+
+func TestFileCredentials(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bitflyergo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "credentials.json")
+
+	if err := ioutil.WriteFile(path, []byte(`{"api_key":"key","api_secret":"secret"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	f := NewFileCredentials(path)
+	if _, err := f.Credentials(); err == nil || !strings.Contains(err.Error(), "too open") {
+		t.Errorf("expected permission error: %v", err)
+	}
+
+	os.Chmod(path, 0600)
+	c, err := f.Credentials()
+	if err != nil || c.ApiKey != "key" || c.ApiSecret != "secret" {
+		t.Errorf("unexpected credentials: %v, %v", c, err)
+	}
+
+	// rotate by replacing the file
+	ioutil.WriteFile(path, []byte(`{"api_key":"key2","api_secret":"secret2"}`), 0600)
+	os.Chtimes(path, time.Now(), time.Now().Add(time.Second))
+	if c, _ := f.Credentials(); c.ApiKey != "key2" || c.ApiSecret != "secret2" {
+		t.Errorf("file was not read again: %v", c)
+	}
+}
+
+func TestRotatingCredentials(t *testing.T) {
+	r := NewRotatingCredentials("key", "secret")
+	bf, server := newTestBitflyer(t, func(w http.ResponseWriter, r *http.Request) {
+		if key := r.Header.Get("ACCESS-KEY"); key != "key2" {
+			t.Errorf("rotated key is not used: %v", key)
+		}
+		fmt.Fprint(w, `[]`)
+	})
+	defer server.Close()
+	bf.Credentials = r
+
+	r.Rotate("key2", "secret")
+	if _, err := bf.GetPositions(productCode); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestPrivateApiWithoutCredentials(t *testing.T) {
+	bf := New()
+	if _, err := bf.GetPositions(productCode); !errors.Is(err, ErrNoCredentials) {
+		t.Errorf("expected ErrNoCredentials: %v", err)
+	}
+}
+
+func TestDebugDumpIsRedacted(t *testing.T) {
+	bf, server := newTestBitflyer(t, func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[]`)
+	})
+	defer server.Close()
+	var buf bytes.Buffer
+	bf.Logger = NewStdLogger(log.New(&buf, "", 0))
+	bf.Debug = true
+
+	if _, err := bf.GetPositions(productCode); err != nil {
+		t.Fatal(err)
+	}
+	dump := buf.String()
+	if !strings.Contains(dump, "Access-Key: [REDACTED]\r\n") || !strings.Contains(dump, "Access-Sign: [REDACTED]\r\n") {
+		t.Errorf("headers are not redacted: %v", dump)
+	}
+	if strings.Contains(dump, "Access-Key: key") {
+		t.Errorf("api key is printed: %v", dump)
+	}
+}
@@ -0,0 +1,460 @@
+package bitflyergo
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"math/bits"
+	"strconv"
+	"strings"
+)
+
+// DecimalPlaces is the number of fractional digits held by Decimal.
+//
+// bitFlyer accepts sizes down to 1 satoshi (0.00000001), so 8 places are enough
+// for every size, price, balance and commission returned by the api.
+const DecimalPlaces = 8
+
+const decimalScale = 100000000 // 10^DecimalPlaces
+
+var bigDecimalScale = big.NewInt(decimalScale)
+
+// Decimal is a fixed-point decimal number with DecimalPlaces fractional digits.
+//
+// It keeps values like 0.1+0.2 or large JPY amounts exact, and marshals to and from
+// JSON numbers without going through float64.
+// The value is held in 128 bits, so the representable range is about ±1.7e30, far beyond
+// any price, size or JPY notional of the market. The arithmetic panics with ErrDecimalOverflow
+// beyond it instead of wrapping around. Use the checked variants such as MulChecked to get the error.
+// The zero value is 0.
+type Decimal struct {
+	hi int64  // high 64 bits of the value multiplied by 10^DecimalPlaces in two's complement
+	lo uint64 // low 64 bits of it
+}
+
+// Zero is Decimal of 0.
+var Zero = Decimal{}
+
+// ErrDecimalOverflow is returned by the checked operations when the result is out of the range of Decimal.
+// The other operations panic with it.
+var ErrDecimalOverflow = errors.New("decimal overflow")
+
+// ErrDivisionByZero is returned by DivChecked when the divisor is zero. Div panics with it.
+var ErrDivisionByZero = errors.New("decimal division by zero")
+
+// NewDecimal creates Decimal of value * 10^exp. It panics with ErrDecimalOverflow if the value is out of range.
+//
+// e.g.
+//
+//	NewDecimal(1, -2) -> 0.01
+//	NewDecimal(5, 3)  -> 5000
+func NewDecimal(value int64, exp int) Decimal {
+	if exp <= 0 && -exp <= DecimalPlaces {
+		return scaled(value, pow10(DecimalPlaces+exp))
+	}
+	r := new(big.Rat).SetInt64(value)
+	p := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(abs(exp))), nil)
+	if exp > 0 {
+		r.Mul(r, new(big.Rat).SetInt(p))
+	} else {
+		r.Quo(r, new(big.Rat).SetInt(p))
+	}
+	d, ok := decimalFromRat(r)
+	if !ok {
+		panic(overflowError("NewDecimal", value, exp))
+	}
+	return d
+}
+
+// NewDecimalFromInt creates Decimal of integer value.
+func NewDecimalFromInt(value int64) Decimal {
+	return scaled(value, decimalScale)
+}
+
+// scaled returns Decimal whose internal value is value * m. It never overflows for m <= decimalScale.
+func scaled(value int64, m int64) Decimal {
+	if value <= math.MaxInt64/m && value >= math.MinInt64/m {
+		return decimalFromInt64(value * m)
+	}
+	d, _ := decimalFromBig(new(big.Int).Mul(big.NewInt(value), big.NewInt(m)))
+	return d
+}
+
+// NewDecimalFromFloat creates Decimal from float64 rounded to DecimalPlaces.
+//
+// The shortest decimal representation of f is used, so 0.1 becomes exactly 0.1.
+// NaN and infinities are Zero. It panics with ErrDecimalOverflow if f is out of range.
+func NewDecimalFromFloat(f float64) Decimal {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return Zero
+	}
+	d, err := ParseDecimal(strconv.FormatFloat(f, 'g', -1, 64))
+	if err != nil {
+		panic(overflowError("NewDecimalFromFloat", f))
+	}
+	return d
+}
+
+// ParseDecimal parses decimal string such as "123.45", "-0.001" or "1e-05".
+//
+// Digits beyond DecimalPlaces are rounded half away from zero.
+func ParseDecimal(s string) (Decimal, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return Zero, fmt.Errorf("invalid decimal: empty string")
+	}
+	r, ok := new(big.Rat).SetString(s)
+	if !ok {
+		return Zero, fmt.Errorf("invalid decimal: %q", s)
+	}
+	d, ok := decimalFromRat(r)
+	if !ok {
+		return Zero, fmt.Errorf("decimal out of range: %q", s)
+	}
+	return d, nil
+}
+
+// MustParseDecimal is like ParseDecimal but panics if s can not be parsed.
+func MustParseDecimal(s string) Decimal {
+	d, err := ParseDecimal(s)
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
+
+// decimalFromRat converts r to Decimal with rounding half away from zero.
+func decimalFromRat(r *big.Rat) (Decimal, bool) {
+	n := new(big.Int).Mul(r.Num(), bigDecimalScale)
+	q, m := new(big.Int).QuoRem(n, r.Denom(), new(big.Int))
+	if m.Sign() != 0 {
+		m.Abs(m).Lsh(m, 1)
+		if m.Cmp(r.Denom()) >= 0 {
+			if n.Sign() < 0 {
+				q.Sub(q, big.NewInt(1))
+			} else {
+				q.Add(q, big.NewInt(1))
+			}
+		}
+	}
+	return decimalFromBig(q)
+}
+
+// decimalFromInt64 returns Decimal whose internal value is v.
+func decimalFromInt64(v int64) Decimal {
+	return Decimal{hi: v >> 63, lo: uint64(v)}
+}
+
+var mask64 = new(big.Int).SetUint64(math.MaxUint64)
+
+// decimalFromBig returns Decimal whose internal value is b, or false if b doesn't fit in 128 bits.
+func decimalFromBig(b *big.Int) (Decimal, bool) {
+	if b.IsInt64() {
+		return decimalFromInt64(b.Int64()), true
+	}
+	if b.BitLen() > 127 {
+		return Zero, false
+	}
+	lo := new(big.Int).And(b, mask64)
+	hi := new(big.Int).Rsh(b, 64)
+	return Decimal{hi: hi.Int64(), lo: lo.Uint64()}, true
+}
+
+// isInt64 returns true if the internal value of d fits in int64.
+func (d Decimal) isInt64() bool {
+	return d.hi == int64(d.lo)>>63
+}
+
+// bigInt returns the internal value of d.
+func (d Decimal) bigInt() *big.Int {
+	if d.isInt64() {
+		return big.NewInt(int64(d.lo))
+	}
+	b := new(big.Int).Lsh(big.NewInt(d.hi), 64)
+	return b.Add(b, new(big.Int).SetUint64(d.lo))
+}
+
+// overflowError returns ErrDecimalOverflow with the operation and its operands.
+func overflowError(op string, operands ...interface{}) error {
+	return fmt.Errorf("%w: %v%v", ErrDecimalOverflow, op, operands)
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+func pow10(n int) int64 {
+	p := int64(1)
+	for i := 0; i < n; i++ {
+		p *= 10
+	}
+	return p
+}
+
+// Add returns d + d2. It panics with ErrDecimalOverflow if the result is out of range. See AddChecked.
+func (d Decimal) Add(d2 Decimal) Decimal {
+	return mustChecked(d.AddChecked(d2))
+}
+
+// Sub returns d - d2. It panics with ErrDecimalOverflow if the result is out of range. See SubChecked.
+func (d Decimal) Sub(d2 Decimal) Decimal {
+	return mustChecked(d.SubChecked(d2))
+}
+
+// Mul returns d * d2 rounded to DecimalPlaces.
+// It panics with ErrDecimalOverflow if the result is out of range. See MulChecked.
+func (d Decimal) Mul(d2 Decimal) Decimal {
+	return mustChecked(d.MulChecked(d2))
+}
+
+// Div returns d / d2 rounded to DecimalPlaces.
+// Like the division of integers, it panics with ErrDivisionByZero if d2 is zero. See DivChecked.
+func (d Decimal) Div(d2 Decimal) Decimal {
+	return mustChecked(d.DivChecked(d2))
+}
+
+// AddChecked returns d + d2, or ErrDecimalOverflow if the result is out of range.
+func (d Decimal) AddChecked(d2 Decimal) (Decimal, error) {
+	lo, carry := bits.Add64(d.lo, d2.lo, 0)
+	r := Decimal{hi: d.hi + d2.hi + int64(carry), lo: lo}
+	if (d.hi < 0) == (d2.hi < 0) && (r.hi < 0) != (d.hi < 0) {
+		return Zero, overflowError("Add", d, d2)
+	}
+	return r, nil
+}
+
+// SubChecked returns d - d2, or ErrDecimalOverflow if the result is out of range.
+func (d Decimal) SubChecked(d2 Decimal) (Decimal, error) {
+	lo, borrow := bits.Sub64(d.lo, d2.lo, 0)
+	r := Decimal{hi: d.hi - d2.hi - int64(borrow), lo: lo}
+	if (d.hi < 0) != (d2.hi < 0) && (r.hi < 0) != (d.hi < 0) {
+		return Zero, overflowError("Sub", d, d2)
+	}
+	return r, nil
+}
+
+// MulChecked returns d * d2 rounded to DecimalPlaces, or ErrDecimalOverflow if the result is out of range.
+func (d Decimal) MulChecked(d2 Decimal) (Decimal, error) {
+	r := new(big.Rat).SetFrac(
+		new(big.Int).Mul(d.bigInt(), d2.bigInt()),
+		new(big.Int).Mul(bigDecimalScale, bigDecimalScale))
+	res, ok := decimalFromRat(r)
+	if !ok {
+		return Zero, overflowError("Mul", d, d2)
+	}
+	return res, nil
+}
+
+// DivChecked returns d / d2 rounded to DecimalPlaces.
+// It returns ErrDivisionByZero if d2 is zero, or ErrDecimalOverflow if the result is out of range.
+func (d Decimal) DivChecked(d2 Decimal) (Decimal, error) {
+	if d2.IsZero() {
+		return Zero, ErrDivisionByZero
+	}
+	r := new(big.Rat).SetFrac(d.bigInt(), d2.bigInt())
+	res, ok := decimalFromRat(r)
+	if !ok {
+		return Zero, overflowError("Div", d, d2)
+	}
+	return res, nil
+}
+
+// mustChecked returns d, or panics with err.
+func mustChecked(d Decimal, err error) Decimal {
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
+
+// Neg returns -d. It panics with ErrDecimalOverflow if d is the minimum value.
+func (d Decimal) Neg() Decimal {
+	r, err := Zero.SubChecked(d)
+	if err != nil {
+		panic(overflowError("Neg", d))
+	}
+	return r
+}
+
+// Abs returns absolute value of d. It panics with ErrDecimalOverflow if d is the minimum value.
+func (d Decimal) Abs() Decimal {
+	if d.hi < 0 {
+		return d.Neg()
+	}
+	return d
+}
+
+// Truncate drops digits of d beyond places fractional digits.
+//
+// e.g. Truncate(2) of 0.019 is 0.01. It is useful to fit a size to the minimum order unit.
+func (d Decimal) Truncate(places int) Decimal {
+	if places >= DecimalPlaces {
+		return d
+	}
+	if places < 0 {
+		places = 0
+	}
+	unit := pow10(DecimalPlaces - places)
+	if d.isInt64() {
+		v := int64(d.lo)
+		return decimalFromInt64(v / unit * unit)
+	}
+	b := big.NewInt(unit)
+	r, _ := decimalFromBig(new(big.Int).Mul(new(big.Int).Quo(d.bigInt(), b), b))
+	return r
+}
+
+// Cmp compares d and d2 and returns -1 if d < d2, 0 if d == d2 and +1 if d > d2.
+func (d Decimal) Cmp(d2 Decimal) int {
+	switch {
+	case d.hi < d2.hi || (d.hi == d2.hi && d.lo < d2.lo):
+		return -1
+	case d.hi > d2.hi || (d.hi == d2.hi && d.lo > d2.lo):
+		return 1
+	}
+	return 0
+}
+
+// Equal returns true if d equals d2.
+func (d Decimal) Equal(d2 Decimal) bool {
+	return d == d2
+}
+
+// LessThan returns true if d < d2.
+func (d Decimal) LessThan(d2 Decimal) bool {
+	return d.Cmp(d2) < 0
+}
+
+// GreaterThan returns true if d > d2.
+func (d Decimal) GreaterThan(d2 Decimal) bool {
+	return d.Cmp(d2) > 0
+}
+
+// Sign returns -1, 0 or +1 according to the sign of d.
+func (d Decimal) Sign() int {
+	return d.Cmp(Zero)
+}
+
+// IsZero returns true if d is 0.
+func (d Decimal) IsZero() bool {
+	return d == Zero
+}
+
+// Float64 returns the nearest float64 value of d.
+func (d Decimal) Float64() float64 {
+	f, _ := strconv.ParseFloat(d.String(), 64)
+	return f
+}
+
+// IntPart returns integer part of d. The result is undefined if it doesn't fit in int64.
+func (d Decimal) IntPart() int64 {
+	if d.isInt64() {
+		return int64(d.lo) / decimalScale
+	}
+	return new(big.Int).Quo(d.bigInt(), bigDecimalScale).Int64()
+}
+
+// String returns d as decimal string without trailing zeros.
+//
+// e.g. "0.3", "-12.5", "400000"
+func (d Decimal) String() string {
+	if !d.isInt64() {
+		return d.bigString()
+	}
+	v := int64(d.lo)
+	neg := v < 0
+	u := uint64(v)
+	if neg {
+		u = uint64(-v)
+	}
+	s := strconv.FormatUint(u/decimalScale, 10)
+	if frac := u % decimalScale; frac != 0 {
+		fs := strconv.FormatUint(frac+decimalScale, 10)[1:]
+		s += "." + strings.TrimRight(fs, "0")
+	}
+	if neg {
+		s = "-" + s
+	}
+	return s
+}
+
+// bigString returns d as decimal string like String for the value not fitting in int64.
+func (d Decimal) bigString() string {
+	b := d.bigInt()
+	neg := b.Sign() < 0
+	digits := new(big.Int).Abs(b).String() // longer than DecimalPlaces digits
+	s := digits[:len(digits)-DecimalPlaces]
+	if frac := strings.TrimRight(digits[len(digits)-DecimalPlaces:], "0"); frac != "" {
+		s += "." + frac
+	}
+	if neg {
+		s = "-" + s
+	}
+	return s
+}
+
+// MarshalJSON marshals d to JSON number.
+func (d Decimal) MarshalJSON() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+// UnmarshalJSON unmarshals JSON number or numeric string to d. null is treated as 0.
+func (d *Decimal) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	if bytes.Equal(data, []byte("null")) {
+		*d = Zero
+		return nil
+	}
+	s := string(data)
+	if len(data) > 0 && data[0] == '"' {
+		if err := json.Unmarshal(data, &s); err != nil {
+			return err
+		}
+		if s == "" {
+			*d = Zero
+			return nil
+		}
+	}
+	v, err := ParseDecimal(s)
+	if err != nil {
+		return err
+	}
+	*d = v
+	return nil
+}
+
+// Pnl returns profit and loss of the position opened at entryPrice and closed at exitPrice.
+//
+// side is the side of the opening order, SideBuy or SideSell.
+func Pnl(side string, entryPrice Decimal, exitPrice Decimal, size Decimal) Decimal {
+	pnl := exitPrice.Sub(entryPrice).Mul(size)
+	if side == SideSell {
+		return pnl.Neg()
+	}
+	return pnl
+}
+
+// Notional returns price * size.
+func Notional(price Decimal, size Decimal) Decimal {
+	return price.Mul(size)
+}
+
+// AveragePrice returns size weighted average price of the executions, or Zero if their total size is zero.
+func AveragePrice(executions []MyExecution) Decimal {
+	amount := Zero
+	size := Zero
+	for _, e := range executions {
+		amount = amount.Add(e.Price.Mul(e.Size))
+		size = size.Add(e.Size)
+	}
+	if size.IsZero() {
+		return Zero
+	}
+	return amount.Div(size)
+}
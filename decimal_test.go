@@ -0,0 +1,205 @@
+package bitflyergo
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestParseDecimal(t *testing.T) {
+	cases := map[string]string{
+		"0":            "0",
+		"0.1":          "0.1",
+		"-12.50":       "-12.5",
+		"400000":       "400000",
+		"1e-05":        "0.00001",
+		"0.123456789":  "0.12345679",
+		"-0.000000005": "-0.00000001",
+		"12345678901":  "12345678901",
+	}
+	for in, expected := range cases {
+		d, err := ParseDecimal(in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if d.String() != expected {
+			t.Fatalf("Expect: %v, Actual: %v, Input: %v", expected, d.String(), in)
+		}
+	}
+	if _, err := ParseDecimal("abc"); err == nil {
+		t.Fatal("error must be returned for invalid string.")
+	}
+	if _, err := ParseDecimal("1e31"); err == nil {
+		t.Fatal("error must be returned for out of range value.")
+	}
+}
+
+func TestDecimalArithmetic(t *testing.T) {
+	a := NewDecimalFromFloat(0.1)
+	b := NewDecimalFromFloat(0.2)
+	if s := a.Add(b).String(); s != "0.3" {
+		t.Fatalf("Expect: 0.3, Actual: %v", s)
+	}
+	if s := a.Sub(b).String(); s != "-0.1" {
+		t.Fatalf("Expect: -0.1, Actual: %v", s)
+	}
+	price := MustParseDecimal("5123456")
+	size := MustParseDecimal("0.01234567")
+	if s := price.Mul(size).String(); s != "63252.49703552" {
+		t.Fatalf("Expect: 63252.49703552, Actual: %v", s)
+	}
+	if s := NewDecimalFromInt(1).Div(NewDecimalFromInt(3)).String(); s != "0.33333333" {
+		t.Fatalf("Expect: 0.33333333, Actual: %v", s)
+	}
+	func() {
+		defer func() {
+			if err := recover(); err != ErrDivisionByZero {
+				t.Errorf("division by zero must panic with ErrDivisionByZero: %v", err)
+			}
+		}()
+		NewDecimalFromInt(1).Div(Zero)
+	}()
+	if s := MustParseDecimal("0.019").Truncate(2).String(); s != "0.01" {
+		t.Fatalf("Expect: 0.01, Actual: %v", s)
+	}
+	if NewDecimal(1, -2).Cmp(NewDecimalFromFloat(MinimumOrderbleSize)) != 0 {
+		t.Fatal("NewDecimal(1, -2) must equal minimum orderable size.")
+	}
+}
+
+func TestDecimalJSON(t *testing.T) {
+	var b Balance
+	err := json.Unmarshal([]byte(`{"currency_code":"BTC","amount":1.23456789,"available":"0.5"}`), &b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.Amount.String() != "1.23456789" || b.Available.String() != "0.5" {
+		t.Fatalf("%v\n", b)
+	}
+	data, err := json.Marshal(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `{"currency_code":"BTC","amount":1.23456789,"available":0.5}` {
+		t.Fatalf("%s\n", data)
+	}
+}
+
+func TestPnl(t *testing.T) {
+	entry := NewDecimalFromInt(1000000)
+	exit := NewDecimalFromInt(1001000)
+	size := MustParseDecimal("0.3")
+	if s := Pnl(SideBuy, entry, exit, size).String(); s != "300" {
+		t.Fatalf("Expect: 300, Actual: %v", s)
+	}
+	if s := Pnl(SideSell, entry, exit, size).String(); s != "-300" {
+		t.Fatalf("Expect: -300, Actual: %v", s)
+	}
+	executions := []MyExecution{
+		{Price: NewDecimalFromInt(100), Size: MustParseDecimal("0.1")},
+		{Price: NewDecimalFromInt(200), Size: MustParseDecimal("0.3")},
+	}
+	if s := AveragePrice(executions).String(); s != "175" {
+		t.Fatalf("Expect: 175, Actual: %v", s)
+	}
+}
+
+// expectOverflow fails if fn doesn't panic with ErrDecimalOverflow.
+func expectOverflow(t *testing.T, name string, fn func()) {
+	t.Helper()
+	defer func() {
+		err, ok := recover().(error)
+		if !ok || !errors.Is(err, ErrDecimalOverflow) {
+			t.Errorf("%v: expected panic with ErrDecimalOverflow, actual=%v", name, err)
+		}
+	}()
+	fn()
+}
+
+func TestDecimalOverflow(t *testing.T) {
+	max := Decimal{hi: math.MaxInt64, lo: math.MaxUint64}
+	min := Decimal{hi: math.MinInt64}
+	one := NewDecimal(1, -DecimalPlaces)
+
+	// boundary
+	if s := max.Sub(one).Add(one); !s.Equal(max) {
+		t.Errorf("max-1+1: %v", s)
+	}
+	if s := min.Add(one).Sub(one); !s.Equal(min) {
+		t.Errorf("min+1-1: %v", s)
+	}
+	if s := max.String(); s != "1701411834604692317316873037158.84105727" {
+		t.Errorf("max: %v", s)
+	}
+	if d := MustParseDecimal(max.String()); !d.Equal(max) {
+		t.Errorf("parse max: %v", d)
+	}
+	if _, err := max.AddChecked(one); !errors.Is(err, ErrDecimalOverflow) {
+		t.Errorf("max+1: %v", err)
+	}
+	if _, err := min.SubChecked(one); !errors.Is(err, ErrDecimalOverflow) {
+		t.Errorf("min-1: %v", err)
+	}
+	expectOverflow(t, "Add", func() { max.Add(one) })
+	expectOverflow(t, "Sub", func() { min.Sub(one) })
+	expectOverflow(t, "Neg", func() { min.Neg() })
+	expectOverflow(t, "Mul", func() { max.Mul(NewDecimalFromInt(2)) })
+	if _, err := max.DivChecked(NewDecimal(1, -1)); !errors.Is(err, ErrDecimalOverflow) {
+		t.Errorf("max/0.1: %v", err)
+	}
+	if _, err := one.DivChecked(Zero); err != ErrDivisionByZero {
+		t.Errorf("division by zero: %v", err)
+	}
+	expectOverflow(t, "NewDecimal", func() { NewDecimal(1, 31) })
+
+	// int64 boundary of the previous representation
+	if d := NewDecimalFromInt(math.MaxInt64); d.String() != "9223372036854775807" || d.IntPart() != math.MaxInt64 {
+		t.Errorf("NewDecimalFromInt: %v", d)
+	}
+	if d := NewDecimalFromInt(math.MinInt64).Add(one); d.String() != "-9223372036854775807.99999999" {
+		t.Errorf("NewDecimalFromInt: %v", d)
+	}
+	if d := NewDecimal(math.MaxInt64, 3); d.String() != "9223372036854775807000" {
+		t.Errorf("NewDecimal: %v", d)
+	}
+	if d := NewDecimal(123456789, -9); d.String() != "0.12345679" {
+		t.Errorf("NewDecimal: %v", d)
+	}
+	if d := MustParseDecimal("123456789012.123456789").Truncate(2); d.String() != "123456789012.12" {
+		t.Errorf("Truncate: %v", d)
+	}
+	if d := MustParseDecimal("-123456789012.129").Truncate(2); d.String() != "-123456789012.12" {
+		t.Errorf("Truncate: %v", d)
+	}
+
+	// JPY notionals beyond 9.2e10
+	price := NewDecimalFromInt(15000000)
+	notional := Zero
+	for i := 0; i < 10; i++ {
+		notional = notional.Add(Notional(price, NewDecimalFromInt(1000)))
+	}
+	if notional.String() != "150000000000" || notional.Float64() != 1.5e11 {
+		t.Errorf("1.5e11: %v", notional)
+	}
+	if avg := notional.Div(NewDecimalFromInt(10000)); !avg.Equal(price) {
+		t.Errorf("average: %v", avg)
+	}
+	if !notional.GreaterThan(Notional(price, NewDecimalFromInt(6000))) || notional.Neg().Sign() != -1 {
+		t.Errorf("compare: %v", notional)
+	}
+	if d := NewDecimalFromFloat(1.5e11); !d.Equal(notional) {
+		t.Errorf("NewDecimalFromFloat: %v", d)
+	}
+	data, _ := json.Marshal(notional.Neg())
+	var d Decimal
+	if err := json.Unmarshal(data, &d); err != nil || !d.Equal(notional.Neg()) {
+		t.Errorf("json: %v %v", string(data), err)
+	}
+	if p := Pnl(SideSell, price, price.Add(NewDecimalFromInt(10000)), NewDecimalFromInt(20000000)); p.String() != "-200000000000" {
+		t.Errorf("Pnl: %v", p)
+	}
+	if avg := AveragePrice(nil); !avg.IsZero() {
+		t.Errorf("AveragePrice: %v", avg)
+	}
+}
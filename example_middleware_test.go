@@ -0,0 +1,80 @@
+package bitflyergo_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/mitsutoshi/bitflyergo"
+)
+
+// This example records the audit trail of every request.
+func ExampleHooks() {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[]`)
+	}))
+	defer server.Close()
+
+	audit := bitflyergo.Hooks{
+		AfterReceive: func(req *http.Request, res *bitflyergo.Response) {
+			fmt.Println("audit:", req.Method, req.URL.Path, res.StatusCode)
+		},
+		OnError: func(req *http.Request, err error) {
+			fmt.Println("audit:", req.Method, req.URL.Path, err)
+		},
+	}
+	bf := bitflyergo.New(
+		bitflyergo.WithBaseURL(server.URL),
+		bitflyergo.WithCredentials("key", "secret"),
+		bitflyergo.WithMiddleware(audit.Middleware()))
+
+	_, _ = bf.GetPositions("FX_BTC_JPY")
+	_, _ = bf.GetChildOrders(map[string]string{"product_code": "FX_BTC_JPY"})
+
+	// Output:
+	// audit: GET /v1/me/getpositions 200
+	// audit: GET /v1/me/getchildorders 200
+}
+
+// This example tracks the latency of each API.
+func ExampleMiddleware() {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[]`)
+	}))
+	defer server.Close()
+
+	var mu sync.Mutex
+	latencies := map[string][]time.Duration{}
+	tracker := func(next bitflyergo.Handler) bitflyergo.Handler {
+		return func(req *http.Request) (*bitflyergo.Response, error) {
+			st := time.Now()
+			res, err := next(req)
+			mu.Lock()
+			latencies[req.URL.Path] = append(latencies[req.URL.Path], time.Since(st))
+			mu.Unlock()
+			return res, err
+		}
+	}
+	bf := bitflyergo.New(bitflyergo.WithBaseURL(server.URL), bitflyergo.WithMiddleware(tracker))
+
+	for i := 0; i < 3; i++ {
+		_, _ = bf.GetMarkets()
+	}
+	_, _ = bf.GetExecutions(map[string]string{"product_code": "FX_BTC_JPY"})
+
+	paths := make([]string, 0, len(latencies))
+	for path := range latencies {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		fmt.Println(path, len(latencies[path]))
+	}
+
+	// Output:
+	// /v1/getexecutions 1
+	// /v1/getmarkets 3
+}
@@ -0,0 +1,293 @@
+package bitflyergo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// GateAction is the action for the order sent when market is in a certain state.
+type GateAction int
+
+const (
+	GateAllow  GateAction = iota // send the order
+	GateDelay                    // wait until the state becomes allowed, up to OrderGatePolicy.MaxDelay
+	GateReject                   // return ErrOrderGated
+)
+
+// ErrOrderGated is returned by PlaceChildOrder when the order is refused by Bitflyer.OrderGate.
+var ErrOrderGated = errors.New("order was refused by the order gate")
+
+// PollError is returned by HealthMonitor.Poll when board state of some products couldn't be got.
+type PollError struct {
+	Errors map[string]error // error for each product code
+}
+
+// Error returns the errors of all products.
+func (e *PollError) Error() string {
+	products := make([]string, 0, len(e.Errors))
+	for p := range e.Errors {
+		products = append(products, p)
+	}
+	sort.Strings(products)
+	msgs := make([]string, len(products))
+	for i, p := range products {
+		msgs[i] = p + ": " + e.Errors[p].Error()
+	}
+	return "failed to poll board state. [" + strings.Join(msgs, ", ") + "]"
+}
+
+// jst is Japan Standard Time.
+var jst = time.FixedZone("JST", 9*60*60)
+
+// OrderGate decides whether the order of product can be sent now.
+type OrderGate interface {
+
+	// Admit returns nil if the order can be sent. It may block to delay the order.
+	Admit(productCode string) error
+}
+
+// OrderGatePolicy is the policy of HealthMonitor to admit orders.
+type OrderGatePolicy struct {
+	Health      map[string]GateAction // action for each health. health not in the map is allowed
+	State       map[string]GateAction // action for each state. state not in the map is allowed
+	Maintenance GateAction            // action during the daily maintenance from 04:00 to 04:10 JST
+	Unknown     GateAction            // action when state of product hasn't been polled yet
+	Stale       GateAction            // action when state of product is older than MaxAge
+	MaxAge      time.Duration         // age of the stale state. zero means 3 times Interval of HealthMonitor
+	MaxDelay    time.Duration         // maximum time to delay the order before rejecting it
+}
+
+// DefaultOrderGatePolicy rejects orders when market is stopped or not running, and delays
+// them for a while when market is super busy or its state is unknown or stale.
+var DefaultOrderGatePolicy = OrderGatePolicy{
+	Health: map[string]GateAction{
+		HealthSuperBusy: GateDelay,
+		HealthNoOrder:   GateReject,
+		HealthStop:      GateReject,
+	},
+	State: map[string]GateAction{
+		StateClosed:       GateReject,
+		StateStarting:     GateReject,
+		StatePreopen:      GateReject,
+		StateCircuitBreak: GateReject,
+		StateAwatingSq:    GateReject,
+		StateMatured:      GateReject,
+	},
+	Maintenance: GateReject,
+	Unknown:     GateDelay,
+	Stale:       GateDelay,
+	MaxDelay:    5 * time.Second,
+}
+
+// InMaintenance returns true if t is in the daily maintenance from 04:00 to 04:10 JST.
+func InMaintenance(t time.Time) bool {
+	t = t.In(jst)
+	return t.Hour() == 4 && t.Minute() < 10
+}
+
+// HealthMonitor polls board state of products and caches it.
+//
+// Set it to Bitflyer.OrderGate to refuse or delay orders according to Policy.
+type HealthMonitor struct {
+	Policy   OrderGatePolicy // policy to admit orders
+	Interval time.Duration   // interval of polling
+
+	// OnChange is called when health or state of product changes. It may be nil.
+	OnChange func(productCode string, previous BoardState, current BoardState)
+
+	bf       *Bitflyer
+	products []string
+	now      func() time.Time
+
+	mu      sync.Mutex
+	states  map[string]polledState
+	changed chan struct{}
+}
+
+// polledState is board state of product and the time when it was polled.
+type polledState struct {
+	state    BoardState
+	polledAt time.Time
+}
+
+// NewHealthMonitor creates HealthMonitor with DefaultOrderGatePolicy.
+func NewHealthMonitor(bf *Bitflyer, productCodes []string, interval time.Duration) *HealthMonitor {
+	return &HealthMonitor{
+		Policy:   DefaultOrderGatePolicy,
+		Interval: interval,
+		bf:       bf,
+		products: productCodes,
+		now:      time.Now,
+		states:   map[string]polledState{},
+		changed:  make(chan struct{}),
+	}
+}
+
+// Run polls board state at Interval until ctx is done.
+func (m *HealthMonitor) Run(ctx context.Context) error {
+	ticker := time.NewTicker(m.Interval)
+	defer ticker.Stop()
+	for {
+		if err := m.Poll(); err != nil {
+			m.logger().Warn("failed to poll board state", "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Poll gets board state of all products once.
+//
+// It polls every product even if some of them fail, and returns PollError of the failed ones.
+func (m *HealthMonitor) Poll() error {
+	var errs map[string]error
+	for _, p := range m.products {
+		bs, err := m.bf.GetBoardState(p)
+		if err != nil {
+			if errs == nil {
+				errs = map[string]error{}
+			}
+			errs[p] = err
+			continue
+		}
+		m.Update(p, *bs)
+	}
+	if errs != nil {
+		return &PollError{Errors: errs}
+	}
+	return nil
+}
+
+// Update sets board state of product, e.g. the one got by GetBoardState.
+func (m *HealthMonitor) Update(productCode string, state BoardState) {
+	m.mu.Lock()
+	ps, ok := m.states[productCode]
+	prev := ps.state
+	m.states[productCode] = polledState{state: state, polledAt: m.now()}
+	changed := !ok || prev.Health != state.Health || prev.State != state.State
+	if changed {
+		close(m.changed)
+		m.changed = make(chan struct{})
+	}
+	m.mu.Unlock()
+
+	if changed && ok && m.OnChange != nil {
+		m.OnChange(productCode, prev, state)
+	}
+}
+
+// State returns the cached board state of product. ok is false if it hasn't been polled yet.
+func (m *HealthMonitor) State(productCode string) (state BoardState, ok bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ps, ok := m.states[productCode]
+	return ps.state, ok
+}
+
+// PolledAt returns the time when board state of product was updated last. ok is false if it hasn't been polled yet.
+func (m *HealthMonitor) PolledAt(productCode string) (polledAt time.Time, ok bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ps, ok := m.states[productCode]
+	return ps.polledAt, ok
+}
+
+// Check returns the action for the order of product according to the cached state and Policy.
+func (m *HealthMonitor) Check(productCode string) (GateAction, string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.check(productCode)
+}
+
+// check returns the action and its reason. m.mu must be held.
+func (m *HealthMonitor) check(productCode string) (GateAction, string) {
+	action, reason := GateAllow, ""
+	stronger := func(a GateAction, r string) {
+		if a > action {
+			action, reason = a, r
+		}
+	}
+	if InMaintenance(m.now()) {
+		stronger(m.Policy.Maintenance, "maintenance")
+	}
+	if a, r := m.freshness(productCode); r != "" {
+		stronger(a, r)
+	}
+	if ps, ok := m.states[productCode]; ok {
+		stronger(m.Policy.Health[ps.state.Health], "health is "+ps.state.Health)
+		stronger(m.Policy.State[ps.state.State], "state is "+ps.state.State)
+	}
+	return action, reason
+}
+
+// freshness returns the action and its reason if the cached state of product is unknown or stale,
+// otherwise the reason is empty. m.mu must be held.
+func (m *HealthMonitor) freshness(productCode string) (GateAction, string) {
+	ps, ok := m.states[productCode]
+	if !ok {
+		return m.Policy.Unknown, "state is unknown"
+	}
+	maxAge := m.Policy.MaxAge
+	if maxAge == 0 {
+		maxAge = 3 * m.Interval
+	}
+	if age := m.now().Sub(ps.polledAt); maxAge > 0 && age > maxAge {
+		return m.Policy.Stale, fmt.Sprintf("state is stale for %v", age)
+	}
+	return GateAllow, ""
+}
+
+// logger returns the logger of Bitflyer.
+func (m *HealthMonitor) logger() LeveledLogger {
+	if m.bf == nil {
+		return loggerOf(nil)
+	}
+	return m.bf.logger()
+}
+
+// Admit returns nil if the order of product is allowed, or ErrOrderGated if it's rejected.
+//
+// If the action is GateDelay, it waits for the change of state up to Policy.MaxDelay.
+// The order allowed even though the state is unknown or stale is logged as warning.
+func (m *HealthMonitor) Admit(productCode string) error {
+	deadline := m.now().Add(m.Policy.MaxDelay)
+	for {
+		m.mu.Lock()
+		action, reason := m.check(productCode)
+		_, warning := m.freshness(productCode)
+		changed := m.changed
+		m.mu.Unlock()
+
+		switch action {
+		case GateAllow:
+			if warning != "" {
+				m.logger().Warn("order is admitted without the latest board state", "product_code", productCode, "reason", warning)
+			}
+			return nil
+		case GateReject:
+			return fmt.Errorf("%w: %v %v", ErrOrderGated, productCode, reason)
+		}
+
+		wait := deadline.Sub(m.now())
+		if wait <= 0 {
+			return fmt.Errorf("%w: %v %v for %v", ErrOrderGated, productCode, reason, m.Policy.MaxDelay)
+		}
+		if wait > m.Interval && m.Interval > 0 {
+			wait = m.Interval
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-changed:
+		case <-timer.C:
+		}
+		timer.Stop()
+	}
+}
@@ -0,0 +1,230 @@
+package bitflyergo
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestInMaintenance(t *testing.T) {
+	cases := []struct {
+		t        time.Time
+		expected bool
+	}{
+		{time.Date(2019, 10, 16, 19, 0, 0, 0, time.UTC), true},    // 04:00 JST
+		{time.Date(2019, 10, 16, 19, 9, 59, 0, time.UTC), true},   // 04:09:59 JST
+		{time.Date(2019, 10, 16, 19, 10, 0, 0, time.UTC), false},  // 04:10 JST
+		{time.Date(2019, 10, 16, 18, 59, 59, 0, time.UTC), false}, // 03:59:59 JST
+		{time.Date(2019, 10, 16, 4, 5, 0, 0, time.UTC), false},    // 13:05 JST
+	}
+	for _, c := range cases {
+		if actual := InMaintenance(c.t); actual != c.expected {
+			t.Errorf("InMaintenance(%v) = %v, expected %v", c.t, actual, c.expected)
+		}
+	}
+}
+
+func newTestHealthMonitor() *HealthMonitor {
+	m := NewHealthMonitor(nil, []string{productCode}, 10*time.Millisecond)
+	m.now = func() time.Time { return time.Date(2019, 10, 16, 12, 0, 0, 0, time.UTC) }
+	return m
+}
+
+func TestHealthMonitorPoll(t *testing.T) {
+	var health atomic.Value
+	health.Store(HealthNormal)
+	bf, server := newTestBitflyer(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1"+PathGetBoardState || r.URL.Query().Get("product_code") != productCode {
+			t.Errorf("unexpected request: %v", r.URL)
+		}
+		fmt.Fprintf(w, `{"health":"%v","state":"RUNNING"}`, health.Load())
+	})
+	defer server.Close()
+
+	var changes []string
+	m := NewHealthMonitor(bf, []string{productCode}, time.Second)
+	m.OnChange = func(productCode string, previous BoardState, current BoardState) {
+		changes = append(changes, previous.Health+"->"+current.Health)
+	}
+	if _, ok := m.State(productCode); ok {
+		t.Errorf("state exists before polling")
+	}
+	if err := m.Poll(); err != nil {
+		t.Fatal(err)
+	}
+	health.Store(HealthStop)
+	if err := m.Poll(); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Poll(); err != nil {
+		t.Fatal(err)
+	}
+	if s, _ := m.State(productCode); s.Health != HealthStop {
+		t.Errorf("unexpected health: %v", s.Health)
+	}
+	if len(changes) != 1 || changes[0] != "NORMAL->STOP" {
+		t.Errorf("unexpected changes: %v", changes)
+	}
+}
+
+func TestHealthMonitorPollError(t *testing.T) {
+	bf, server := newTestBitflyer(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("product_code") == "BTC_JPY" {
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprint(w, `{"status":-500,"error_message":"error"}`)
+			return
+		}
+		fmt.Fprint(w, `{"health":"NORMAL","state":"RUNNING"}`)
+	})
+	defer server.Close()
+
+	m := NewHealthMonitor(bf, []string{"BTC_JPY", productCode}, time.Second)
+	err := m.Poll()
+	var pollErr *PollError
+	if !errors.As(err, &pollErr) || len(pollErr.Errors) != 1 || pollErr.Errors["BTC_JPY"] == nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok := m.State(productCode); !ok {
+		t.Errorf("product after the failed one must be polled")
+	}
+}
+
+func TestHealthMonitorCheck(t *testing.T) {
+	m := newTestHealthMonitor()
+	if a, reason := m.Check(productCode); a != GateDelay || reason != "state is unknown" {
+		t.Errorf("unknown state must be delayed: %v (%v)", a, reason)
+	}
+	cases := []struct {
+		health   string
+		state    string
+		expected GateAction
+	}{
+		{HealthNormal, StateRunning, GateAllow},
+		{HealthBusy, StateRunning, GateAllow},
+		{HealthSuperBusy, StateRunning, GateDelay},
+		{HealthStop, StateRunning, GateReject},
+		{HealthSuperBusy, StateCircuitBreak, GateReject},
+	}
+	for _, c := range cases {
+		m.Update(productCode, BoardState{Health: c.health, State: c.state})
+		if a, reason := m.Check(productCode); a != c.expected {
+			t.Errorf("%v/%v: expected %v, actual %v (%v)", c.health, c.state, c.expected, a, reason)
+		}
+	}
+
+	// stale state
+	m.Update(productCode, BoardState{Health: HealthNormal, State: StateRunning})
+	if polledAt, ok := m.PolledAt(productCode); !ok || !polledAt.Equal(m.now()) {
+		t.Errorf("unexpected polled time: %v", polledAt)
+	}
+	m.now = func() time.Time { return time.Date(2019, 10, 16, 12, 0, 1, 0, time.UTC) }
+	if a, _ := m.Check(productCode); a != GateDelay {
+		t.Errorf("stale state must be delayed: %v", a)
+	}
+	m.Policy.MaxAge = time.Minute
+	if a, _ := m.Check(productCode); a != GateAllow {
+		t.Errorf("state within MaxAge must be allowed: %v", a)
+	}
+
+	m.now = func() time.Time { return time.Date(2019, 10, 16, 19, 5, 0, 0, time.UTC) }
+	if a, reason := m.Check(productCode); a != GateReject || reason != "maintenance" {
+		t.Errorf("unexpected action in maintenance: %v (%v)", a, reason)
+	}
+}
+
+func TestHealthMonitorAdmit(t *testing.T) {
+	m := newTestHealthMonitor()
+	m.now = time.Now
+	m.Policy.MaxDelay = time.Second
+
+	m.Update(productCode, BoardState{Health: HealthStop, State: StateRunning})
+	if err := m.Admit(productCode); !errors.Is(err, ErrOrderGated) {
+		t.Errorf("expected ErrOrderGated: %v", err)
+	}
+
+	// delayed order is sent when health recovers
+	m.Update(productCode, BoardState{Health: HealthSuperBusy, State: StateRunning})
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		m.Update(productCode, BoardState{Health: HealthBusy, State: StateRunning})
+	}()
+	started := time.Now()
+	if err := m.Admit(productCode); err != nil {
+		t.Errorf("delayed order was not admitted: %v", err)
+	}
+	if elapsed := time.Since(started); elapsed < 40*time.Millisecond {
+		t.Errorf("order was not delayed: %v", elapsed)
+	}
+
+	// delayed order is rejected after MaxDelay
+	m.Policy.MaxDelay = 50 * time.Millisecond
+	m.Update(productCode, BoardState{Health: HealthSuperBusy, State: StateRunning})
+	if err := m.Admit(productCode); !errors.Is(err, ErrOrderGated) {
+		t.Errorf("expected ErrOrderGated: %v", err)
+	}
+}
+
+func TestPlaceChildOrderWithOrderGate(t *testing.T) {
+	var called int32
+	bf, server := newTestBitflyer(t, func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&called, 1)
+		fmt.Fprint(w, `{"child_order_acceptance_id":"JRF20150707-050237-639234"}`)
+	})
+	defer server.Close()
+
+	m := newTestHealthMonitor()
+	bf.OrderGate = m
+	req := &ChildOrderRequest{
+		ProductCode:    productCode,
+		ChildOrderType: ChildOrderTypeMarket,
+		Side:           SideBuy,
+		Size:           MustParseDecimal("0.01"),
+	}
+
+	m.Update(productCode, BoardState{Health: HealthStop, State: StateRunning})
+	if _, err := bf.PlaceChildOrder(req); !errors.Is(err, ErrOrderGated) {
+		t.Errorf("expected ErrOrderGated: %v", err)
+	}
+	if atomic.LoadInt32(&called) != 0 {
+		t.Errorf("rejected order was sent")
+	}
+
+	m.Update(productCode, BoardState{Health: HealthNormal, State: StateRunning})
+	if _, err := bf.PlaceChildOrder(req); err != nil {
+		t.Errorf("order was not sent: %v", err)
+	}
+	if atomic.LoadInt32(&called) != 1 {
+		t.Errorf("order was not sent")
+	}
+}
+
+func TestHealthMonitorAdmitStale(t *testing.T) {
+	m := newTestHealthMonitor()
+	m.now = time.Now
+	m.Policy.MaxDelay = 50 * time.Millisecond
+
+	// unknown state is delayed until it's polled
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		m.Update(productCode, BoardState{Health: HealthNormal, State: StateRunning})
+	}()
+	if err := m.Admit(productCode); err != nil {
+		t.Errorf("order was not admitted after polling: %v", err)
+	}
+
+	// stale state is rejected after MaxDelay
+	m.Policy.MaxAge = 10 * time.Millisecond
+	time.Sleep(20 * time.Millisecond)
+	if err := m.Admit(productCode); !errors.Is(err, ErrOrderGated) {
+		t.Errorf("expected ErrOrderGated: %v", err)
+	}
+
+	// allowed by policy
+	m.Policy.Stale = GateAllow
+	if err := m.Admit(productCode); err != nil {
+		t.Errorf("stale state must be allowed by policy: %v", err)
+	}
+}
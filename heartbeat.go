@@ -0,0 +1,228 @@
+package bitflyergo
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Defaults of the heartbeat of WebSocketClient.
+//
+// Pings and the read timeout are disabled unless PingInterval and ReadTimeout are set,
+// e.g. to DefaultPingInterval and DefaultReadTimeout.
+const (
+	DefaultPingInterval      = 15 * time.Second // recommended interval of pings
+	DefaultReadTimeout       = 60 * time.Second // recommended time to wait for a message or a pong
+	DefaultWriteTimeout      = 10 * time.Second // time to wait for writing a message
+	DefaultReconnectInterval = time.Second      // interval of reconnecting
+	DefaultReauthTimeout     = 10 * time.Second // time to wait for the result of authentication after reconnecting
+)
+
+// StaleCallback is the optional interface of Callback to be notified of stale channels.
+type StaleCallback interface {
+
+	// OnStale is called when nothing is received from the channel for elapsed.
+	// It's called once until the channel receives a message again.
+	OnStale(channelName string, elapsed time.Duration)
+}
+
+// OnStale calls OnStale of the callbacks implementing StaleCallback.
+func (cbs MultiCallback) OnStale(channelName string, elapsed time.Duration) {
+	for _, cb := range cbs {
+		if cb, ok := cb.(StaleCallback); ok {
+			cb.OnStale(channelName, elapsed)
+		}
+	}
+}
+
+// feedState is the state of the subscribed channels.
+type feedState struct {
+	mu       sync.Mutex
+	channels map[string]time.Time // subscribed channel and the time when it received the last message
+	stale    map[string]bool      // channels notified as stale
+}
+
+// subscribed adds channel to the subscribed channels.
+func (s *feedState) subscribed(channel string, now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.channels == nil {
+		s.channels = map[string]time.Time{}
+		s.stale = map[string]bool{}
+	}
+	s.channels[channel] = now
+	delete(s.stale, channel)
+}
+
+// unsubscribed removes channel from the subscribed channels.
+func (s *feedState) unsubscribed(channel string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.channels, channel)
+	delete(s.stale, channel)
+}
+
+// received updates the time when channel received the last message.
+func (s *feedState) received(channel string, now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.channels[channel]; ok {
+		s.channels[channel] = now
+		delete(s.stale, channel)
+	}
+}
+
+// reset restarts the timers of all channels, e.g. after reconnecting.
+func (s *feedState) reset(now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for ch := range s.channels {
+		s.channels[ch] = now
+	}
+	s.stale = map[string]bool{}
+}
+
+// list returns the subscribed channels.
+func (s *feedState) list() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var channels []string
+	for ch := range s.channels {
+		channels = append(channels, ch)
+	}
+	return channels
+}
+
+// expired returns the channels which became stale at now and their elapsed time.
+func (s *feedState) expired(now time.Time, timeout func(channel string) time.Duration) map[string]time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var expired map[string]time.Duration
+	for ch, last := range s.channels {
+		t := timeout(ch)
+		if t <= 0 || s.stale[ch] || now.Sub(last) < t {
+			continue
+		}
+		if expired == nil {
+			expired = map[string]time.Duration{}
+		}
+		expired[ch] = now.Sub(last)
+		s.stale[ch] = true
+	}
+	return expired
+}
+
+// durationOr returns d if it's positive, def if it's zero, and zero if it's negative.
+func durationOr(d time.Duration, def time.Duration) time.Duration {
+	if d == 0 {
+		return def
+	}
+	if d < 0 {
+		return 0
+	}
+	return d
+}
+
+// staleTimeout returns the stale timeout of channel. StaleTimeouts is looked up by the channel name,
+// and then by the longest prefix of it.
+func (bf *WebSocketClient) staleTimeout(channel string) time.Duration {
+	if t, ok := bf.StaleTimeouts[channel]; ok {
+		return t
+	}
+	var timeout time.Duration
+	var matched int
+	for prefix, t := range bf.StaleTimeouts {
+		if len(prefix) > matched && strings.HasPrefix(channel, prefix) {
+			timeout, matched = t, len(prefix)
+		}
+	}
+	return timeout
+}
+
+// staleCheckInterval returns the interval to check stale channels, or zero if no timeout is set.
+func (bf *WebSocketClient) staleCheckInterval() time.Duration {
+	var min time.Duration
+	for _, t := range bf.StaleTimeouts {
+		if t > 0 && (min == 0 || t < min) {
+			min = t
+		}
+	}
+	interval := min / 4
+	if min > 0 && interval < 10*time.Millisecond {
+		interval = 10 * time.Millisecond
+	}
+	return interval
+}
+
+// heartbeat extends the read deadline of con on every pong and sends pings until done is closed.
+func (bf *WebSocketClient) heartbeat(con *websocket.Conn, done <-chan struct{}) {
+	readTimeout := bf.ReadTimeout
+	if readTimeout > 0 {
+		con.SetReadDeadline(time.Now().Add(readTimeout))
+		con.SetPongHandler(func(string) error {
+			return con.SetReadDeadline(time.Now().Add(readTimeout))
+		})
+	}
+
+	interval := bf.PingInterval
+	if interval <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if err := con.WriteControl(websocket.PingMessage, nil, bf.writeDeadline()); err != nil {
+					bf.logger().Warn("failed to send ping", "error", err)
+					return
+				}
+			}
+		}
+	}()
+}
+
+// writeDeadline returns the deadline of the write starting now.
+func (bf *WebSocketClient) writeDeadline() time.Time {
+	if timeout := durationOr(bf.WriteTimeout, DefaultWriteTimeout); timeout > 0 {
+		return time.Now().Add(timeout)
+	}
+	return time.Time{}
+}
+
+// watchStale checks the subscribed channels until done is closed.
+// Stale channels are notified to Cb if it implements StaleCallback,
+// and con is closed to reconnect if Reconnect is true.
+func (bf *WebSocketClient) watchStale(con *websocket.Conn, done <-chan struct{}) {
+	interval := bf.staleCheckInterval()
+	if interval <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case now := <-ticker.C:
+				expired := bf.feeds.expired(now, bf.staleTimeout)
+				for ch, elapsed := range expired {
+					bf.logger().Warn("channel is stale", "channel", ch, "elapsed", elapsed)
+					if cb, ok := bf.Cb.(StaleCallback); ok {
+						cb.OnStale(ch, elapsed)
+					}
+				}
+				if len(expired) > 0 && bf.Reconnect {
+					con.Close()
+					return
+				}
+			}
+		}
+	}()
+}
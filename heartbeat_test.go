@@ -0,0 +1,236 @@
+package bitflyergo
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// readAll reads messages from con until it fails and calls fn for each message.
+func readAll(con *websocket.Conn, fn func(data []byte)) {
+	for {
+		_, data, err := con.ReadMessage()
+		if err != nil {
+			return
+		}
+		if fn != nil {
+			fn(data)
+		}
+	}
+}
+
+// staleCallback stores stale channels.
+type staleCallback struct {
+	NopCallback
+	mu    sync.Mutex
+	stale []string
+}
+
+func (c *staleCallback) OnStale(channelName string, elapsed time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.stale = append(c.stale, channelName)
+}
+
+func (c *staleCallback) staleChannels() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]string(nil), c.stale...)
+}
+
+func TestReadTimeout(t *testing.T) {
+	stop := make(chan struct{})
+	endpoint, closeServer := newTestWebSocketServer(t, func(con *websocket.Conn) {
+		<-stop // never reads, so pings aren't answered
+	})
+	defer closeServer()
+	defer close(stop)
+
+	ws := &WebSocketClient{Cb: NopCallback{}, ReadTimeout: 100 * time.Millisecond, EndpointUrl: endpoint}
+	ws.Logger = NewStdLogger(nil)
+	ws.Logger.(*StdLogger).Level = LevelError + 1
+	if err := ws.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	started := time.Now()
+	ws.Receive()
+	if elapsed := time.Since(started); elapsed < 100*time.Millisecond || elapsed > time.Second {
+		t.Errorf("elapsed: %v", elapsed)
+	}
+}
+
+func TestPingKeepsAlive(t *testing.T) {
+	endpoint, closeServer := newTestWebSocketServer(t, func(con *websocket.Conn) {
+		readAll(con, nil) // answers pings
+	})
+	defer closeServer()
+
+	ws := &WebSocketClient{
+		Cb:           NopCallback{},
+		PingInterval: 20 * time.Millisecond,
+		ReadTimeout:  100 * time.Millisecond,
+		EndpointUrl:  endpoint,
+	}
+	ws.Logger = NewStdLogger(nil)
+	ws.Logger.(*StdLogger).Level = LevelError + 1
+	if err := ws.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan struct{})
+	go func() {
+		ws.Receive()
+		close(done)
+	}()
+	select {
+	case <-done:
+		t.Fatal("Receive returned while pongs are received")
+	case <-time.After(300 * time.Millisecond):
+	}
+	ws.Con.Close()
+	<-done
+}
+
+func TestStaleChannel(t *testing.T) {
+	endpoint, closeServer := newTestWebSocketServer(t, func(con *websocket.Conn) {
+		con.WriteMessage(websocket.TextMessage, []byte(testExecutionsMessage))
+		readAll(con, nil)
+	})
+	defer closeServer()
+
+	cb := &staleCallback{}
+	ws := &WebSocketClient{
+		Cb:            cb,
+		StaleTimeouts: map[string]time.Duration{channelExecutions: 100 * time.Millisecond},
+		EndpointUrl:   endpoint,
+	}
+	ws.Logger = NewStdLogger(nil)
+	ws.Logger.(*StdLogger).Level = LevelError + 1
+	if err := ws.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	ws.SubscribeExecutions(ProductCodeFxBtcJpy)
+	ws.SubscribeTicker(ProductCodeFxBtcJpy) // no timeout
+	done := make(chan struct{})
+	go func() {
+		ws.Receive()
+		close(done)
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	if stale := cb.staleChannels(); len(stale) != 0 {
+		t.Errorf("stale before timeout: %v", stale)
+	}
+	time.Sleep(200 * time.Millisecond)
+	if stale := cb.staleChannels(); len(stale) != 1 || stale[0] != channelExecutions+ProductCodeFxBtcJpy {
+		t.Errorf("stale: %v", stale)
+	}
+	ws.Con.Close()
+	<-done
+}
+
+func TestReconnectOnStale(t *testing.T) {
+	var mu sync.Mutex
+	var connections int
+	subscribed := make(chan string, 10)
+	endpoint, closeServer := newTestWebSocketServer(t, func(con *websocket.Conn) {
+		mu.Lock()
+		connections++
+		mu.Unlock()
+		readAll(con, func(data []byte) {
+			subscribed <- string(data)
+		})
+	})
+	defer closeServer()
+
+	ws := &WebSocketClient{
+		Cb:                NopCallback{},
+		StaleTimeouts:     map[string]time.Duration{channelExecutions: 50 * time.Millisecond},
+		Reconnect:         true,
+		ReconnectInterval: 10 * time.Millisecond,
+		EndpointUrl:       endpoint,
+	}
+	ws.Logger = NewStdLogger(nil)
+	ws.Logger.(*StdLogger).Level = LevelError + 1
+	if err := ws.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	ws.SubscribeExecutions(ProductCodeFxBtcJpy)
+	go ws.Receive()
+
+	for i := 0; i < 2; i++ {
+		select {
+		case msg := <-subscribed:
+			if !strings.Contains(msg, `"subscribe"`) || !strings.Contains(msg, channelExecutions+ProductCodeFxBtcJpy) {
+				t.Errorf("unexpected message: %v", msg)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("not subscribed again")
+		}
+	}
+	if err := ws.Close(context.Background()); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if connections < 2 {
+		t.Errorf("connections: %v", connections)
+	}
+}
+
+func TestStaleTimeout(t *testing.T) {
+	ws := &WebSocketClient{StaleTimeouts: map[string]time.Duration{
+		"lightning_":                     time.Minute,
+		channelExecutions:                30 * time.Second,
+		channelExecutions + "FX_BTC_JPY": 10 * time.Second,
+	}}
+	for ch, expected := range map[string]time.Duration{
+		channelExecutions + "FX_BTC_JPY": 10 * time.Second,
+		channelExecutions + "BTC_JPY":    30 * time.Second,
+		channelTicker + "BTC_JPY":        time.Minute,
+		channelChildOrder:                0,
+	} {
+		if actual := ws.staleTimeout(ch); actual != expected {
+			t.Errorf("%v: expected=%v, actual=%v", ch, expected, actual)
+		}
+	}
+}
+
+func TestHeartbeatDisabledByDefault(t *testing.T) {
+	pinged := make(chan struct{}, 1)
+	stop := make(chan struct{})
+	endpoint, closeServer := newTestWebSocketServer(t, func(con *websocket.Conn) {
+		con.SetPingHandler(func(string) error {
+			pinged <- struct{}{}
+			return nil
+		})
+		go readAll(con, nil)
+		<-stop
+	})
+	defer closeServer()
+	defer close(stop)
+
+	ws := &WebSocketClient{Cb: NopCallback{}, EndpointUrl: endpoint}
+	ws.Logger = NewStdLogger(nil)
+	ws.Logger.(*StdLogger).Level = LevelError + 1
+	if err := ws.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan struct{})
+	go func() {
+		ws.Receive()
+		close(done)
+	}()
+	select {
+	case <-done:
+		t.Fatal("Receive returned without ReadTimeout")
+	case <-pinged:
+		t.Fatal("ping is sent without PingInterval")
+	case <-time.After(200 * time.Millisecond):
+	}
+	ws.Con.Close()
+	<-done
+}
@@ -0,0 +1,93 @@
+package bitflyergo
+
+import (
+	"encoding/json"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// Kinds of records of Journal.
+const (
+	JournalSendChildOrder       = "send_child_order"        // SendChildOrder and PlaceChildOrder
+	JournalCancelChildOrder     = "cancel_child_order"      // CancelChildOrder and CancelChildOrderByID
+	JournalCancelAllChildOrders = "cancel_all_child_orders" // CancelAllChildOrders
+	JournalSendParentOrder      = "send_parent_order"       // SendParentOrder
+	JournalCancelParentOrder    = "cancel_parent_order"     // CancelParentOrder
+	JournalChildOrderEvent      = "child_order_event"       // ChildOrderEvent received from websocket
+)
+
+// Phases of OrderAction.
+const (
+	ActionIntent = "intent" // recorded before the request is sent
+	ActionResult = "result" // recorded after the response is received
+)
+
+// Journal records order actions and events, e.g. journal.Writer.
+type Journal interface {
+
+	// Record appends data of kind. data is encoded as JSON.
+	Record(kind string, data interface{}) error
+}
+
+// OrderAction is the order action recorded in Journal.
+//
+// Each action is recorded twice: the intent before the request is sent, and the result after it.
+// The result has the same Id as the intent, so that the intent without result shows
+// the request whose result is unknown, e.g. because the process crashed.
+type OrderAction struct {
+	Id       string        `json:"id"`                 // id shared by the intent and the result
+	Phase    string        `json:"phase"`              // ActionIntent or ActionResult
+	Request  interface{}   `json:"request,omitempty"`  // request, only in the intent
+	Response interface{}   `json:"response,omitempty"` // response body of the exchange, only in the result
+	Error    string        `json:"error,omitempty"`    // error, only in the result
+	SentAt   time.Time     `json:"sent_at"`            // sent_at
+	Latency  time.Duration `json:"latency,omitempty"`  // latency in nanoseconds, only in the result
+}
+
+// actionSeq is the sequence to make the ids of actions unique.
+var actionSeq uint64
+
+// beginAction records the intent of the order action to Journal if it's set, and returns the action.
+// The request must not be sent if it returns error, because the action couldn't be recorded.
+func (bf *Bitflyer) beginAction(kind string, request interface{}) (*OrderAction, error) {
+	sentAt := time.Now()
+	action := &OrderAction{
+		Id:     strconv.FormatInt(sentAt.UnixNano(), 36) + "-" + strconv.FormatUint(atomic.AddUint64(&actionSeq, 1), 36),
+		Phase:  ActionIntent,
+		SentAt: sentAt,
+	}
+	if bf.Journal == nil {
+		return action, nil
+	}
+	intent := *action
+	intent.Request = request
+	if err := bf.Journal.Record(kind, &intent); err != nil {
+		bf.logger().Error("failed to record journal", "kind", kind, "error", err)
+		return nil, err
+	}
+	return action, nil
+}
+
+// endAction records the result of the order action to Journal if it's set.
+// res is the response body, which is recorded as a string if it isn't JSON, e.g. empty.
+// The order has already been sent, so the failure of the journal is only logged.
+func (bf *Bitflyer) endAction(kind string, action *OrderAction, res []byte, err error) {
+	if bf.Journal == nil {
+		return
+	}
+	result := &OrderAction{Id: action.Id, Phase: ActionResult, SentAt: action.SentAt, Latency: time.Since(action.SentAt)}
+	if res != nil {
+		if json.Valid(res) {
+			result.Response = json.RawMessage(res)
+		} else {
+			result.Response = string(res)
+		}
+	}
+	if err != nil {
+		result.Error = err.Error()
+	}
+	if err := bf.Journal.Record(kind, result); err != nil {
+		bf.logger().Error("failed to record journal", "kind", kind, "error", err)
+	}
+}
@@ -0,0 +1,326 @@
+// Package journal provides the append-only, tamper-evident journal of order actions.
+//
+// Each record is a line of JSON such as
+//
+//	{"seq":1,"time":"2019-10-16T14:58:22.39Z","kind":"send_child_order","data":{...},"prev":"...","hash":"..."}
+//
+// where hash is the SHA-256 of the line before ,"hash" and prev is the hash of the previous record,
+// so that modifying, removing or reordering records breaks the chain detected by Verify.
+// Files are rotated by size or date, and the chain continues across files.
+package journal
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mitsutoshi/bitflyergo"
+)
+
+// Ext is the extension of journal files.
+const Ext = ".jsonl"
+
+// genesis is prev of the first record.
+var genesis = strings.Repeat("0", sha256.Size*2)
+
+// ErrBroken is returned by Writer.Record after a partly written record couldn't be removed.
+// Open the journal again to truncate the torn record.
+var ErrBroken = errors.New("journal is broken by a torn record")
+
+// file is the file written by Writer. *os.File implements it.
+type file interface {
+	io.Writer
+	Sync() error
+	Truncate(size int64) error
+	Close() error
+}
+
+// Config is the configuration of Writer.
+type Config struct {
+	Prefix   string         // prefix of file names. "journal" if blank
+	MaxSize  int64          // rotates the file when its size exceeds it. zero means no limit
+	Daily    bool           // rotates the file when the date changes
+	Location *time.Location // location of the date. UTC if nil
+	Sync     bool           // syncs the file after every record
+}
+
+// Record is a record of the journal.
+type Record struct {
+	Seq  uint64          `json:"seq"`  // sequence number starting at 1
+	Time time.Time       `json:"time"` // time when it's recorded
+	Kind string          `json:"kind"` // kind such as bitflyergo.JournalSendChildOrder
+	Data json.RawMessage `json:"data"` // data
+	Prev string          `json:"prev"` // hash of the previous record
+	Hash string          `json:"hash"` // hash of this record
+}
+
+// Writer appends records to the files in a directory. It implements bitflyergo.Journal.
+type Writer struct {
+	dir    string
+	config Config
+	now    func() time.Time
+
+	mu     sync.Mutex
+	file   file
+	name   string
+	size   int64
+	date   string
+	seq    uint64
+	prev   string
+	broken error // set when the torn record couldn't be truncated
+}
+
+// Open opens the journal in dir, continuing the chain of the existing files.
+func Open(dir string, config Config) (*Writer, error) {
+	if config.Prefix == "" {
+		config.Prefix = "journal"
+	}
+	if config.Location == nil {
+		config.Location = time.UTC
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	w := &Writer{dir: dir, config: config, now: time.Now, prev: genesis}
+
+	files, err := Files(dir, config.Prefix)
+	if err != nil {
+		return nil, err
+	}
+	if len(files) > 0 {
+		last, err := lastRecord(dir, files)
+		if err != nil {
+			return nil, err
+		}
+		if last != nil {
+			w.seq, w.prev = last.Seq, last.Hash
+		}
+		w.name = files[len(files)-1]
+	}
+	return w, nil
+}
+
+// Record appends data of kind.
+//
+// If the record can't be written or synced, it's truncated from the file so that the next record
+// isn't appended to the torn line. If the truncation fails, Record returns ErrBroken after that.
+func (w *Writer) Record(kind string, data interface{}) error {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.broken != nil {
+		return w.broken
+	}
+	now := w.now()
+	line, hash, err := encode(Record{Seq: w.seq + 1, Time: now, Kind: kind, Data: raw, Prev: w.prev})
+	if err != nil {
+		return err
+	}
+	if err := w.rotate(now, int64(len(line))); err != nil {
+		return err
+	}
+	n, err := w.file.Write(line)
+	if err == nil && w.config.Sync {
+		err = w.file.Sync()
+	}
+	if err != nil {
+		if n > 0 {
+			if terr := w.file.Truncate(w.size); terr != nil {
+				w.broken = fmt.Errorf("%w: %v: %v", ErrBroken, w.name, terr)
+			}
+		}
+		return err
+	}
+	w.size += int64(n)
+	w.seq++
+	w.prev = hash
+	return nil
+}
+
+// Checkpoint returns the seq and the hash of the last record.
+// Keep it outside of the journal to detect the truncation by VerifyCheckpoint.
+func (w *Writer) Checkpoint() Checkpoint {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return Checkpoint{Seq: w.seq, Hash: w.prev}
+}
+
+// Close closes the current file.
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.file == nil {
+		return nil
+	}
+	err := w.file.Close()
+	w.file = nil
+	return err
+}
+
+// rotate opens the file to append the line of size. w.mu must be held.
+func (w *Writer) rotate(now time.Time, size int64) error {
+	date := now.In(w.config.Location).Format("20060102")
+	if w.file == nil && w.name != "" {
+		if err := w.open(w.name); err != nil {
+			return err
+		}
+	}
+	if date < w.date {
+		date = w.date // the clock went back
+	}
+	needed := w.file == nil ||
+		(w.config.Daily && w.date != date) ||
+		(w.config.MaxSize > 0 && w.size > 0 && w.size+size > w.config.MaxSize)
+	if !needed {
+		return nil
+	}
+	if w.file != nil {
+		if err := w.file.Close(); err != nil {
+			return err
+		}
+		w.file = nil
+	}
+	for i := 0; ; i++ {
+		name := fmt.Sprintf("%s-%s-%04d%s", w.config.Prefix, date, i, Ext)
+		if name <= w.name {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(w.dir, name)); err == nil {
+			continue
+		}
+		return w.open(name)
+	}
+}
+
+// open opens the file to append. w.mu must be held.
+func (w *Writer) open(name string) error {
+	f, err := os.OpenFile(filepath.Join(w.dir, name), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	w.file, w.name, w.size = f, name, info.Size()
+	w.date = strings.TrimSuffix(strings.TrimPrefix(name, w.config.Prefix+"-"), Ext)
+	if i := strings.Index(w.date, "-"); i >= 0 {
+		w.date = w.date[:i]
+	}
+	return nil
+}
+
+// encode returns the line of r and its hash. r.Hash is ignored.
+func encode(r Record) ([]byte, string, error) {
+	b, err := json.Marshal(struct {
+		Seq  uint64          `json:"seq"`
+		Time time.Time       `json:"time"`
+		Kind string          `json:"kind"`
+		Data json.RawMessage `json:"data"`
+		Prev string          `json:"prev"`
+	}{r.Seq, r.Time, r.Kind, r.Data, r.Prev})
+	if err != nil {
+		return nil, "", err
+	}
+	sum := sha256.Sum256(b)
+	hash := hex.EncodeToString(sum[:])
+	line := append(b[:len(b)-1], `,"hash":"`+hash+`"}`+"\n"...)
+	return line, hash, nil
+}
+
+// Files returns the names of journal files of prefix in dir in order.
+func Files(dir string, prefix string) ([]string, error) {
+	if prefix == "" {
+		prefix = "journal"
+	}
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, e := range entries {
+		if !e.IsDir() && strings.HasPrefix(e.Name(), prefix+"-") && strings.HasSuffix(e.Name(), Ext) {
+			names = append(names, e.Name())
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// lastRecord returns the last record in files, or nil if they're empty.
+//
+// The line without the newline at the end of the last file was partly written when the process
+// crashed, so it's truncated and the record before it is returned.
+func lastRecord(dir string, files []string) (*Record, error) {
+	for i := len(files) - 1; i >= 0; i-- {
+		path := filepath.Join(dir, files[i])
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if n := bytes.LastIndexByte(data, '\n') + 1; n < len(data) && i == len(files)-1 {
+			if err := os.Truncate(path, int64(n)); err != nil {
+				return nil, fmt.Errorf("failed to truncate the torn record of %v: %w", files[i], err)
+			}
+			data = data[:n]
+		}
+		lines := bytes.Split(bytes.TrimRight(data, "\n"), []byte("\n"))
+		if len(lines[len(lines)-1]) == 0 {
+			continue
+		}
+		var r Record
+		if err := json.Unmarshal(lines[len(lines)-1], &r); err != nil {
+			return nil, fmt.Errorf("failed to parse the last record of %v: %w", files[i], err)
+		}
+		return &r, nil
+	}
+	return nil, nil
+}
+
+// read calls fn for each line of r with the line number.
+func read(r io.Reader, fn func(lineNo int, line []byte) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for n := 1; scanner.Scan(); n++ {
+		if err := fn(n, scanner.Bytes()); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// EventRecorder records child order events received from websocket.
+// Set it to WebSocketClient.Cb (combine with bitflyergo.MultiCallback if needed).
+type EventRecorder struct {
+	bitflyergo.NopCallback
+	Journal bitflyergo.Journal
+
+	// OnError is called when recording fails. It may be nil.
+	OnError func(err error)
+}
+
+// OnReceiveChildOrderEvents records each event.
+func (r *EventRecorder) OnReceiveChildOrderEvents(channelName string, events []bitflyergo.ChildOrderEvent) {
+	for i := range events {
+		if err := r.Journal.Record(bitflyergo.JournalChildOrderEvent, &events[i]); err != nil && r.OnError != nil {
+			r.OnError(err)
+		}
+	}
+}
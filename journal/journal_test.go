@@ -0,0 +1,270 @@
+package journal
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mitsutoshi/bitflyergo"
+)
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "journal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func writeRecords(t *testing.T, dir string, config Config, now time.Time, n int) *Writer {
+	w, err := Open(dir, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.now = func() time.Time { return now }
+	for i := 0; i < n; i++ {
+		if err := w.Record(bitflyergo.JournalCancelChildOrder, map[string]string{"product_code": "FX_BTC_JPY"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return w
+}
+
+func verify(t *testing.T, dir string) *Report {
+	report, err := Verify(dir, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return report
+}
+
+func TestWriterAndVerify(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	now := time.Date(2019, 10, 16, 12, 0, 0, 0, time.UTC)
+
+	w := writeRecords(t, dir, Config{MaxSize: 600}, now, 5)
+	w.Close()
+
+	// reopen continues the chain
+	w = writeRecords(t, dir, Config{MaxSize: 600}, now, 3)
+	w.Close()
+
+	files, _ := Files(dir, "")
+	if len(files) < 2 || files[0] != "journal-20191016-0000.jsonl" {
+		t.Errorf("files were not rotated: %v", files)
+	}
+	for _, name := range files {
+		if info, _ := os.Stat(filepath.Join(dir, name)); info.Size() > 600 {
+			t.Errorf("%v exceeds MaxSize: %v", name, info.Size())
+		}
+	}
+	report := verify(t, dir)
+	if !report.OK() || report.Records != 8 || report.LastSeq != 8 || report.Files != len(files) {
+		t.Errorf("unexpected report: %+v", report)
+	}
+}
+
+func TestDailyRotation(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	jst := time.FixedZone("JST", 9*60*60)
+	now := time.Date(2019, 10, 16, 14, 59, 0, 0, time.UTC)
+
+	w := writeRecords(t, dir, Config{Daily: true, Location: jst}, now, 1)
+	w.now = func() time.Time { return now.Add(2 * time.Minute) }
+	w.Record("test", nil)
+	w.Close()
+
+	files, _ := Files(dir, "")
+	if strings.Join(files, ",") != "journal-20191016-0000.jsonl,journal-20191017-0000.jsonl" {
+		t.Errorf("unexpected files: %v", files)
+	}
+	if report := verify(t, dir); !report.OK() || report.Records != 2 {
+		t.Errorf("unexpected report: %+v", report)
+	}
+}
+
+func tamper(t *testing.T, dir string, fn func(lines [][]byte) [][]byte) {
+	path := filepath.Join(dir, "journal-20191016-0000.jsonl")
+	data, _ := ioutil.ReadFile(path)
+	lines := bytes.Split(bytes.TrimRight(data, "\n"), []byte("\n"))
+	lines = fn(lines)
+	ioutil.WriteFile(path, append(bytes.Join(lines, []byte("\n")), '\n'), 0600)
+}
+
+func TestVerifyDetectsTampering(t *testing.T) {
+	cases := []struct {
+		name     string
+		fn       func(lines [][]byte) [][]byte
+		expected string
+	}{
+		{"modified", func(lines [][]byte) [][]byte {
+			lines[1] = bytes.Replace(lines[1], []byte("FX_BTC_JPY"), []byte("BTC_JPY"), 1)
+			return lines
+		}, "journal-20191016-0000.jsonl:2: record 2 was modified"},
+		{"removed", func(lines [][]byte) [][]byte {
+			return append(lines[:1], lines[2:]...)
+		}, "journal-20191016-0000.jsonl:2: records 2 to 2 are missing"},
+		{"swapped", func(lines [][]byte) [][]byte {
+			lines[1], lines[2] = lines[2], lines[1]
+			return lines
+		}, "journal-20191016-0000.jsonl:2: records 2 to 2 are missing"},
+		{"truncated", func(lines [][]byte) [][]byte {
+			lines[3] = lines[3][:20]
+			return lines
+		}, "journal-20191016-0000.jsonl:4: hash is not found"},
+	}
+	for _, c := range cases {
+		dir := tempDir(t)
+		w := writeRecords(t, dir, Config{}, time.Date(2019, 10, 16, 12, 0, 0, 0, time.UTC), 4)
+		w.Close()
+		tamper(t, dir, c.fn)
+		report := verify(t, dir)
+		if report.OK() || report.Problems[0].String() != c.expected {
+			t.Errorf("%v: unexpected problems: %v", c.name, report.Problems)
+		}
+		os.RemoveAll(dir)
+	}
+}
+
+func TestEventRecorder(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	w, err := Open(dir, Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := &EventRecorder{Journal: w}
+	r.OnReceiveChildOrderEvents("child_order_events", []bitflyergo.ChildOrderEvent{
+		{ChildOrderAcceptanceId: "a", EventType: bitflyergo.EventTypeOrder},
+		{ChildOrderAcceptanceId: "a", EventType: bitflyergo.EventTypeCancel},
+	})
+	w.Close()
+
+	files, _ := Files(dir, "")
+	data, _ := ioutil.ReadFile(filepath.Join(dir, files[0]))
+	if n := strings.Count(string(data), `"kind":"child_order_event"`); n != 2 {
+		t.Errorf("unexpected records: %v", string(data))
+	}
+}
+
+func TestVerifyCheckpoint(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	w := writeRecords(t, dir, Config{}, time.Date(2019, 10, 16, 12, 0, 0, 0, time.UTC), 4)
+	checkpoint := w.Checkpoint()
+	w.Close()
+	if checkpoint.Seq != 4 {
+		t.Fatalf("unexpected checkpoint: %+v", checkpoint)
+	}
+	report, err := VerifyCheckpoint(dir, "", checkpoint)
+	if err != nil || !report.OK() {
+		t.Fatalf("unexpected report: %+v, %v", report, err)
+	}
+
+	// removing the last records keeps the chain, but not the checkpoint
+	tamper(t, dir, func(lines [][]byte) [][]byte {
+		return lines[:2]
+	})
+	if report := verify(t, dir); !report.OK() {
+		t.Errorf("unexpected problems: %v", report.Problems)
+	}
+	report, err = VerifyCheckpoint(dir, "", checkpoint)
+	if err != nil || report.OK() || report.Problems[0].String() != "journal-20191016-0000.jsonl:2: records 3 to 4 are missing at the end" {
+		t.Errorf("unexpected report: %+v, %v", report, err)
+	}
+
+	// the record of the same seq isn't the one of the checkpoint
+	w = writeRecords(t, dir, Config{}, time.Date(2019, 10, 16, 13, 0, 0, 0, time.UTC), 2)
+	w.Close()
+	report, err = VerifyCheckpoint(dir, "", checkpoint)
+	if err != nil || report.OK() || report.Problems[0].String() != "journal-20191016-0000.jsonl:4: record 4 doesn't match the checkpoint" {
+		t.Errorf("unexpected report: %+v, %v", report, err)
+	}
+}
+
+func TestOpenTruncatesTornRecord(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	now := time.Date(2019, 10, 16, 12, 0, 0, 0, time.UTC)
+	w := writeRecords(t, dir, Config{}, now, 3)
+	w.Close()
+
+	// the process crashed while writing the 4th record
+	path := filepath.Join(dir, "journal-20191016-0000.jsonl")
+	f, _ := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0600)
+	f.Write([]byte(`{"seq":4,"time":"2019-10-16T12:00:00Z","ki`))
+	f.Close()
+
+	w = writeRecords(t, dir, Config{}, now, 1)
+	w.Close()
+	report := verify(t, dir)
+	if !report.OK() || report.Records != 4 || report.LastSeq != 4 {
+		t.Errorf("unexpected report: %+v", report)
+	}
+}
+
+// tornFile writes only the half of the line and fails.
+type tornFile struct {
+	file
+	truncateErr error
+}
+
+func (f *tornFile) Write(p []byte) (int, error) {
+	n, _ := f.file.Write(p[:len(p)/2])
+	return n, errors.New("disk full")
+}
+
+func (f *tornFile) Truncate(size int64) error {
+	if f.truncateErr != nil {
+		return f.truncateErr
+	}
+	return f.file.Truncate(size)
+}
+
+func TestRecordTruncatesTornWrite(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	now := time.Date(2019, 10, 16, 12, 0, 0, 0, time.UTC)
+	w := writeRecords(t, dir, Config{}, now, 2)
+
+	// the failed record is removed and the next one continues the chain
+	f := w.file
+	w.file = &tornFile{file: f}
+	if err := w.Record(bitflyergo.JournalCancelChildOrder, "x"); err == nil {
+		t.Fatal("error must be returned for the failed write.")
+	}
+	w.file = f
+	if err := w.Record(bitflyergo.JournalCancelChildOrder, "x"); err != nil {
+		t.Fatal(err)
+	}
+	report := verify(t, dir)
+	if !report.OK() || report.Records != 3 || report.LastSeq != 3 {
+		t.Errorf("unexpected report: %+v", report)
+	}
+
+	// the writer is broken if the torn record can't be removed
+	w.file = &tornFile{file: f, truncateErr: errors.New("io error")}
+	if err := w.Record(bitflyergo.JournalCancelChildOrder, "x"); err == nil {
+		t.Fatal("error must be returned for the failed write.")
+	}
+	w.file = f
+	if err := w.Record(bitflyergo.JournalCancelChildOrder, "x"); !errors.Is(err, ErrBroken) {
+		t.Fatalf("expected ErrBroken: %v", err)
+	}
+	w.Close()
+
+	// reopening truncates the torn record
+	w = writeRecords(t, dir, Config{}, now, 1)
+	w.Close()
+	report = verify(t, dir)
+	if !report.OK() || report.Records != 4 || report.LastSeq != 4 {
+		t.Errorf("unexpected report: %+v", report)
+	}
+}
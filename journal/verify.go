@@ -0,0 +1,136 @@
+package journal
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+)
+
+// hashSuffix matches the hash at the end of the line.
+var hashSuffix = regexp.MustCompile(`,"hash":"([0-9a-f]{64})"}$`)
+
+// Problem is the problem of the journal found by Verify.
+type Problem struct {
+	File    string // file name
+	Line    int    // line number
+	Message string // description
+}
+
+// String returns the location and the description.
+func (p Problem) String() string {
+	return fmt.Sprintf("%v:%v: %v", p.File, p.Line, p.Message)
+}
+
+// Report is the result of Verify.
+type Report struct {
+	Files    int       // number of files
+	Records  int       // number of records
+	LastSeq  uint64    // seq of the last record
+	LastHash string    // hash of the last record
+	Problems []Problem // problems found
+}
+
+// OK returns true if no problem is found.
+func (r *Report) OK() bool {
+	return len(r.Problems) == 0
+}
+
+// Checkpoint is the seq and the hash of a record, e.g. the result of Writer.Checkpoint.
+type Checkpoint struct {
+	Seq  uint64 // seq of the record
+	Hash string // hash of the record
+}
+
+// Verify checks that the records of the journal in dir are continuous and unmodified.
+//
+// It reports modified records whose hash doesn't match, gaps of seq and the broken chain of prev.
+// It continues after a problem to report all of them.
+// The records removed from the end can't be detected without the checkpoint. Use VerifyCheckpoint for them.
+func Verify(dir string, prefix string) (*Report, error) {
+	return verifyJournal(dir, prefix, nil)
+}
+
+// VerifyCheckpoint checks the journal like Verify, and also checks that it contains the record of checkpoint
+// kept outside of the journal, so that the records removed from the end are detected.
+func VerifyCheckpoint(dir string, prefix string, checkpoint Checkpoint) (*Report, error) {
+	return verifyJournal(dir, prefix, &checkpoint)
+}
+
+// verifyJournal verifies the journal, and the record of checkpoint if it's not nil.
+func verifyJournal(dir string, prefix string, checkpoint *Checkpoint) (*Report, error) {
+	files, err := Files(dir, prefix)
+	if err != nil {
+		return nil, err
+	}
+	report := &Report{Files: len(files), LastHash: genesis}
+	found := checkpoint == nil || checkpoint.Seq == 0
+	var lastFile string
+	var lastLine int
+	for _, name := range files {
+		f, err := os.Open(filepath.Join(dir, name))
+		if err != nil {
+			return nil, err
+		}
+		err = read(f, func(lineNo int, line []byte) error {
+			lastFile, lastLine = name, lineNo
+			problem := report.check(line)
+			if problem != "" {
+				report.Problems = append(report.Problems, Problem{File: name, Line: lineNo, Message: problem})
+			}
+			if checkpoint != nil && problem == "" && report.LastSeq == checkpoint.Seq {
+				found = true
+				if report.LastHash != checkpoint.Hash {
+					report.Problems = append(report.Problems, Problem{File: name, Line: lineNo,
+						Message: fmt.Sprintf("record %v doesn't match the checkpoint", checkpoint.Seq)})
+				}
+			}
+			return nil
+		})
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	if !found {
+		message := fmt.Sprintf("records %v to %v are missing at the end", report.LastSeq+1, checkpoint.Seq)
+		if report.LastSeq >= checkpoint.Seq {
+			message = fmt.Sprintf("record %v of the checkpoint is not found", checkpoint.Seq)
+		}
+		report.Problems = append(report.Problems, Problem{File: lastFile, Line: lastLine, Message: message})
+	}
+	return report, nil
+}
+
+// check checks the line following the last record and returns the problem if any.
+func (r *Report) check(line []byte) string {
+	m := hashSuffix.FindSubmatchIndex(line)
+	if m == nil {
+		return "hash is not found"
+	}
+	var rec Record
+	if err := json.Unmarshal(line, &rec); err != nil {
+		return fmt.Sprintf("failed to parse: %v", err)
+	}
+	r.Records++
+	expectedSeq, expectedPrev := r.LastSeq+1, r.LastHash
+	r.LastSeq, r.LastHash = rec.Seq, rec.Hash
+
+	payload := append(append([]byte{}, line[:m[0]]...), '}')
+	sum := sha256.Sum256(payload)
+	switch {
+	case !bytes.Equal(line[m[2]:m[3]], []byte(hex.EncodeToString(sum[:]))):
+		return fmt.Sprintf("record %v was modified", rec.Seq)
+	case rec.Seq > expectedSeq:
+		return fmt.Sprintf("records %v to %v are missing", expectedSeq, rec.Seq-1)
+	case rec.Seq < expectedSeq:
+		return fmt.Sprintf("record %v is duplicated or out of order, expected %v", rec.Seq, expectedSeq)
+	case rec.Prev != expectedPrev:
+		return fmt.Sprintf("record %v doesn't follow the previous record", rec.Seq)
+	}
+	return ""
+}
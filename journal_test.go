@@ -0,0 +1,118 @@
+package bitflyergo
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+type memJournal struct {
+	kinds   []string
+	actions []*OrderAction
+}
+
+func (j *memJournal) Record(kind string, data interface{}) error {
+	j.kinds = append(j.kinds, kind)
+	j.actions = append(j.actions, data.(*OrderAction))
+	return nil
+}
+
+func TestJournalRecordsOrderActions(t *testing.T) {
+	bf, server := newTestBitflyer(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1" + PathSendChildOrder:
+			fmt.Fprint(w, `{"child_order_acceptance_id":"JRF20150707-050237-639234"}`)
+		case "/v1" + PathCancelChildOrder:
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"status":-111,"error_message":"Order not found"}`)
+		case "/v1" + PathCancelAllChildOrders:
+			// empty body
+		default:
+			fmt.Fprint(w, `[]`)
+		}
+	})
+	defer server.Close()
+	j := &memJournal{}
+	WithJournal(j)(bf)
+
+	if _, err := bf.SendChildOrder(productCode, ChildOrderTypeMarket, SideBuy, 0.01, nil); err != nil {
+		t.Fatal(err)
+	}
+	_ = bf.CancelChildOrder(productCode, "JRF20150707-050237-639234")
+	if err := bf.CancelAllChildOrders(productCode); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := bf.GetPositions(productCode); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		JournalSendChildOrder, JournalSendChildOrder,
+		JournalCancelChildOrder, JournalCancelChildOrder,
+		JournalCancelAllChildOrders, JournalCancelAllChildOrders,
+	}
+	if fmt.Sprint(j.kinds) != fmt.Sprint(expected) {
+		t.Fatalf("unexpected kinds: %v", j.kinds)
+	}
+	for i := 0; i < len(j.actions); i += 2 {
+		intent, result := j.actions[i], j.actions[i+1]
+		if intent.Phase != ActionIntent || result.Phase != ActionResult || intent.Id == "" || intent.Id != result.Id {
+			t.Errorf("the result doesn't follow the intent: %+v, %+v", intent, result)
+		}
+		if intent.Request == nil || result.Request != nil {
+			t.Errorf("request must be recorded only in the intent: %+v, %+v", intent, result)
+		}
+	}
+	if j.actions[0].Id == j.actions[2].Id {
+		t.Errorf("ids aren't unique: %v", j.actions[0].Id)
+	}
+
+	data, _ := json.Marshal(j.actions[1])
+	var action map[string]interface{}
+	json.Unmarshal(data, &action)
+	if action["response"].(map[string]interface{})["child_order_acceptance_id"] != "JRF20150707-050237-639234" {
+		t.Errorf("unexpected response: %v", string(data))
+	}
+	data, _ = json.Marshal(j.actions[0])
+	json.Unmarshal(data, &action)
+	if action["request"].(map[string]interface{})["size"] != 0.01 {
+		t.Errorf("unexpected request: %v", string(data))
+	}
+	if j.actions[3].Error == "" || j.actions[5].Error != "" {
+		t.Errorf("unexpected errors: %v, %v", j.actions[3].Error, j.actions[5].Error)
+	}
+
+	// the empty response of cancel is recorded
+	data, _ = json.Marshal(j.actions[5])
+	if !strings.Contains(string(data), `"response":""`) {
+		t.Errorf("response of cancel isn't recorded: %v", string(data))
+	}
+}
+
+// failingJournal fails to record.
+type failingJournal struct{}
+
+func (failingJournal) Record(kind string, data interface{}) error {
+	return errors.New("disk full")
+}
+
+func TestJournalFailureBlocksOrder(t *testing.T) {
+	sent := false
+	bf, server := newTestBitflyer(t, func(w http.ResponseWriter, r *http.Request) {
+		sent = true
+	})
+	defer server.Close()
+	WithJournal(failingJournal{})(bf)
+	bf.Logger = NewStdLogger(nil)
+	bf.Logger.(*StdLogger).Level = LevelError + 1
+
+	if err := bf.CancelChildOrder(productCode, "JRF20150707-050237-639234"); err == nil || err.Error() != "disk full" {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if sent {
+		t.Error("the order is sent without the intent")
+	}
+}
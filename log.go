@@ -1,24 +1,152 @@
 package bitflyergo
 
 import (
+	"fmt"
 	"log"
+	"strings"
 )
 
-// Logger is logger.
+// Logger is the logger used by the default LeveledLogger.
+//
+// Deprecated: Use WithLogger or WebSocketClient.Logger to configure the logger of each client.
 var Logger *log.Logger
 
-func logln(v ...interface{}) {
-	if Logger == nil {
-		log.Println(v...)
-		return
+// LeveledLogger is the leveled structured logger. kv is the pairs of key and value.
+// *slog.Logger implements it.
+type LeveledLogger interface {
+	Debug(msg string, kv ...interface{})
+	Info(msg string, kv ...interface{})
+	Warn(msg string, kv ...interface{})
+	Error(msg string, kv ...interface{})
+}
+
+// LogLevel is the level of log.
+type LogLevel int
+
+const (
+	LevelDebug LogLevel = iota // debug
+	LevelInfo                  // info
+	LevelWarn                  // warn
+	LevelError                 // error
+)
+
+// String returns the name of level.
+func (l LogLevel) String() string {
+	switch l {
+	case LevelDebug:
+		return "DEBUG"
+	case LevelInfo:
+		return "INFO"
+	case LevelWarn:
+		return "WARN"
+	case LevelError:
+		return "ERROR"
 	}
-	Logger.Println(v...)
+	return fmt.Sprintf("LEVEL(%d)", int(l))
+}
+
+// StdLogger is LeveledLogger which writes logs like "WARN msg key=value" to *log.Logger.
+type StdLogger struct {
+	Logger *log.Logger // destination. the package Logger or the standard logger is used if nil
+	Level  LogLevel    // minimum level to write
 }
 
-func logf(format string, v ...interface{}) {
-	if Logger == nil {
-		log.Printf(format, v...)
+// NewStdLogger creates StdLogger writing all levels to logger.
+func NewStdLogger(logger *log.Logger) *StdLogger {
+	return &StdLogger{Logger: logger, Level: LevelDebug}
+}
+
+// Debug writes debug log.
+func (l *StdLogger) Debug(msg string, kv ...interface{}) { l.log(LevelDebug, msg, kv) }
+
+// Info writes info log.
+func (l *StdLogger) Info(msg string, kv ...interface{}) { l.log(LevelInfo, msg, kv) }
+
+// Warn writes warn log.
+func (l *StdLogger) Warn(msg string, kv ...interface{}) { l.log(LevelWarn, msg, kv) }
+
+// Error writes error log.
+func (l *StdLogger) Error(msg string, kv ...interface{}) { l.log(LevelError, msg, kv) }
+
+func (l *StdLogger) log(level LogLevel, msg string, kv []interface{}) {
+	if level < l.Level {
+		return
+	}
+	var b strings.Builder
+	b.WriteString(level.String())
+	b.WriteString(" ")
+	b.WriteString(msg)
+	for i := 0; i < len(kv); i += 2 {
+		if i+1 < len(kv) {
+			fmt.Fprintf(&b, " %v=%v", kv[i], kv[i+1])
+		} else {
+			fmt.Fprintf(&b, " %v", kv[i])
+		}
+	}
+	logger := l.Logger
+	if logger == nil {
+		logger = Logger
+	}
+	if logger == nil {
+		log.Println(b.String())
 		return
 	}
-	Logger.Printf(format, v...)
+	logger.Println(b.String())
+}
+
+// defaultLogger is used when the logger isn't configured.
+var defaultLogger = &StdLogger{Level: LevelDebug}
+
+// secretKeys is the keys of values redacted by redactingLogger.
+var secretKeys = map[string]bool{
+	"api_key":    true,
+	"api_secret": true,
+	"apiKey":     true,
+	"apiSecret":  true,
+	"signature":  true,
+	"sign":       true,
+	"code":       true,
+}
+
+// redactingLogger redacts the values of secretKeys and the secrets in dumps before logging.
+type redactingLogger struct {
+	l LeveledLogger
+}
+
+// loggerOf returns l, or the default logger if l is nil, which redacts secrets.
+func loggerOf(l LeveledLogger) LeveledLogger {
+	if l == nil {
+		l = defaultLogger
+	}
+	return redactingLogger{l}
+}
+
+func (r redactingLogger) Debug(msg string, kv ...interface{}) { r.l.Debug(msg, redactKV(kv)...) }
+func (r redactingLogger) Info(msg string, kv ...interface{})  { r.l.Info(msg, redactKV(kv)...) }
+func (r redactingLogger) Warn(msg string, kv ...interface{})  { r.l.Warn(msg, redactKV(kv)...) }
+func (r redactingLogger) Error(msg string, kv ...interface{}) { r.l.Error(msg, redactKV(kv)...) }
+
+// redactKV returns the copy of kv whose secret values are redacted.
+func redactKV(kv []interface{}) []interface{} {
+	redacted := make([]interface{}, len(kv))
+	copy(redacted, kv)
+	for i := 0; i+1 < len(redacted); i += 2 {
+		if k, ok := redacted[i].(string); ok && secretKeys[k] {
+			redacted[i+1] = "[REDACTED]"
+		}
+		if k, ok := redacted[i].(string); ok && k == "dump" {
+			redacted[i+1] = string(redactDump([]byte(fmt.Sprint(redacted[i+1]))))
+		}
+	}
+	return redacted
+}
+
+// logger returns the logger of bf.
+func (bf *Bitflyer) logger() LeveledLogger {
+	return loggerOf(bf.Logger)
+}
+
+// logger returns the logger of bf.
+func (bf *WebSocketClient) logger() LeveledLogger {
+	return loggerOf(bf.Logger)
 }
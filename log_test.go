@@ -1,10 +1,41 @@
 package bitflyergo
 
 import (
+	"bytes"
+	"log"
+	"strings"
 	"testing"
 )
 
 func TestLogln(t *testing.T) {
 	Logger = nil
-	logln("HelloWorld")
+	loggerOf(nil).Info("HelloWorld")
+}
+
+func TestStdLogger(t *testing.T) {
+	var buf bytes.Buffer
+	l := NewStdLogger(log.New(&buf, "", 0))
+	l.Debug("debug", "key", 1)
+	l.Warn("warn", "key", "value", "odd")
+	l.Level = LevelInfo
+	l.Debug("hidden")
+	expected := "DEBUG debug key=1\nWARN warn key=value odd\n"
+	if buf.String() != expected {
+		t.Errorf("unexpected log: %q", buf.String())
+	}
+}
+
+func TestLoggerRedactsSecrets(t *testing.T) {
+	var buf bytes.Buffer
+	l := loggerOf(NewStdLogger(log.New(&buf, "", 0)))
+	l.Info("auth", "api_key", "key", "signature", "sign")
+	l.Debug("request", "dump", "POST /v1/me/withdraw HTTP/1.1\r\nAccess-Key: key\r\nAccess-Sign: sign\r\n\r\n{\"amount\":1,\"code\":\"012345\"}")
+	for _, secret := range []string{"key\n", "sign\n", "Access-Key: key", "Access-Sign: sign", "012345"} {
+		if strings.Contains(buf.String(), secret) {
+			t.Errorf("%q is logged: %v", secret, buf.String())
+		}
+	}
+	if !strings.Contains(buf.String(), "api_key=[REDACTED]") || !strings.Contains(buf.String(), `"code":"[REDACTED]"`) {
+		t.Errorf("secrets are not redacted: %v", buf.String())
+	}
 }
@@ -0,0 +1,256 @@
+package bitflyergo
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Metrics receives the measurements of REST API and websocket.
+//
+// path is the path of API without the version such as PathSendChildOrder, and status is
+// the http status code or 0 if the request failed without response.
+type Metrics interface {
+	ObserveRequest(path string, status int, elapsed time.Duration)
+	IncRetry(path string)
+	ObserveRateLimitWait(wait time.Duration)
+	IncMessage(channel string)
+	IncDecodeError(channel string)
+	ObserveExecutionDelay(channel string, delay time.Duration)
+}
+
+// NopMetrics is Metrics which does nothing. Embed it to implement only some methods.
+type NopMetrics struct{}
+
+// ObserveRequest does nothing.
+func (NopMetrics) ObserveRequest(path string, status int, elapsed time.Duration) {}
+
+// IncRetry does nothing.
+func (NopMetrics) IncRetry(path string) {}
+
+// ObserveRateLimitWait does nothing.
+func (NopMetrics) ObserveRateLimitWait(wait time.Duration) {}
+
+// IncMessage does nothing.
+func (NopMetrics) IncMessage(channel string) {}
+
+// IncDecodeError does nothing.
+func (NopMetrics) IncDecodeError(channel string) {}
+
+// ObserveExecutionDelay does nothing.
+func (NopMetrics) ObserveExecutionDelay(channel string, delay time.Duration) {}
+
+// DefaultBuckets is the upper bounds in seconds of histograms of PrometheusMetrics.
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// PrometheusMetrics is Metrics exposed in Prometheus text format by ServeHTTP.
+type PrometheusMetrics struct {
+	mu               sync.Mutex
+	requests         *metric
+	requestDurations *metric
+	retries          *metric
+	rateLimitWaits   *metric
+	messages         *metric
+	decodeErrors     *metric
+	executionDelays  *metric
+}
+
+// NewPrometheusMetrics creates PrometheusMetrics with DefaultBuckets.
+func NewPrometheusMetrics() *PrometheusMetrics {
+	return &PrometheusMetrics{
+		requests: newMetric("bitflyer_requests_total", "Number of requests of REST API.",
+			"counter", nil, "path", "status"),
+		requestDurations: newMetric("bitflyer_request_duration_seconds", "Latency of requests of REST API.",
+			"histogram", DefaultBuckets, "path"),
+		retries: newMetric("bitflyer_retries_total", "Number of retries of REST API.",
+			"counter", nil, "path"),
+		rateLimitWaits: newMetric("bitflyer_rate_limit_wait_seconds", "Time waited for the rate limit.",
+			"histogram", DefaultBuckets),
+		messages: newMetric("bitflyer_websocket_messages_total", "Number of messages received from websocket.",
+			"counter", nil, "channel"),
+		decodeErrors: newMetric("bitflyer_websocket_decode_errors_total", "Number of messages failed to decode.",
+			"counter", nil, "channel"),
+		executionDelays: newMetric("bitflyer_execution_delay_seconds", "Delay of executions from exec_date to receipt.",
+			"histogram", DefaultBuckets, "channel"),
+	}
+}
+
+// ObserveRequest counts the request and observes its latency.
+func (m *PrometheusMetrics) ObserveRequest(path string, status int, elapsed time.Duration) {
+	s := "error"
+	if status != 0 {
+		s = strconv.Itoa(status)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.requests.observe(1, path, s)
+	m.requestDurations.observe(elapsed.Seconds(), path)
+}
+
+// IncRetry counts the retry.
+func (m *PrometheusMetrics) IncRetry(path string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.retries.observe(1, path)
+}
+
+// ObserveRateLimitWait observes the time waited for the rate limit.
+func (m *PrometheusMetrics) ObserveRateLimitWait(wait time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.rateLimitWaits.observe(wait.Seconds())
+}
+
+// IncMessage counts the message of channel.
+func (m *PrometheusMetrics) IncMessage(channel string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.messages.observe(1, channel)
+}
+
+// IncDecodeError counts the message of channel failed to decode.
+func (m *PrometheusMetrics) IncDecodeError(channel string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.decodeErrors.observe(1, channel)
+}
+
+// ObserveExecutionDelay observes the delay of execution.
+func (m *PrometheusMetrics) ObserveExecutionDelay(channel string, delay time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.executionDelays.observe(delay.Seconds(), channel)
+}
+
+// WriteTo writes all metrics in Prometheus text format.
+func (m *PrometheusMetrics) WriteTo(w io.Writer) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	cw := &countingWriter{w: bufio.NewWriter(w)}
+	for _, metric := range []*metric{m.requests, m.requestDurations, m.retries, m.rateLimitWaits,
+		m.messages, m.decodeErrors, m.executionDelays} {
+		metric.write(cw)
+	}
+	if cw.err != nil {
+		return cw.n, cw.err
+	}
+	return cw.n, cw.w.Flush()
+}
+
+// ServeHTTP responds all metrics in Prometheus text format.
+func (m *PrometheusMetrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_, _ = m.WriteTo(w)
+}
+
+// metric is the counter or histogram with labels.
+type metric struct {
+	name    string
+	help    string
+	typ     string
+	buckets []float64
+	labels  []string
+	series  map[string]*series
+}
+
+// series is the values of metric for the label values.
+type series struct {
+	labelValues []string
+	counts      []uint64 // count of each bucket
+	count       uint64
+	sum         float64
+}
+
+func newMetric(name string, help string, typ string, buckets []float64, labels ...string) *metric {
+	return &metric{name: name, help: help, typ: typ, buckets: buckets, labels: labels, series: map[string]*series{}}
+}
+
+// observe adds v to the series of labelValues. Counter adds v, and histogram observes v.
+func (m *metric) observe(v float64, labelValues ...string) {
+	key := strings.Join(labelValues, "\xff")
+	s, ok := m.series[key]
+	if !ok {
+		s = &series{labelValues: labelValues, counts: make([]uint64, len(m.buckets))}
+		m.series[key] = s
+	}
+	s.sum += v
+	s.count++
+	for i, le := range m.buckets {
+		if v <= le {
+			s.counts[i]++
+		}
+	}
+}
+
+func (m *metric) write(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", m.name, m.help, m.name, m.typ)
+	keys := make([]string, 0, len(m.series))
+	for k := range m.series {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		s := m.series[k]
+		if m.typ == "counter" {
+			fmt.Fprintf(w, "%s%s %s\n", m.name, m.labelString(s, ""), formatFloat(s.sum))
+			continue
+		}
+		for i, le := range m.buckets {
+			fmt.Fprintf(w, "%s_bucket%s %d\n", m.name, m.labelString(s, formatFloat(le)), s.counts[i])
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", m.name, m.labelString(s, "+Inf"), s.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", m.name, m.labelString(s, ""), formatFloat(s.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", m.name, m.labelString(s, ""), s.count)
+	}
+}
+
+// labelString returns labels such as {path="/getboard",le="0.1"}. le is omitted if blank.
+func (m *metric) labelString(s *series, le string) string {
+	var pairs []string
+	for i, name := range m.labels {
+		pairs = append(pairs, name+`="`+escapeLabel(s.labelValues[i])+`"`)
+	}
+	if le != "" {
+		pairs = append(pairs, `le="`+le+`"`)
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(s string) string {
+	return labelEscaper.Replace(s)
+}
+
+func formatFloat(f float64) string {
+	if math.IsInf(f, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+type countingWriter struct {
+	w   *bufio.Writer
+	n   int64
+	err error
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	if c.err != nil {
+		return 0, c.err
+	}
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	c.err = err
+	return n, err
+}
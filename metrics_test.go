@@ -0,0 +1,107 @@
+package bitflyergo
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPrometheusMetricsWrite(t *testing.T) {
+	m := NewPrometheusMetrics()
+	m.ObserveRequest(PathGetBoard, 200, 30*time.Millisecond)
+	m.ObserveRequest(PathGetBoard, 0, time.Second)
+	m.IncMessage(`a"b`)
+
+	var b strings.Builder
+	if _, err := m.WriteTo(&b); err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{
+		"# TYPE bitflyer_requests_total counter",
+		`bitflyer_requests_total{path="/getboard",status="200"} 1`,
+		`bitflyer_requests_total{path="/getboard",status="error"} 1`,
+		"# TYPE bitflyer_request_duration_seconds histogram",
+		`bitflyer_request_duration_seconds_bucket{path="/getboard",le="0.025"} 0`,
+		`bitflyer_request_duration_seconds_bucket{path="/getboard",le="0.05"} 1`,
+		`bitflyer_request_duration_seconds_bucket{path="/getboard",le="+Inf"} 2`,
+		`bitflyer_request_duration_seconds_sum{path="/getboard"} 1.03`,
+		`bitflyer_request_duration_seconds_count{path="/getboard"} 2`,
+		`bitflyer_websocket_messages_total{channel="a\"b"} 1`,
+	} {
+		if !strings.Contains(b.String(), line+"\n") {
+			t.Errorf("%q is not found in:\n%v", line, b.String())
+		}
+	}
+}
+
+func TestRequestMetrics(t *testing.T) {
+	calls := 0
+	bf, server := newTestBitflyer(t, func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls == 1 {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"status":-1,"error_message":"error"}`)
+			return
+		}
+		fmt.Fprint(w, `[]`)
+	})
+	defer server.Close()
+	m := NewPrometheusMetrics()
+	WithMetrics(m)(bf)
+	WithRateLimiter(NewRateLimiter(DefaultRateLimit, DefaultRatePeriod))(bf)
+
+	if _, err := bf.GetPositions(productCode); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := httptest.NewRecorder()
+	m.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("unexpected Content-Type: %v", ct)
+	}
+	for _, line := range []string{
+		`bitflyer_requests_total{path="/me/getpositions",status="400"} 1`,
+		`bitflyer_requests_total{path="/me/getpositions",status="200"} 1`,
+		`bitflyer_retries_total{path="/me/getpositions"} 1`,
+		`bitflyer_rate_limit_wait_seconds_count 2`,
+	} {
+		if !strings.Contains(rec.Body.String(), line+"\n") {
+			t.Errorf("%q is not found in:\n%v", line, rec.Body.String())
+		}
+	}
+}
+
+func TestWebSocketMetrics(t *testing.T) {
+	execDate := time.Now().Add(-100 * time.Millisecond).UTC().Format(time.RFC3339Nano)
+	messages := []string{
+		`{"jsonrpc":"2.0","method":"channelMessage","params":{"channel":"lightning_executions_FX_BTC_JPY","message":[
+			{"id":1,"side":"BUY","price":900000,"size":0.01,"exec_date":"` + execDate + `",
+			"buy_child_order_acceptance_id":"a","sell_child_order_acceptance_id":"b"}]}}`,
+		`{"jsonrpc":"2.0","method":"channelMessage","params":{"channel":"lightning_ticker_FX_BTC_JPY","message":{
+			"product_code":"FX_BTC_JPY","timestamp":"invalid","tick_id":1,"best_bid":1,"best_ask":1,"best_bid_size":1,
+			"best_ask_size":1,"total_bid_depth":1,"total_ask_depth":1,"ltp":1,"volume":1,"volume_by_product":1}}}`,
+	}
+	con, closeServer := newTestWebSocket(t, messages)
+	defer closeServer()
+	m := NewPrometheusMetrics()
+	ws := &WebSocketClient{Con: con, Cb: NopCallback{}, Logger: NewStdLogger(nil), Metrics: m}
+	ws.Logger.(*StdLogger).Level = LevelError + 1
+	ws.Receive()
+
+	var b strings.Builder
+	m.WriteTo(&b)
+	for _, line := range []string{
+		`bitflyer_websocket_messages_total{channel="lightning_executions_FX_BTC_JPY"} 1`,
+		`bitflyer_websocket_messages_total{channel="lightning_ticker_FX_BTC_JPY"} 1`,
+		`bitflyer_websocket_decode_errors_total{channel="lightning_ticker_FX_BTC_JPY"} 1`,
+		`bitflyer_execution_delay_seconds_bucket{channel="lightning_executions_FX_BTC_JPY",le="0.05"} 0`,
+		`bitflyer_execution_delay_seconds_count{channel="lightning_executions_FX_BTC_JPY"} 1`,
+	} {
+		if !strings.Contains(b.String(), line+"\n") {
+			t.Errorf("%q is not found in:\n%v", line, b.String())
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package bitflyergo
+
+import (
+	"net/http"
+	"time"
+)
+
+// Response is the response of REST API passed through the middleware chain.
+type Response struct {
+	StatusCode int           // http status code
+	Header     http.Header   // response headers
+	Body       []byte        // response body
+	SentAt     time.Time     // time when the request was sent. zero for synthetic responses
+	Latency    time.Duration // time to receive the response. zero for synthetic responses
+}
+
+// Handler sends the request and returns the response.
+type Handler func(req *http.Request) (*Response, error)
+
+// Middleware wraps Handler to inspect or modify the request and the response.
+//
+// The request can be modified freely, including its URL and body, because the rate limit is waited
+// for and the authentication headers are signed after the middlewares. Therefore middlewares don't see
+// ACCESS-SIGN and ACCESS-TIMESTAMP. It can short-circuit the chain by returning a cached or synthetic
+// response without calling next, and then the rate limit isn't consumed.
+type Middleware func(next Handler) Handler
+
+// Hooks is the set of functions called around requests. nil functions are skipped.
+type Hooks struct {
+
+	// BeforeSend is called before the request is signed and sent. It can modify req, e.g. add headers.
+	// The request isn't sent if it returns error.
+	BeforeSend func(req *http.Request) error
+
+	// AfterReceive is called when the response is received.
+	AfterReceive func(req *http.Request, res *Response)
+
+	// OnError is called when the request fails without response.
+	OnError func(req *http.Request, err error)
+}
+
+// Middleware returns Middleware which calls hooks.
+func (h Hooks) Middleware() Middleware {
+	return func(next Handler) Handler {
+		return func(req *http.Request) (*Response, error) {
+			if h.BeforeSend != nil {
+				if err := h.BeforeSend(req); err != nil {
+					if h.OnError != nil {
+						h.OnError(req, err)
+					}
+					return nil, err
+				}
+			}
+			res, err := next(req)
+			if err != nil {
+				if h.OnError != nil {
+					h.OnError(req, err)
+				}
+				return nil, err
+			}
+			if h.AfterReceive != nil {
+				h.AfterReceive(req, res)
+			}
+			return res, nil
+		}
+	}
+}
+
+// chain returns the handler which calls middlewares in order, the first one being the outermost.
+func chain(handler Handler, middlewares []Middleware) Handler {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		handler = middlewares[i](handler)
+	}
+	return handler
+}
@@ -0,0 +1,132 @@
+package bitflyergo
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestMiddlewareOrder(t *testing.T) {
+	bf, server := newTestBitflyer(t, func(w http.ResponseWriter, r *http.Request) {
+		if v := r.Header.Get("X-Trace"); v != "outer,inner" {
+			t.Errorf("unexpected header: %v", v)
+		}
+		fmt.Fprint(w, `[]`)
+	})
+	defer server.Close()
+
+	var calls []string
+	named := func(name string) Middleware {
+		return func(next Handler) Handler {
+			return func(req *http.Request) (*Response, error) {
+				calls = append(calls, name+">")
+				if v := req.Header.Get("X-Trace"); v == "" {
+					req.Header.Set("X-Trace", name)
+				} else {
+					req.Header.Set("X-Trace", v+","+name)
+				}
+				res, err := next(req)
+				calls = append(calls, "<"+name)
+				return res, err
+			}
+		}
+	}
+	WithMiddleware(named("outer"), named("inner"))(bf)
+
+	if _, err := bf.GetPositions(productCode); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(calls, " ") != "outer> inner> <inner <outer" {
+		t.Errorf("unexpected order: %v", calls)
+	}
+}
+
+func TestMiddlewareShortCircuit(t *testing.T) {
+	bf, server := newTestBitflyer(t, func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("request was sent")
+	})
+	defer server.Close()
+	WithMiddleware(func(next Handler) Handler {
+		return func(req *http.Request) (*Response, error) {
+			if req.URL.Path == "/v1"+PathGetPositions {
+				return &Response{StatusCode: http.StatusOK, Body: []byte(`[{"product_code":"FX_BTC_JPY","side":"BUY"}]`)}, nil
+			}
+			return &Response{StatusCode: http.StatusBadRequest, Body: []byte(`{"status":-208,"error_message":"synthetic"}`)}, nil
+		}
+	})(bf)
+
+	positions, err := bf.GetPositions(productCode)
+	if err != nil || len(positions) != 1 || positions[0].Side != SideBuy {
+		t.Errorf("unexpected positions: %v, %v", positions, err)
+	}
+	var apiErr *ApiError
+	if err := bf.CancelChildOrder(productCode, "id"); !errors.As(err, &apiErr) || apiErr.Status != -208 {
+		t.Errorf("expected synthetic ApiError: %v", err)
+	}
+}
+
+func TestMiddlewareSignedAfter(t *testing.T) {
+	bf, server := newTestBitflyer(t, func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		if r.URL.Query().Get("trace") != "1" || string(body) != `{"product_code":"BTC_JPY"}` {
+			t.Errorf("unexpected request: %v %s", r.URL, body)
+		}
+	})
+	defer server.Close()
+	WithMiddleware(func(next Handler) Handler {
+		return func(req *http.Request) (*Response, error) {
+			if req.Header.Get("ACCESS-SIGN") != "" {
+				t.Errorf("request is signed before middleware")
+			}
+			req.URL.RawQuery = "trace=1"
+			req.Body = ioutil.NopCloser(strings.NewReader(`{"product_code":"BTC_JPY"}`))
+			return next(req)
+		}
+	})(bf)
+
+	// the signature is verified by the test server
+	if err := bf.CancelAllChildOrders(productCode); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestHooks(t *testing.T) {
+	bf, server := newTestBitflyer(t, func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[]`)
+	})
+	defer server.Close()
+
+	var received []int
+	var failed []error
+	rejected := errors.New("rejected")
+	WithMiddleware(Hooks{
+		BeforeSend: func(req *http.Request) error {
+			if req.Method == "POST" {
+				return rejected
+			}
+			return nil
+		},
+		AfterReceive: func(req *http.Request, res *Response) {
+			received = append(received, res.StatusCode)
+		},
+		OnError: func(req *http.Request, err error) {
+			failed = append(failed, err)
+		},
+	}.Middleware())(bf)
+
+	if _, err := bf.GetPositions(productCode); err != nil {
+		t.Fatal(err)
+	}
+	if err := bf.CancelAllChildOrders(productCode); err != rejected {
+		t.Errorf("expected rejected: %v", err)
+	}
+	if len(received) != 1 || received[0] != http.StatusOK {
+		t.Errorf("unexpected received: %v", received)
+	}
+	if len(failed) != 1 || failed[0] != rejected {
+		t.Errorf("unexpected failed: %v", failed)
+	}
+}
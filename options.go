@@ -0,0 +1,219 @@
+package bitflyergo
+
+import (
+	"context"
+	"net"
+	"net/http"
+	url2 "net/url"
+	"strings"
+	"time"
+)
+
+// DefaultTimeout is the default timeout of the http client.
+const DefaultTimeout = 30 * time.Second
+
+// OrderPaths is the paths of API to place or cancel orders. WithOrderTimeout sets their timeouts.
+var OrderPaths = []string{
+	PathSendChildOrder,
+	PathCancelChildOrder,
+	PathCancelAllChildOrders,
+	PathSendParentOrder,
+	PathCancelParentOrder,
+}
+
+// DefaultRetryInterval is the default interval of retries.
+const DefaultRetryInterval = time.Second
+
+// Option configures Bitflyer created by New or NewBitflyer.
+type Option func(bf *Bitflyer)
+
+// WithCredentials sets api key and api secret to call private API.
+func WithCredentials(apiKey string, apiSecret string) Option {
+	return WithCredentialsProvider(StaticCredentials{ApiKey: apiKey, ApiSecret: apiSecret})
+}
+
+// WithCredentialsProvider sets the provider of credentials to call private API,
+// e.g. EnvCredentials, FileCredentials or RotatingCredentials.
+func WithCredentialsProvider(provider CredentialsProvider) Option {
+	return func(bf *Bitflyer) {
+		bf.Credentials = provider
+	}
+}
+
+// WithRetry retries API up to limit times at interval when it returns the error of status in statuses.
+func WithRetry(statuses []int, limit int, interval time.Duration) Option {
+	return func(bf *Bitflyer) {
+		bf.RetryStatus = statuses
+		bf.RetryLimit = limit
+		bf.RetryInterval = interval
+	}
+}
+
+// WithLogger sets the logger of this instance, e.g. *slog.Logger or NewStdLogger.
+// The logger of Clock is also set if it isn't set yet.
+func WithLogger(logger LeveledLogger) Option {
+	return func(bf *Bitflyer) {
+		bf.Logger = logger
+		if bf.Clock != nil && bf.Clock.Logger == nil {
+			bf.Clock.Logger = logger
+		}
+	}
+}
+
+// WithRateLimiter sets the rate limiter. nil disables the rate limit.
+func WithRateLimiter(limiter RateLimiter) Option {
+	return func(bf *Bitflyer) {
+		bf.RateLimiter = limiter
+	}
+}
+
+// WithClock sets the clock to sign private API. nil uses the local time.
+func WithClock(clock *Clock) Option {
+	return func(bf *Bitflyer) {
+		bf.Clock = clock
+	}
+}
+
+// WithDebug sets debug mode which dumps requests.
+func WithDebug(debug bool) Option {
+	return func(bf *Bitflyer) {
+		bf.Debug = debug
+	}
+}
+
+// WithMetrics sets the metrics of requests, e.g. NewPrometheusMetrics.
+func WithMetrics(metrics Metrics) Option {
+	return func(bf *Bitflyer) {
+		bf.Metrics = metrics
+	}
+}
+
+// WithMiddleware appends middlewares which wrap every request, e.g. Hooks.Middleware().
+func WithMiddleware(middlewares ...Middleware) Option {
+	return func(bf *Bitflyer) {
+		bf.Middlewares = append(bf.Middlewares, middlewares...)
+	}
+}
+
+// WithJournal records every order action and its result to journal.
+func WithJournal(journal Journal) Option {
+	return func(bf *Bitflyer) {
+		bf.Journal = journal
+	}
+}
+
+// WithWithdraw enables Withdraw.
+func WithWithdraw() Option {
+	return func(bf *Bitflyer) {
+		bf.EnableWithdraw = true
+	}
+}
+
+// WithTransport sets the transport of the http client, e.g. to record or mock requests.
+func WithTransport(transport http.RoundTripper) Option {
+	return func(bf *Bitflyer) {
+		client := *bf.client
+		client.Transport = transport
+		bf.client = &client
+	}
+}
+
+// WithHTTPClient uses client to call API instead of the default one.
+func WithHTTPClient(client *http.Client) Option {
+	return func(bf *Bitflyer) {
+		bf.client = client
+	}
+}
+
+// WithTimeout sets the timeout of the http client. It doesn't modify the client given by WithHTTPClient.
+func WithTimeout(timeout time.Duration) Option {
+	return func(bf *Bitflyer) {
+		client := *bf.client
+		client.Timeout = timeout
+		bf.client = &client
+	}
+}
+
+// WithProxy sends requests via proxy such as "http://proxy.example.com:8080".
+// The transport is replaced by the default one if it's not *http.Transport.
+func WithProxy(proxy *url2.URL) Option {
+	return func(bf *Bitflyer) {
+		transport, ok := bf.client.Transport.(*http.Transport)
+		if ok {
+			transport = transport.Clone()
+		} else {
+			transport = newTransport()
+		}
+		transport.Proxy = http.ProxyURL(proxy)
+		client := *bf.client
+		client.Transport = transport
+		bf.client = &client
+	}
+}
+
+// WithUserAgent sets User-Agent header of requests.
+func WithUserAgent(userAgent string) Option {
+	return func(bf *Bitflyer) {
+		bf.UserAgent = userAgent
+	}
+}
+
+// WithBaseURL sets the base url of API, e.g. the url of the test server.
+func WithBaseURL(baseURL string) Option {
+	return func(bf *Bitflyer) {
+		bf.BaseUrl = strings.TrimSuffix(baseURL, "/")
+	}
+}
+
+// WithPathTimeout sets the timeout of API of path such as PathGetBoard.
+// It takes precedence over the timeout of the http client only if it's shorter.
+func WithPathTimeout(path string, timeout time.Duration) Option {
+	return func(bf *Bitflyer) {
+		if bf.Timeouts == nil {
+			bf.Timeouts = map[string]time.Duration{}
+		}
+		bf.Timeouts[path] = timeout
+	}
+}
+
+// WithOrderTimeout sets the timeout of OrderPaths, so that placing and canceling orders fail fast.
+func WithOrderTimeout(timeout time.Duration) Option {
+	return func(bf *Bitflyer) {
+		for _, path := range OrderPaths {
+			WithPathTimeout(path, timeout)(bf)
+		}
+	}
+}
+
+// newTransport returns the transport which keeps connections to API alive for low latency.
+func newTransport() *http.Transport {
+	return &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   10 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          100,
+		MaxIdleConnsPerHost:   32,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: time.Second,
+	}
+}
+
+// newHTTPClient returns the default http client.
+func newHTTPClient() *http.Client {
+	return &http.Client{Transport: newTransport(), Timeout: DefaultTimeout}
+}
+
+// withPathTimeout returns the request whose context has the timeout of its path, if any.
+// cancel must be called after the response body is read.
+func (bf *Bitflyer) withPathTimeout(req *http.Request) (*http.Request, context.CancelFunc) {
+	timeout, ok := bf.Timeouts[bf.apiPath(req.URL.Path)]
+	if !ok || timeout <= 0 {
+		return req, func() {}
+	}
+	ctx, cancel := context.WithTimeout(req.Context(), timeout)
+	return req.WithContext(ctx), cancel
+}
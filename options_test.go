@@ -0,0 +1,128 @@
+package bitflyergo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	url2 "net/url"
+	"testing"
+	"time"
+)
+
+func TestNew(t *testing.T) {
+	bf := New()
+	if bf.BaseUrl != baseUrl || bf.ApiVersion != "1" || bf.RetryLimit != 0 {
+		t.Errorf("unexpected defaults: %+v", bf)
+	}
+	if bf.RateLimiter == nil || bf.Clock == nil {
+		t.Errorf("rate limiter or clock is not set")
+	}
+
+	logger := NewStdLogger(log.New(ioutil.Discard, "", 0))
+	bf = New(
+		WithCredentials("key", "secret"),
+		WithRetry([]int{-1}, 3, time.Millisecond),
+		WithLogger(logger),
+		WithRateLimiter(nil),
+		WithClock(nil),
+		WithDebug(true),
+		WithWithdraw())
+	if c, _ := bf.Credentials.Credentials(); c.ApiKey != "key" || c.ApiSecret != "secret" {
+		t.Errorf("credentials are not set")
+	}
+	if len(bf.RetryStatus) != 1 || bf.RetryLimit != 3 || bf.RetryInterval != time.Millisecond {
+		t.Errorf("retry policy is not set")
+	}
+	if bf.Logger != LeveledLogger(logger) || bf.RateLimiter != nil || bf.Clock != nil || !bf.Debug || !bf.EnableWithdraw {
+		t.Errorf("unexpected options: %+v", bf)
+	}
+}
+
+func TestNewBitflyer(t *testing.T) {
+	bf := NewBitflyer("key", "secret", []int{-1}, 1, 0)
+	if bf.RateLimiter != nil || bf.client.Timeout != 0 {
+		t.Errorf("rate limiter or timeout is set: %+v %+v", bf.RateLimiter, bf.client)
+	}
+	if _, ok := bf.client.Transport.(*http.Transport); !ok {
+		t.Errorf("unexpected transport: %T", bf.client.Transport)
+	}
+	bf = NewBitflyer("key", "secret", []int{-1}, 1, 0, WithTimeout(time.Second), WithRateLimiter(NewRateLimiter(1, time.Second)))
+	if bf.RateLimiter == nil || bf.client.Timeout != time.Second {
+		t.Errorf("rate limiter or timeout isn't set: %+v %+v", bf.RateLimiter, bf.client)
+	}
+}
+
+func TestWithTransport(t *testing.T) {
+	transport := &http.Transport{}
+	bf := New(WithTransport(transport))
+	if bf.client.Transport != transport || bf.client.Timeout != DefaultTimeout {
+		t.Errorf("unexpected client: %+v", bf.client)
+	}
+}
+
+func TestWithHTTPClientAndTimeout(t *testing.T) {
+	client := &http.Client{}
+	bf := NewBitflyer("", "", nil, 0, 0, WithHTTPClient(client), WithTimeout(time.Second))
+	if bf.client.Timeout != time.Second {
+		t.Errorf("unexpected timeout: %v", bf.client.Timeout)
+	}
+	if client.Timeout != 0 {
+		t.Errorf("given client was modified")
+	}
+}
+
+func TestWithProxy(t *testing.T) {
+	proxy, _ := url2.Parse("http://proxy.example.com:8080")
+	bf := NewBitflyer("", "", nil, 0, 0, WithProxy(proxy))
+	transport := bf.client.Transport.(*http.Transport)
+	req, _ := http.NewRequest("GET", baseUrl, nil)
+	u, err := transport.Proxy(req)
+	if err != nil || u.String() != proxy.String() {
+		t.Errorf("unexpected proxy: %v, %v", u, err)
+	}
+}
+
+func TestWithUserAgentAndBaseURL(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ua := r.Header.Get("User-Agent"); ua != "mybot/1.0" {
+			t.Errorf("unexpected User-Agent: %v", ua)
+		}
+		fmt.Fprint(w, `[]`)
+	}))
+	defer server.Close()
+
+	bf := NewBitflyer("", "", nil, 0, 0, WithUserAgent("mybot/1.0"), WithBaseURL(server.URL+"/"))
+	if bf.BaseUrl != server.URL {
+		t.Errorf("unexpected BaseUrl: %v", bf.BaseUrl)
+	}
+	if _, err := bf.GetMarkets(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestWithOrderTimeout(t *testing.T) {
+	bf, server := newTestBitflyer(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v1"+PathCancelChildOrder {
+			time.Sleep(200 * time.Millisecond)
+		}
+		fmt.Fprint(w, `[]`)
+	})
+	defer server.Close()
+	WithOrderTimeout(50 * time.Millisecond)(bf)
+
+	started := time.Now()
+	err := bf.CancelChildOrder(productCode, "JRF20150707-050237-639234")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected timeout: %v", err)
+	}
+	if elapsed := time.Since(started); elapsed > 150*time.Millisecond {
+		t.Errorf("order timeout was not applied: %v", elapsed)
+	}
+	if _, err := bf.GetPositions(productCode); err != nil {
+		t.Errorf("timeout was applied to other path: %v", err)
+	}
+}
@@ -2,8 +2,8 @@ package bitflyergo
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
-	"strconv"
 )
 
 const (
@@ -31,8 +31,64 @@ const (
 
 	// PathCancelAllChildOrders is path of api to cancel all child orders
 	PathCancelAllChildOrders = "/me/cancelallchildorders"
+
+	// PathGetBalanceHistory is path of api to get balance history
+	PathGetBalanceHistory = "/me/getbalancehistory"
+
+	// PathGetCollateralHistory is path of api to get collateral history
+	PathGetCollateralHistory = "/me/getcollateralhistory"
+
+	// PathGetCollateralAccounts is path of api to get collateral of each currency
+	PathGetCollateralAccounts = "/me/getcollateralaccounts"
+
+	// PathGetTradingCommission is path of api to get trading commission
+	PathGetTradingCommission = "/me/gettradingcommission"
+
+	// PathGetPermissions is path of api to get permissions of api key
+	PathGetPermissions = "/me/getpermissions"
+
+	// PathSendParentOrder is path of api to send parent order
+	PathSendParentOrder = "/me/sendparentorder"
+
+	// PathCancelParentOrder is path of api to cancel parent order
+	PathCancelParentOrder = "/me/cancelparentorder"
+
+	// PathGetParentOrders is path of api to get own parent orders
+	PathGetParentOrders = "/me/getparentorders"
+
+	// PathGetParentOrder is path of api to get detail of own parent order
+	PathGetParentOrder = "/me/getparentorder"
+
+	// PathGetAddresses is path of api to get deposit addresses
+	PathGetAddresses = "/me/getaddresses"
+
+	// PathGetCoinIns is path of api to get history of crypto currency deposits
+	PathGetCoinIns = "/me/getcoinins"
+
+	// PathGetCoinOuts is path of api to get history of crypto currency transfers
+	PathGetCoinOuts = "/me/getcoinouts"
+
+	// PathGetBankAccounts is path of api to get registered bank accounts
+	PathGetBankAccounts = "/me/getbankaccounts"
+
+	// PathGetDeposits is path of api to get history of cash deposits
+	PathGetDeposits = "/me/getdeposits"
+
+	// PathGetWithdrawals is path of api to get history of cash withdrawals
+	PathGetWithdrawals = "/me/getwithdrawals"
+
+	// PathWithdraw is path of api to withdraw cash
+	PathWithdraw = "/me/withdraw"
 )
 
+// ErrWithdrawDisabled is returned by Withdraw when Bitflyer.EnableWithdraw is false.
+var ErrWithdrawDisabled = errors.New("withdraw is disabled. set Bitflyer.EnableWithdraw to true to withdraw")
+
+// GetMyExecutionsByFilter gets own executions matching the filter.
+func (bf *Bitflyer) GetMyExecutionsByFilter(filter *MyExecutionFilter) ([]MyExecution, error) {
+	return bf.GetMyExecutions(filter.params())
+}
+
 // GetMyExecutions gets own executions.
 func (bf *Bitflyer) GetMyExecutions(params map[string]string) ([]MyExecution, error) {
 	res, err := bf.callApiWithRetry("GET", "/v"+bf.ApiVersion+PathGetMyExecutions, params)
@@ -47,6 +103,11 @@ func (bf *Bitflyer) GetMyExecutions(params map[string]string) ([]MyExecution, er
 	return executions, nil
 }
 
+// GetChildOrdersByFilter gets own child orders matching the filter.
+func (bf *Bitflyer) GetChildOrdersByFilter(filter *ChildOrderFilter) ([]ChildOrder, error) {
+	return bf.GetChildOrders(filter.params())
+}
+
 // GetChildOrders gets own child orders.
 //
 // Required parameters
@@ -108,34 +169,50 @@ func (bf *Bitflyer) GetBalance() (*[]Balance, error) {
 }
 
 // SendChildOrder send child order.
+//
+// params can have "price", "minute_to_expire" and "time_in_force". The other parameters are rejected;
+// use PlaceChildOrder with ChildOrderRequest.Extra to send them. It's a thin wrapper of PlaceChildOrder.
 func (bf *Bitflyer) SendChildOrder(productCode string, childOrderType string,
-	side string, size float64, params map[string]string) (map[string]string, error) {
+	side string, size float64, params map[string]string) (*OrderAck, error) {
 
-	if size < MinimumOrderbleSize {
-		return nil, fmt.Errorf(
-			"Sizes less than %v can not be ordered. [%v]\n", MinimumOrderbleSize, size)
+	req, err := newChildOrderRequest(productCode, childOrderType, side, size, params)
+	if err != nil {
+		return nil, err
 	}
+	return bf.PlaceChildOrder(req)
+}
 
-	if params == nil {
-		params = map[string]string{}
+// PlaceChildOrder validates and sends child order.
+//
+// If Bitflyer.OrderGate is set, the order is sent only when the gate admits it.
+func (bf *Bitflyer) PlaceChildOrder(req *ChildOrderRequest) (*OrderAck, error) {
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+	if bf.OrderGate != nil {
+		if err := bf.OrderGate.Admit(req.ProductCode); err != nil {
+			return nil, err
+		}
 	}
 
-	params["product_code"] = productCode
-	params["child_order_type"] = childOrderType
-	params["side"] = side
-	params["size"] = strconv.FormatFloat(size, 'g', 8, 64)
-
-	res, err := bf.callApiWithRetry("POST", "/v"+bf.ApiVersion+PathSendChildOrder, params)
+	action, err := bf.beginAction(JournalSendChildOrder, req)
+	if err != nil {
+		return nil, err
+	}
+	res, err := bf.callApiWithRetryResponse("POST", "/v"+bf.ApiVersion+PathSendChildOrder, nil, req)
 	if err != nil {
+		bf.endAction(JournalSendChildOrder, action, nil, err)
 		return nil, err
 	}
 
-	var orderResult map[string]string
-	err = json.Unmarshal(res, &orderResult)
+	// measured by the final attempt, excluding the rate limit and the retries
+	ack := OrderAck{SentAt: res.SentAt, Latency: res.Latency}
+	err = json.Unmarshal(res.Body, &ack)
+	bf.endAction(JournalSendChildOrder, action, res.Body, err)
 	if err != nil {
 		return nil, err
 	}
-	return orderResult, nil
+	return &ack, nil
 }
 
 // CancelAllChildOrders cancels all child orders.
@@ -143,7 +220,12 @@ func (bf *Bitflyer) CancelAllChildOrders(productCode string) error {
 	params := map[string]string{
 		"product_code": productCode,
 	}
-	_, err := bf.callApiWithRetry("POST", "/v"+bf.ApiVersion+PathCancelAllChildOrders, params)
+	action, err := bf.beginAction(JournalCancelAllChildOrders, params)
+	if err != nil {
+		return err
+	}
+	res, err := bf.callApiWithRetry("POST", "/v"+bf.ApiVersion+PathCancelAllChildOrders, params)
+	bf.endAction(JournalCancelAllChildOrders, action, res, err)
 	return err
 }
 
@@ -153,6 +235,303 @@ func (bf *Bitflyer) CancelChildOrder(productCode string, childOrderAcceptanceId
 		"product_code":              productCode,
 		"child_order_acceptance_id": childOrderAcceptanceId,
 	}
-	_, err := bf.callApiWithRetry("POST", "/v"+bf.ApiVersion+PathCancelChildOrder, params)
+	action, err := bf.beginAction(JournalCancelChildOrder, params)
+	if err != nil {
+		return err
+	}
+	res, err := bf.callApiWithRetry("POST", "/v"+bf.ApiVersion+PathCancelChildOrder, params)
+	bf.endAction(JournalCancelChildOrder, action, res, err)
+	return err
+}
+
+// GetBalanceHistory gets balance history of specified currency_code.
+//
+// page may be nil.
+func (bf *Bitflyer) GetBalanceHistory(currencyCode string, page *Pagination) ([]BalanceHistory, error) {
+	params := map[string]string{"currency_code": currencyCode}
+	page.setParams(params)
+	res, err := bf.callApiWithRetry("GET", "/v"+bf.ApiVersion+PathGetBalanceHistory, params)
+	if err != nil {
+		return nil, err
+	}
+	var histories []BalanceHistory
+	err = json.Unmarshal(res, &histories)
+	if err != nil {
+		return nil, err
+	}
+	return histories, nil
+}
+
+// GetCollateralHistory gets collateral history.
+//
+// page may be nil.
+func (bf *Bitflyer) GetCollateralHistory(page *Pagination) ([]CollateralHistory, error) {
+	params := map[string]string{}
+	page.setParams(params)
+	res, err := bf.callApiWithRetry("GET", "/v"+bf.ApiVersion+PathGetCollateralHistory, params)
+	if err != nil {
+		return nil, err
+	}
+	var histories []CollateralHistory
+	err = json.Unmarshal(res, &histories)
+	if err != nil {
+		return nil, err
+	}
+	return histories, nil
+}
+
+// GetCollateralAccounts gets collateral of each currency.
+func (bf *Bitflyer) GetCollateralAccounts() ([]CollateralAccount, error) {
+	res, err := bf.callApiWithRetry("GET", "/v"+bf.ApiVersion+PathGetCollateralAccounts, nil)
+	if err != nil {
+		return nil, err
+	}
+	var accounts []CollateralAccount
+	err = json.Unmarshal(res, &accounts)
+	if err != nil {
+		return nil, err
+	}
+	return accounts, nil
+}
+
+// GetTradingCommission gets trading commission rate of specified product_code.
+func (bf *Bitflyer) GetTradingCommission(productCode string) (*TradingCommission, error) {
+	params := map[string]string{"product_code": productCode}
+	res, err := bf.callApiWithRetry("GET", "/v"+bf.ApiVersion+PathGetTradingCommission, params)
+	if err != nil {
+		return nil, err
+	}
+	var commission TradingCommission
+	err = json.Unmarshal(res, &commission)
+	if err != nil {
+		return nil, err
+	}
+	return &commission, nil
+}
+
+// GetPermissions gets the api paths which the api key is permitted to call.
+func (bf *Bitflyer) GetPermissions() ([]string, error) {
+	res, err := bf.callApiWithRetry("GET", "/v"+bf.ApiVersion+PathGetPermissions, nil)
+	if err != nil {
+		return nil, err
+	}
+	var permissions []string
+	err = json.Unmarshal(res, &permissions)
+	if err != nil {
+		return nil, err
+	}
+	return permissions, nil
+}
+
+// SendParentOrder sends parent order and returns parent_order_acceptance_id.
+func (bf *Bitflyer) SendParentOrder(order *ParentOrderRequest) (string, error) {
+	action, err := bf.beginAction(JournalSendParentOrder, order)
+	if err != nil {
+		return "", err
+	}
+	res, err := bf.callApiWithRetryBody("POST", "/v"+bf.ApiVersion+PathSendParentOrder, nil, order)
+	if err != nil {
+		bf.endAction(JournalSendParentOrder, action, nil, err)
+		return "", err
+	}
+	var orderResult map[string]string
+	err = json.Unmarshal(res, &orderResult)
+	bf.endAction(JournalSendParentOrder, action, res, err)
+	if err != nil {
+		return "", err
+	}
+	return orderResult["parent_order_acceptance_id"], nil
+}
+
+// CancelParentOrder cancels parent order.
+func (bf *Bitflyer) CancelParentOrder(productCode string, parentOrderAcceptanceId string) error {
+	params := map[string]string{
+		"product_code":               productCode,
+		"parent_order_acceptance_id": parentOrderAcceptanceId,
+	}
+	action, err := bf.beginAction(JournalCancelParentOrder, params)
+	if err != nil {
+		return err
+	}
+	res, err := bf.callApiWithRetry("POST", "/v"+bf.ApiVersion+PathCancelParentOrder, params)
+	bf.endAction(JournalCancelParentOrder, action, res, err)
+	return err
+}
+
+// GetParentOrders gets own parent orders.
+//
+// parentOrderState may be blank to get orders of all states. page may be nil.
+func (bf *Bitflyer) GetParentOrders(productCode string, parentOrderState string, page *Pagination) ([]ParentOrder, error) {
+	params := map[string]string{"product_code": productCode}
+	if parentOrderState != "" {
+		params["parent_order_state"] = parentOrderState
+	}
+	page.setParams(params)
+	res, err := bf.callApiWithRetry("GET", "/v"+bf.ApiVersion+PathGetParentOrders, params)
+	if err != nil {
+		return nil, err
+	}
+	var parentOrders []ParentOrder
+	err = json.Unmarshal(res, &parentOrders)
+	if err != nil {
+		return nil, err
+	}
+	return parentOrders, nil
+}
+
+// GetParentOrder gets detail of own parent order specified by parent_order_acceptance_id.
+func (bf *Bitflyer) GetParentOrder(parentOrderAcceptanceId string) (*ParentOrderDetail, error) {
+	params := map[string]string{"parent_order_acceptance_id": parentOrderAcceptanceId}
+	res, err := bf.callApiWithRetry("GET", "/v"+bf.ApiVersion+PathGetParentOrder, params)
+	if err != nil {
+		return nil, err
+	}
+	var detail ParentOrderDetail
+	err = json.Unmarshal(res, &detail)
+	if err != nil {
+		return nil, err
+	}
+	return &detail, nil
+}
+
+// GetAddresses gets deposit addresses of crypto currencies.
+func (bf *Bitflyer) GetAddresses() ([]Address, error) {
+	res, err := bf.callApiWithRetry("GET", "/v"+bf.ApiVersion+PathGetAddresses, nil)
+	if err != nil {
+		return nil, err
+	}
+	var addresses []Address
+	err = json.Unmarshal(res, &addresses)
+	if err != nil {
+		return nil, err
+	}
+	return addresses, nil
+}
+
+// GetCoinIns gets history of crypto currency deposits.
+//
+// page may be nil.
+func (bf *Bitflyer) GetCoinIns(page *Pagination) ([]CoinIn, error) {
+	params := map[string]string{}
+	page.setParams(params)
+	res, err := bf.callApiWithRetry("GET", "/v"+bf.ApiVersion+PathGetCoinIns, params)
+	if err != nil {
+		return nil, err
+	}
+	var coinIns []CoinIn
+	err = json.Unmarshal(res, &coinIns)
+	if err != nil {
+		return nil, err
+	}
+	return coinIns, nil
+}
+
+// GetCoinOuts gets history of crypto currency transfers.
+//
+// page may be nil.
+func (bf *Bitflyer) GetCoinOuts(page *Pagination) ([]CoinOut, error) {
+	params := map[string]string{}
+	page.setParams(params)
+	res, err := bf.callApiWithRetry("GET", "/v"+bf.ApiVersion+PathGetCoinOuts, params)
+	if err != nil {
+		return nil, err
+	}
+	var coinOuts []CoinOut
+	err = json.Unmarshal(res, &coinOuts)
+	if err != nil {
+		return nil, err
+	}
+	return coinOuts, nil
+}
+
+// GetBankAccounts gets registered bank accounts.
+func (bf *Bitflyer) GetBankAccounts() ([]BankAccount, error) {
+	res, err := bf.callApiWithRetry("GET", "/v"+bf.ApiVersion+PathGetBankAccounts, nil)
+	if err != nil {
+		return nil, err
+	}
+	var accounts []BankAccount
+	err = json.Unmarshal(res, &accounts)
+	if err != nil {
+		return nil, err
+	}
+	return accounts, nil
+}
+
+// GetDeposits gets history of cash deposits.
+//
+// page may be nil.
+func (bf *Bitflyer) GetDeposits(page *Pagination) ([]Deposit, error) {
+	params := map[string]string{}
+	page.setParams(params)
+	res, err := bf.callApiWithRetry("GET", "/v"+bf.ApiVersion+PathGetDeposits, params)
+	if err != nil {
+		return nil, err
+	}
+	var deposits []Deposit
+	err = json.Unmarshal(res, &deposits)
+	if err != nil {
+		return nil, err
+	}
+	return deposits, nil
+}
+
+// GetWithdrawals gets history of cash withdrawals.
+//
+// messageId is the value returned by Withdraw and may be blank. page may be nil.
+func (bf *Bitflyer) GetWithdrawals(messageId string, page *Pagination) ([]Withdrawal, error) {
+	params := map[string]string{}
+	if messageId != "" {
+		params["message_id"] = messageId
+	}
+	page.setParams(params)
+	res, err := bf.callApiWithRetry("GET", "/v"+bf.ApiVersion+PathGetWithdrawals, params)
+	if err != nil {
+		return nil, err
+	}
+	var withdrawals []Withdrawal
+	err = json.Unmarshal(res, &withdrawals)
+	if err != nil {
+		return nil, err
+	}
+	return withdrawals, nil
+}
+
+// Withdraw withdraws cash to the registered bank account and returns message_id.
+//
+// Withdraw returns ErrWithdrawDisabled unless Bitflyer.EnableWithdraw is true.
+// If two-factor authentication is required for withdrawals, set the code to WithdrawRequest.Code.
+// The request is never retried to avoid duplicated withdrawals.
+func (bf *Bitflyer) Withdraw(req *WithdrawRequest) (string, error) {
+	if !bf.EnableWithdraw {
+		return "", ErrWithdrawDisabled
+	}
+	if req.Amount.Sign() <= 0 {
+		return "", fmt.Errorf("amount must be positive. [%v]", req.Amount)
+	}
+	res, err := bf.callApiOnce("POST", "/v"+bf.ApiVersion+PathWithdraw, nil, req)
+	if err != nil {
+		return "", err
+	}
+	var result map[string]string
+	err = json.Unmarshal(res, &result)
+	if err != nil {
+		return "", err
+	}
+	return result["message_id"], nil
+}
+
+// CancelChildOrderByID cancels child order specified by child_order_id.
+func (bf *Bitflyer) CancelChildOrderByID(productCode string, childOrderId string) error {
+	params := map[string]string{
+		"product_code":   productCode,
+		"child_order_id": childOrderId,
+	}
+	action, err := bf.beginAction(JournalCancelChildOrder, params)
+	if err != nil {
+		return err
+	}
+	res, err := bf.callApiWithRetry("POST", "/v"+bf.ApiVersion+PathCancelChildOrder, params)
+	bf.endAction(JournalCancelChildOrder, action, res, err)
 	return err
 }
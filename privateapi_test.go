@@ -1,10 +1,16 @@
 package bitflyergo
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"reflect"
 	"testing"
+	"time"
 )
 
 const productCode = "FX_BTC_JPY"
@@ -73,3 +79,215 @@ func TestGetMeChildOrders(t *testing.T) {
 //	}
 //	fmt.Println("executions:", executions)
 //}
+
+// newTestBitflyer creates Bitflyer connecting to the test server which verifies signature of requests.
+func newTestBitflyer(t *testing.T, handler http.HandlerFunc) (*Bitflyer, *httptest.Server) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+		message := r.Header.Get("ACCESS-TIMESTAMP") + r.Method + r.URL.RequestURI() + string(body)
+		if r.Header.Get("ACCESS-KEY") != "" && sign(message, "secret") != r.Header.Get("ACCESS-SIGN") {
+			t.Errorf("invalid signature: %v", message)
+		}
+		handler(w, r)
+	}))
+	bf := NewBitflyer("key", "secret", []int{-1}, 1, 0)
+	bf.BaseUrl = server.URL
+	return bf, server
+}
+
+func TestGetBalanceHistory(t *testing.T) {
+	bf, server := newTestBitflyer(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1"+PathGetBalanceHistory {
+			t.Errorf("unexpected path: %v", r.URL.Path)
+		}
+		if r.URL.RawQuery != "before=100&count=10&currency_code=BTC" {
+			t.Errorf("unexpected query: %v", r.URL.RawQuery)
+		}
+		fmt.Fprint(w, `[{"id":99,"trade_date":"2019-10-16T14:58:22.39","product_code":"BTC_JPY",
+			"currency_code":"BTC","trade_type":"BUY","price":900000,"amount":0.001,"quantity":0.001,
+			"commission":0.0000015,"balance":1.0305,"order_id":"JOR20191016-145822-123456"}]`)
+	})
+	defer server.Close()
+
+	histories, err := bf.GetBalanceHistory("BTC", &Pagination{Count: 10, Before: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(histories) != 1 || histories[0].Commission.String() != "0.0000015" || histories[0].Balance.String() != "1.0305" {
+		t.Fatalf("%v\n", histories)
+	}
+}
+
+func TestSendParentOrder(t *testing.T) {
+	bf, server := newTestBitflyer(t, func(w http.ResponseWriter, r *http.Request) {
+		var order map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&order); err != nil {
+			t.Error(err)
+			return
+		}
+		p := order["parameters"].([]interface{})[1].(map[string]interface{})
+		if _, ok := p["price"]; ok {
+			t.Errorf("zero price must be omitted: %v", p)
+		}
+		if p["trigger_price"].(float64) != 950000 {
+			t.Errorf("unexpected trigger_price: %v", p)
+		}
+		fmt.Fprint(w, `{"parent_order_acceptance_id":"JRF20191016-123456-000001"}`)
+	})
+	defer server.Close()
+
+	id, err := bf.SendParentOrder(&ParentOrderRequest{
+		OrderMethod: OrderMethodIfd,
+		Parameters: []ParentOrderParameter{
+			{ProductCode: ProductCodeFxBtcJpy, ConditionType: ConditionTypeLimit, Side: SideBuy,
+				Size: MustParseDecimal("0.01"), Price: NewDecimalFromInt(1000000)},
+			{ProductCode: ProductCodeFxBtcJpy, ConditionType: ConditionTypeStop, Side: SideSell,
+				Size: MustParseDecimal("0.01"), TriggerPrice: NewDecimalFromInt(950000)},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != "JRF20191016-123456-000001" {
+		t.Fatalf("unexpected id: %v", id)
+	}
+}
+
+func TestWithdraw(t *testing.T) {
+	called := 0
+	bf, server := newTestBitflyer(t, func(w http.ResponseWriter, r *http.Request) {
+		called++
+		var req map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Error(err)
+			return
+		}
+		if req["code"] != "012345" || req["amount"].(float64) != 12000 {
+			t.Errorf("unexpected request: %v", req)
+		}
+		fmt.Fprint(w, `{"message_id":"69476620-5056-4003-bcbe-42658a2b041b"}`)
+	})
+	defer server.Close()
+
+	req := &WithdrawRequest{CurrencyCode: "JPY", BankAccountId: 1234, Amount: NewDecimalFromInt(12000), Code: "012345"}
+	if _, err := bf.Withdraw(req); err != ErrWithdrawDisabled {
+		t.Fatalf("Expect: %v, Actual: %v", ErrWithdrawDisabled, err)
+	}
+	if called != 0 {
+		t.Fatal("api must not be called when withdraw is disabled.")
+	}
+
+	bf.EnableWithdraw = true
+	id, err := bf.Withdraw(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != "69476620-5056-4003-bcbe-42658a2b041b" || called != 1 {
+		t.Fatalf("id: %v, called: %v", id, called)
+	}
+}
+
+func TestSendChildOrder(t *testing.T) {
+	bf, server := newTestBitflyer(t, func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		expected := `{"child_order_type":"LIMIT","price":400000,"product_code":"FX_BTC_JPY","side":"BUY","size":0.3,"time_in_force":"IOC"}`
+		if string(body) != expected {
+			t.Errorf("unexpected body: %s", body)
+		}
+		fmt.Fprint(w, `{"child_order_acceptance_id":"JRF20191016-123456-000001"}`)
+	})
+	defer server.Close()
+
+	_, err := bf.SendChildOrder(productCode, ChildOrderTypeLimit, SideBuy, 0.3,
+		map[string]string{"price": "400000", "timeinforce": "IOC"})
+	if err == nil {
+		t.Fatal("unknown parameter must be rejected.")
+	}
+	res, err := bf.SendChildOrder(productCode, ChildOrderTypeLimit, SideBuy, 0.1+0.2,
+		map[string]string{"price": "400000", "time_in_force": TimeInForceIoc})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.ChildOrderAcceptanceId != "JRF20191016-123456-000001" || res.SentAt.IsZero() || res.Latency <= 0 {
+		t.Fatalf("%v\n", res)
+	}
+}
+
+func TestPlaceChildOrderLatency(t *testing.T) {
+	called := 0
+	bf, server := newTestBitflyer(t, func(w http.ResponseWriter, r *http.Request) {
+		called++
+		if called == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprint(w, `{"status":-1,"error_message":"error"}`)
+			return
+		}
+		fmt.Fprint(w, `{"child_order_acceptance_id":"JRF20191016-123456-000001"}`)
+	})
+	defer server.Close()
+	bf.RetryInterval = 100 * time.Millisecond
+
+	st := time.Now()
+	res, err := bf.PlaceChildOrder(&ChildOrderRequest{ProductCode: productCode, ChildOrderType: ChildOrderTypeMarket,
+		Side: SideBuy, Size: MustParseDecimal("0.01")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if called != 2 || res.SentAt.Sub(st) < bf.RetryInterval || res.Latency <= 0 || res.Latency >= bf.RetryInterval {
+		t.Fatalf("latency must be of the final attempt. called: %v, ack: %v", called, res)
+	}
+}
+
+func TestSendChildOrderExtra(t *testing.T) {
+	bf, server := newTestBitflyer(t, func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		expected := `{"child_order_type":"LIMIT","new_param":"x","price":400000,"product_code":"FX_BTC_JPY","side":"BUY","size":0.3}`
+		if string(body) != expected {
+			t.Errorf("unexpected body: %s", body)
+		}
+		fmt.Fprint(w, `{"child_order_acceptance_id":"JRF20191016-123456-000001"}`)
+	})
+	defer server.Close()
+
+	req := &ChildOrderRequest{ProductCode: productCode, ChildOrderType: ChildOrderTypeLimit, Side: SideBuy,
+		Price: NewDecimalFromInt(400000), Size: MustParseDecimal("0.3"),
+		Extra: map[string]string{"new_param": "x", "side": "SELL"}}
+	if _, err := bf.PlaceChildOrder(req); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := bf.SendChildOrder(productCode, ChildOrderTypeLimit, SideBuy, 0.3,
+		map[string]string{"price": "abc"}); err == nil {
+		t.Fatal("invalid price must be rejected.")
+	}
+}
+
+func TestChildOrderRequestValidate(t *testing.T) {
+	valid := ChildOrderRequest{ProductCode: productCode, ChildOrderType: ChildOrderTypeLimit, Side: SideSell,
+		Price: NewDecimalFromInt(400000), Size: MustParseDecimal("0.01"), TimeInForce: TimeInForceFok}
+	if err := valid.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	invalids := []func(r *ChildOrderRequest){
+		func(r *ChildOrderRequest) { r.Price = Zero },
+		func(r *ChildOrderRequest) { r.ChildOrderType = ChildOrderTypeMarket },
+		func(r *ChildOrderRequest) { r.Side = "buy" },
+		func(r *ChildOrderRequest) { r.Size = MustParseDecimal("0.009") },
+		func(r *ChildOrderRequest) { r.MinuteToExpire = MaxMinuteToExpire + 1 },
+		func(r *ChildOrderRequest) { r.TimeInForce = "GTD" },
+	}
+	for i, f := range invalids {
+		r := valid
+		f(&r)
+		if err := r.Validate(); err == nil {
+			t.Fatalf("case %v must be invalid: %v", i, r)
+		}
+	}
+}
+
+func TestChildOrderFilter(t *testing.T) {
+	f := ChildOrderFilter{ProductCode: productCode, ChildOrderState: ChildOrderStateActive, Pagination: Pagination{Count: 5}}
+	if qs := makeQueryString(f.params()); qs != "?child_order_state=ACTIVE&count=5&product_code=FX_BTC_JPY" {
+		t.Fatalf("unexpected query: %v", qs)
+	}
+}
@@ -23,11 +23,45 @@ const (
 
 	// PathGetHealth is path of '/gethealth'
 	PathGetHealth = "/gethealth"
+
+	// PathGetFundingRate is path of '/getfundingrate'
+	PathGetFundingRate = "/getfundingrate"
+
+	// PathGetCorporateLeverage is path of '/getcorporateleverage'
+	PathGetCorporateLeverage = "/getcorporateleverage"
+
+	// PathGetChats is path of '/getchats'
+	PathGetChats = "/getchats"
 )
 
+// Regions of markets and chats. All regions share the same host, and the region is specified by the path.
+const (
+	// RegionJp is the region of Japan. It's the default region.
+	RegionJp = ""
+
+	// RegionUsa is the region of the United States.
+	RegionUsa = "usa"
+
+	// RegionEu is the region of Europe.
+	RegionEu = "eu"
+)
+
+// regionPath returns the path for specified region such as '/getmarkets/usa'.
+func regionPath(path string, region string) string {
+	if region == RegionJp {
+		return path
+	}
+	return path + "/" + region
+}
+
 // GetMarkets gets market information.
 func (bf *Bitflyer) GetMarkets() ([]Market, error) {
-	res, err := bf.get(bf.getUrl(PathGetMarkets), nil, bf.getDefaultHeaders())
+	return bf.GetMarketsByRegion(RegionJp)
+}
+
+// GetMarketsByRegion gets market information of specified region.
+func (bf *Bitflyer) GetMarketsByRegion(region string) ([]Market, error) {
+	res, err := bf.get(bf.getUrl(regionPath(PathGetMarkets, region)), nil, bf.getDefaultHeaders())
 	if err != nil {
 		return nil, err
 	}
@@ -128,3 +162,57 @@ func (bf *Bitflyer) GetHealth() (*Health, error) {
 	}
 	return &health, nil
 }
+
+// GetFundingRate gets funding rate of specified product_code.
+func (bf *Bitflyer) GetFundingRate(productCode string) (*FundingRate, error) {
+	params := map[string]string{"product_code": productCode}
+	res, err := bf.get(bf.getUrl(PathGetFundingRate), params, bf.getDefaultHeaders())
+	if err != nil {
+		return nil, err
+	}
+	var fundingRate FundingRate
+	err = json.Unmarshal(res, &fundingRate)
+	if err != nil {
+		return nil, err
+	}
+	return &fundingRate, nil
+}
+
+// GetCorporateLeverage gets maximum leverage for corporate accounts.
+func (bf *Bitflyer) GetCorporateLeverage() (*CorporateLeverage, error) {
+	res, err := bf.get(bf.getUrl(PathGetCorporateLeverage), nil, bf.getDefaultHeaders())
+	if err != nil {
+		return nil, err
+	}
+	var leverage CorporateLeverage
+	err = json.Unmarshal(res, &leverage)
+	if err != nil {
+		return nil, err
+	}
+	return &leverage, nil
+}
+
+// GetChats gets chats posted after fromDate.
+//
+// If fromDate is zero, chats of the last five days are returned.
+func (bf *Bitflyer) GetChats(fromDate time.Time) ([]Chat, error) {
+	return bf.GetChatsByRegion(RegionJp, fromDate)
+}
+
+// GetChatsByRegion gets chats of specified region posted after fromDate.
+func (bf *Bitflyer) GetChatsByRegion(region string, fromDate time.Time) ([]Chat, error) {
+	var params map[string]string
+	if !fromDate.IsZero() {
+		params = map[string]string{"from_date": fromDate.UTC().Format("2006-01-02T15:04:05.000")}
+	}
+	res, err := bf.get(bf.getUrl(regionPath(PathGetChats, region)), params, bf.getDefaultHeaders())
+	if err != nil {
+		return nil, err
+	}
+	var chats []Chat
+	err = json.Unmarshal(res, &chats)
+	if err != nil {
+		return nil, err
+	}
+	return chats, nil
+}
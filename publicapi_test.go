@@ -1,6 +1,9 @@
 package bitflyergo_test
 
 import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 	"time"
 
@@ -48,3 +51,54 @@ func TestGetBoardState(t *testing.T) {
 
 func TestGetHealth(t *testing.T) {
 }
+
+func TestGetMarketsByRegion(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/getmarkets/usa" {
+			t.Errorf("unexpected path: %v", r.URL.Path)
+		}
+		fmt.Fprint(w, `[{"product_code":"BTC_USD","market_type":"Spot"}]`)
+	}))
+	defer server.Close()
+
+	api := bitflyergo.NewBitflyer("", "", nil, 0, 0)
+	api.BaseUrl = server.URL
+	markets, err := api.GetMarketsByRegion(bitflyergo.RegionUsa)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(markets) != 1 || markets[0].ProductCode != "BTC_USD" {
+		t.Fatalf("%v\n", markets)
+	}
+}
+
+func TestGetFundingRateAndBoardStateData(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1" + bitflyergo.PathGetFundingRate:
+			fmt.Fprint(w, `{"current_funding_rate":-0.00375,"next_funding_rate_settledate":"2024-04-15T13:00:00"}`)
+		case "/v1" + bitflyergo.PathGetBoardState:
+			fmt.Fprint(w, `{"health":"NORMAL","state":"AWAITING_SQ","data":{"special_quotation":410897}}`)
+		default:
+			t.Errorf("unexpected path: %v", r.URL.Path)
+		}
+	}))
+	defer server.Close()
+
+	api := bitflyergo.NewBitflyer("", "", nil, 0, 0)
+	api.BaseUrl = server.URL
+	rate, err := api.GetFundingRate(bitflyergo.ProductCodeFxBtcJpy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rate.CurrentFundingRate != -0.00375 || rate.NextFundingRateSettleDate.Hour() != 13 {
+		t.Fatalf("%v\n", rate)
+	}
+	bs, err := api.GetBoardState(bitflyergo.ProductCodeBtcJpy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bs.State != bitflyergo.StateAwatingSq || bs.Data.SpecialQuotation != 410897 {
+		t.Fatalf("%v\n", bs)
+	}
+}
@@ -0,0 +1,318 @@
+// Package quote provides the engine for two-sided quoting (market making).
+//
+// Engine keeps the quotes decided by Strategy in sync with the working orders on the exchange.
+// It receives the board and child order events as bitflyergo.Callback, and every iteration of
+// its event loop applies all queued events (fills first affect the inventory) and then
+// cancels or places only the orders which differ from the desired quotes.
+package quote
+
+import (
+	"context"
+	"sync"
+
+	"github.com/mitsutoshi/bitflyergo"
+)
+
+// eventQueueSize is the capacity of the queue between the websocket and the event loop.
+const eventQueueSize = 1024
+
+// OrderClient places and cancels child orders. *bitflyergo.Bitflyer implements it.
+type OrderClient interface {
+	PlaceChildOrder(req *bitflyergo.ChildOrderRequest) (*bitflyergo.OrderAck, error)
+	CancelChildOrder(productCode string, childOrderAcceptanceId string) error
+}
+
+// Config is the configuration of Engine.
+type Config struct {
+	ProductCode      string             // product_code to quote
+	MaxPosition      bitflyergo.Decimal // absolute inventory limit. zero means no limit
+	Tolerance        bitflyergo.Decimal // working orders within this distance of the desired price are kept
+	InitialInventory bitflyergo.Decimal // inventory when the engine starts
+
+	// FairValue returns the fair value from the local board. MidPrice is used if nil.
+	FairValue func(board *bitflyergo.Board) (bitflyergo.Decimal, bool)
+
+	// OnError is called when placing or canceling order fails. It may be nil.
+	OnError func(err error)
+}
+
+// WorkingOrder is the order placed by Engine and not finished yet.
+type WorkingOrder struct {
+	ChildOrderAcceptanceId string             // child_order_acceptance_id
+	Side                   string             // side
+	Price                  bitflyergo.Decimal // price
+	Size                   bitflyergo.Decimal // size
+	Filled                 bitflyergo.Decimal // executed size
+	Canceling              bool               // true if cancel was requested
+}
+
+// Remaining returns the outstanding size.
+func (o *WorkingOrder) Remaining() bitflyergo.Decimal {
+	return o.Size.Sub(o.Filled)
+}
+
+type event struct {
+	board    *bitflyergo.Board
+	snapshot bool
+	orders   []bitflyergo.ChildOrderEvent
+}
+
+// Engine is the quoting engine.
+type Engine struct {
+	bitflyergo.NopCallback
+
+	client   OrderClient
+	config   Config
+	strategy Strategy
+	events   chan event
+
+	board *bitflyergo.Board
+
+	mu        sync.Mutex
+	inventory bitflyergo.Decimal
+	working   map[string]*WorkingOrder
+}
+
+// NewEngine creates Engine.
+func NewEngine(client OrderClient, config Config, strategy Strategy) *Engine {
+	if config.FairValue == nil {
+		config.FairValue = MidPrice
+	}
+	return &Engine{
+		client:    client,
+		config:    config,
+		strategy:  strategy,
+		events:    make(chan event, eventQueueSize),
+		board:     &bitflyergo.Board{Bids: map[float64]float64{}, Asks: map[float64]float64{}},
+		inventory: config.InitialInventory,
+		working:   map[string]*WorkingOrder{},
+	}
+}
+
+// OnReceiveBoardSnapshot replaces the local board.
+func (e *Engine) OnReceiveBoardSnapshot(channelName string, board *bitflyergo.Board) {
+	e.events <- event{board: board, snapshot: true}
+}
+
+// OnReceiveBoard applies the difference to the local board.
+func (e *Engine) OnReceiveBoard(channelName string, board *bitflyergo.Board) {
+	e.events <- event{board: board}
+}
+
+// OnReceiveChildOrderEvents applies fills to the inventory and the working orders.
+func (e *Engine) OnReceiveChildOrderEvents(channelName string, events []bitflyergo.ChildOrderEvent) {
+	e.events <- event{orders: events}
+}
+
+// Run runs the event loop until ctx is done. Working orders are canceled when it returns.
+func (e *Engine) Run(ctx context.Context) error {
+	for {
+		select {
+		case <-ctx.Done():
+			e.CancelAll()
+			return ctx.Err()
+		case ev := <-e.events:
+			e.apply(ev)
+		drain:
+			for {
+				select {
+				case ev := <-e.events:
+					e.apply(ev)
+				default:
+					break drain
+				}
+			}
+			e.reconcile()
+		}
+	}
+}
+
+// Inventory returns the current inventory.
+func (e *Engine) Inventory() bitflyergo.Decimal {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.inventory
+}
+
+// WorkingOrders returns the copy of working orders.
+func (e *Engine) WorkingOrders() []WorkingOrder {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	orders := make([]WorkingOrder, 0, len(e.working))
+	for _, o := range e.working {
+		orders = append(orders, *o)
+	}
+	return orders
+}
+
+// CancelAll cancels all working orders.
+func (e *Engine) CancelAll() {
+	for _, o := range e.WorkingOrders() {
+		if !o.Canceling {
+			e.cancel(o.ChildOrderAcceptanceId)
+		}
+	}
+}
+
+// apply applies the event to the local board and the working orders.
+func (e *Engine) apply(ev event) {
+	if ev.board != nil {
+		if ev.snapshot {
+			e.board = &bitflyergo.Board{Bids: map[float64]float64{}, Asks: map[float64]float64{}}
+		}
+		e.board.Merge(ev.board)
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, oe := range ev.orders {
+
+		// events of own orders never precede their registration because orders are placed
+		// in the event loop, so the events of unknown orders are of the other orders
+		if _, ok := e.working[oe.ChildOrderAcceptanceId]; !ok {
+			continue
+		}
+		e.applyOrderEvent(oe)
+	}
+}
+
+// applyOrderEvent applies the event of the working order. e.mu must be held.
+func (e *Engine) applyOrderEvent(oe bitflyergo.ChildOrderEvent) {
+	o := e.working[oe.ChildOrderAcceptanceId]
+	switch oe.EventType {
+	case bitflyergo.EventTypeExecution:
+		o.Filled = o.Filled.Add(oe.Size)
+		if o.Side == bitflyergo.SideBuy {
+			e.inventory = e.inventory.Add(oe.Size)
+		} else {
+			e.inventory = e.inventory.Sub(oe.Size)
+		}
+		if !o.Filled.LessThan(o.Size) {
+			delete(e.working, oe.ChildOrderAcceptanceId)
+		}
+	case bitflyergo.EventTypeCancel, bitflyergo.EventTypeExpire, bitflyergo.EventTypeOrderFailed:
+		delete(e.working, oe.ChildOrderAcceptanceId)
+	case bitflyergo.EventTypeCancelFailed:
+		o.Canceling = false
+	}
+}
+
+// reconcile cancels the working orders which aren't desired and places the missing quotes.
+func (e *Engine) reconcile() {
+	fair, ok := e.config.FairValue(e.board)
+	if !ok {
+		return
+	}
+
+	e.mu.Lock()
+	desired := e.strategy.Quotes(fair, e.inventory)
+	var cancels []string
+	kept := make([]bool, len(desired))
+	for id, o := range e.working {
+		if o.Canceling {
+			continue
+		}
+		matched := false
+		for i, q := range desired {
+			if !kept[i] && q.Side == o.Side && q.Price.Sub(o.Price).Abs().Cmp(e.config.Tolerance) <= 0 {
+				kept[i] = true
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			o.Canceling = true
+			cancels = append(cancels, id)
+		}
+	}
+	var places []Quote
+	for i, q := range desired {
+		if !kept[i] {
+			places = append(places, q)
+		}
+	}
+	places = e.limitInventory(places)
+	e.mu.Unlock()
+
+	for _, id := range cancels {
+		e.cancel(id)
+	}
+	for _, q := range places {
+		e.place(q)
+	}
+}
+
+// limitInventory removes or shrinks the new quotes which could make the inventory exceed MaxPosition
+// even if all working orders, including the ones being canceled, are filled. e.mu must be held.
+func (e *Engine) limitInventory(quotes []Quote) []Quote {
+	if e.config.MaxPosition.Sign() <= 0 {
+		return quotes
+	}
+	long := e.config.MaxPosition.Sub(e.inventory)
+	short := e.config.MaxPosition.Add(e.inventory)
+	for _, o := range e.working {
+		if o.Side == bitflyergo.SideBuy {
+			long = long.Sub(o.Remaining())
+		} else {
+			short = short.Sub(o.Remaining())
+		}
+	}
+	min := bitflyergo.NewDecimalFromFloat(bitflyergo.MinimumOrderbleSize)
+	var limited []Quote
+	for _, q := range quotes {
+		room := &long
+		if q.Side == bitflyergo.SideSell {
+			room = &short
+		}
+		if q.Size.GreaterThan(*room) {
+			q.Size = room.Truncate(2)
+		}
+		if q.Size.LessThan(min) {
+			continue
+		}
+		*room = room.Sub(q.Size)
+		limited = append(limited, q)
+	}
+	return limited
+}
+
+// place places the quote and registers it as working order.
+func (e *Engine) place(q Quote) {
+	ack, err := e.client.PlaceChildOrder(&bitflyergo.ChildOrderRequest{
+		ProductCode:    e.config.ProductCode,
+		ChildOrderType: bitflyergo.ChildOrderTypeLimit,
+		Side:           q.Side,
+		Price:          q.Price,
+		Size:           q.Size,
+	})
+	if err != nil {
+		e.onError(err)
+		return
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.working[ack.ChildOrderAcceptanceId] = &WorkingOrder{
+		ChildOrderAcceptanceId: ack.ChildOrderAcceptanceId,
+		Side:                   q.Side,
+		Price:                  q.Price,
+		Size:                   q.Size,
+	}
+}
+
+func (e *Engine) cancel(id string) {
+	if err := e.client.CancelChildOrder(e.config.ProductCode, id); err != nil {
+		e.mu.Lock()
+		if o, ok := e.working[id]; ok {
+			o.Canceling = false
+		}
+		e.mu.Unlock()
+		e.onError(err)
+	}
+}
+
+func (e *Engine) onError(err error) {
+	if e.config.OnError != nil {
+		e.config.OnError(err)
+	}
+}
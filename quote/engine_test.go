@@ -0,0 +1,86 @@
+package quote
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/mitsutoshi/bitflyergo"
+)
+
+type fakeClient struct {
+	orders   []bitflyergo.ChildOrderRequest
+	canceled []string
+}
+
+func (c *fakeClient) PlaceChildOrder(req *bitflyergo.ChildOrderRequest) (*bitflyergo.OrderAck, error) {
+	c.orders = append(c.orders, *req)
+	return &bitflyergo.OrderAck{ChildOrderAcceptanceId: fmt.Sprintf("JRF-%d", len(c.orders))}, nil
+}
+
+func (c *fakeClient) CancelChildOrder(productCode string, childOrderAcceptanceId string) error {
+	c.canceled = append(c.canceled, childOrderAcceptanceId)
+	return nil
+}
+
+func dec(s string) bitflyergo.Decimal {
+	return bitflyergo.MustParseDecimal(s)
+}
+
+func newTestEngine(client *fakeClient) *Engine {
+	return NewEngine(client, Config{
+		ProductCode: bitflyergo.ProductCodeFxBtcJpy,
+		MaxPosition: dec("0.15"),
+		Tolerance:   dec("2"),
+	}, SpreadStrategy{HalfSpread: dec("100"), Size: dec("0.1"), Skew: dec("1000"), TickSize: dec("1")})
+}
+
+func TestReconcile(t *testing.T) {
+	client := &fakeClient{}
+	e := newTestEngine(client)
+
+	e.apply(event{board: &bitflyergo.Board{Bids: map[float64]float64{999900: 1}, Asks: map[float64]float64{1000100: 1}}, snapshot: true})
+	e.reconcile()
+	if len(client.orders) != 2 || client.orders[0].Price.String() != "999900" || client.orders[1].Price.String() != "1000100" {
+		t.Fatalf("%v\n", client.orders)
+	}
+
+	// small move within tolerance doesn't cause any api call
+	e.apply(event{board: &bitflyergo.Board{Bids: map[float64]float64{999902: 1}}})
+	e.reconcile()
+	if len(client.orders) != 2 || len(client.canceled) != 0 {
+		t.Fatalf("orders: %v, canceled: %v", client.orders, client.canceled)
+	}
+
+	// the fill of bid changes inventory and both quotes are skewed in the same iteration
+	e.apply(event{orders: []bitflyergo.ChildOrderEvent{
+		{ChildOrderAcceptanceId: "JRF-1", EventType: bitflyergo.EventTypeExecution, Price: dec("999900"), Size: dec("0.1")},
+	}})
+	e.reconcile()
+	if e.Inventory().String() != "0.1" {
+		t.Fatalf("inventory: %v", e.Inventory())
+	}
+	if len(client.canceled) != 1 || client.canceled[0] != "JRF-2" {
+		t.Fatalf("canceled: %v", client.canceled)
+	}
+
+	// bid is limited by MaxPosition and the ask is placed at the skewed price
+	if len(client.orders) != 4 {
+		t.Fatalf("%v\n", client.orders)
+	}
+	bid, ask := client.orders[2], client.orders[3]
+	if bid.Side == bitflyergo.SideSell {
+		bid, ask = ask, bid
+	}
+	if bid.Size.String() != "0.05" || bid.Price.String() != "999801" || ask.Price.String() != "1000001" {
+		t.Fatalf("bid: %v, ask: %v", bid, ask)
+	}
+}
+
+func TestRoundToTick(t *testing.T) {
+	if p := roundToTick(dec("1000000.4"), dec("1"), false).String(); p != "1000000" {
+		t.Fatalf("Expect: 1000000, Actual: %v", p)
+	}
+	if p := roundToTick(dec("1000000.4"), dec("1"), true).String(); p != "1000001" {
+		t.Fatalf("Expect: 1000001, Actual: %v", p)
+	}
+}
@@ -0,0 +1,72 @@
+package quote
+
+import (
+	"github.com/mitsutoshi/bitflyergo"
+)
+
+// Quote is the order which the engine keeps on the board.
+type Quote struct {
+	Side  string             // side, SideBuy or SideSell
+	Price bitflyergo.Decimal // price
+	Size  bitflyergo.Decimal // size
+}
+
+// Strategy decides the quotes from the fair value and the current inventory.
+//
+// Inventory is positive when long and negative when short.
+type Strategy interface {
+	Quotes(fair bitflyergo.Decimal, inventory bitflyergo.Decimal) []Quote
+}
+
+// StrategyFunc is the function implementing Strategy.
+type StrategyFunc func(fair bitflyergo.Decimal, inventory bitflyergo.Decimal) []Quote
+
+// Quotes calls f.
+func (f StrategyFunc) Quotes(fair bitflyergo.Decimal, inventory bitflyergo.Decimal) []Quote {
+	return f(fair, inventory)
+}
+
+// SpreadStrategy quotes one bid and one ask around the fair value.
+//
+// Both prices are shifted by Skew per 1 unit of inventory to reduce the position,
+// e.g. when long, the quotes are lowered so that the ask is more likely to be filled.
+type SpreadStrategy struct {
+	HalfSpread bitflyergo.Decimal // distance from the fair value
+	Size       bitflyergo.Decimal // size of each quote
+	Skew       bitflyergo.Decimal // price shift per 1 unit of inventory
+	TickSize   bitflyergo.Decimal // price unit. bid is rounded down and ask is rounded up
+}
+
+// Quotes returns bid and ask.
+func (s SpreadStrategy) Quotes(fair bitflyergo.Decimal, inventory bitflyergo.Decimal) []Quote {
+	center := fair.Sub(s.Skew.Mul(inventory))
+	bid := roundToTick(center.Sub(s.HalfSpread), s.TickSize, false)
+	ask := roundToTick(center.Add(s.HalfSpread), s.TickSize, true)
+	return []Quote{
+		{Side: bitflyergo.SideBuy, Price: bid, Size: s.Size},
+		{Side: bitflyergo.SideSell, Price: ask, Size: s.Size},
+	}
+}
+
+// roundToTick rounds price to the multiple of tick.
+func roundToTick(price bitflyergo.Decimal, tick bitflyergo.Decimal, up bool) bitflyergo.Decimal {
+	if tick.Sign() <= 0 {
+		return price
+	}
+	n := bitflyergo.NewDecimalFromInt(price.Div(tick).IntPart())
+	rounded := n.Mul(tick)
+	if up && rounded.LessThan(price) {
+		rounded = rounded.Add(tick)
+	}
+	return rounded
+}
+
+// MidPrice returns the middle of the best bid and the best ask as the fair value.
+func MidPrice(board *bitflyergo.Board) (bitflyergo.Decimal, bool) {
+	bid, _, bidOk := board.BestBid()
+	ask, _, askOk := board.BestAsk()
+	if !bidOk || !askOk {
+		return bitflyergo.Zero, false
+	}
+	return bitflyergo.NewDecimalFromFloat(bid).Add(bitflyergo.NewDecimalFromFloat(ask)).Div(bitflyergo.NewDecimalFromInt(2)), true
+}
@@ -0,0 +1,76 @@
+package bitflyergo
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultRateLimit  = 500             // default number of requests per DefaultRatePeriod
+	DefaultRatePeriod = 5 * time.Minute // period of the API limit of bitFlyer
+)
+
+// RateLimiter limits the rate of requests.
+type RateLimiter interface {
+
+	// Wait blocks until a request can be sent or ctx is done.
+	Wait(ctx context.Context) error
+}
+
+// TokenBucket is the RateLimiter which allows limit requests per period with bursts up to limit.
+type TokenBucket struct {
+	capacity float64
+	rate     float64 // tokens per second
+	now      func() time.Time
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+// NewRateLimiter creates TokenBucket which allows limit requests per period.
+func NewRateLimiter(limit int, period time.Duration) *TokenBucket {
+	return &TokenBucket{
+		capacity: float64(limit),
+		rate:     float64(limit) / period.Seconds(),
+		now:      time.Now,
+		tokens:   float64(limit),
+	}
+}
+
+// Wait takes a token, waiting until it's available.
+func (b *TokenBucket) Wait(ctx context.Context) error {
+	for {
+		wait := b.take()
+		if wait <= 0 {
+			return nil
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// take takes a token if it's available, otherwise returns the time until it's available.
+func (b *TokenBucket) take() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := b.now()
+	if !b.last.IsZero() {
+		b.tokens += now.Sub(b.last).Seconds() * b.rate
+		if b.tokens > b.capacity {
+			b.tokens = b.capacity
+		}
+	}
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return 0
+	}
+	return time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+}
@@ -0,0 +1,91 @@
+package bitflyergo
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestTokenBucket(t *testing.T) {
+	now := time.Date(2019, 10, 16, 12, 0, 0, 0, time.UTC)
+	b := NewRateLimiter(2, time.Second)
+	b.now = func() time.Time { return now }
+
+	// burst up to the limit
+	for i := 0; i < 2; i++ {
+		if wait := b.take(); wait != 0 {
+			t.Errorf("request %v waits %v", i, wait)
+		}
+	}
+	if wait := b.take(); wait != 500*time.Millisecond {
+		t.Errorf("unexpected wait: %v", wait)
+	}
+
+	// a token is refilled every 500ms
+	now = now.Add(500 * time.Millisecond)
+	if wait := b.take(); wait != 0 {
+		t.Errorf("token was not refilled: %v", wait)
+	}
+
+	// tokens don't exceed the limit
+	now = now.Add(time.Hour)
+	b.take()
+	b.take()
+	if wait := b.take(); wait <= 0 {
+		t.Errorf("tokens exceeded the limit")
+	}
+}
+
+func TestTokenBucketWait(t *testing.T) {
+	b := NewRateLimiter(1, 100*time.Millisecond)
+	ctx := context.Background()
+	if err := b.Wait(ctx); err != nil {
+		t.Fatal(err)
+	}
+	started := time.Now()
+	if err := b.Wait(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(started); elapsed < 80*time.Millisecond {
+		t.Errorf("request was not limited: %v", elapsed)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	if err := b.Wait(ctx); err != context.DeadlineExceeded {
+		t.Errorf("expected DeadlineExceeded: %v", err)
+	}
+}
+
+// orderRecorder records the order of waiting for the rate limit and signing.
+type orderRecorder struct {
+	events []string
+}
+
+func (r *orderRecorder) Wait(ctx context.Context) error {
+	r.events = append(r.events, "wait")
+	return nil
+}
+
+func (r *orderRecorder) Credentials() (Credentials, error) {
+	r.events = append(r.events, "sign")
+	return Credentials{ApiKey: "key", ApiSecret: "secret"}, nil
+}
+
+func TestRateLimitBeforeSigning(t *testing.T) {
+	bf, server := newTestBitflyer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`[]`))
+	})
+	defer server.Close()
+	recorder := &orderRecorder{}
+	bf.RateLimiter = recorder
+	bf.Credentials = recorder
+
+	if _, err := bf.GetPositions(productCode); err != nil {
+		t.Fatal(err)
+	}
+	if len(recorder.events) != 2 || recorder.events[0] != "wait" || recorder.events[1] != "sign" {
+		t.Errorf("unexpected order: %v", recorder.events)
+	}
+}
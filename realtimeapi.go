@@ -1,11 +1,13 @@
 package bitflyergo
 
 import (
+	"context"
 	"encoding/hex"
+	"errors"
 	"fmt"
-	url2 "net/url"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"crypto/rand"
@@ -23,7 +25,33 @@ const (
 	channelTicker        = "lightning_ticker_"
 	channelChildOrder    = "child_order_events"
 	channelParentOrder   = "parent_order_events"
-	authJsonRpcId        = 1
+)
+
+// Private channels subscribed after authentication.
+const (
+	ChannelChildOrderEvents  = channelChildOrder  // child order events
+	ChannelParentOrderEvents = channelParentOrder // parent order events
+)
+
+// DefaultEndpointUrl is the url of bitflyer's realtime api server.
+const DefaultEndpointUrl = "wss://" + url + "/json-rpc"
+
+// ErrClosed is returned when WebSocketClient sends a message after Close.
+var ErrClosed = errors.New("websocket client is closed")
+
+// ErrStillReceiving is returned by Connect when Receive hasn't returned yet after Close.
+var ErrStillReceiving = errors.New("websocket client is still receiving after Close")
+
+// Event types of child order events and parent order events.
+const (
+	EventTypeOrder        = "ORDER"         // event type: ORDER
+	EventTypeOrderFailed  = "ORDER_FAILED"  // event type: ORDER_FAILED
+	EventTypeCancel       = "CANCEL"        // event type: CANCEL
+	EventTypeCancelFailed = "CANCEL_FAILED" // event type: CANCEL_FAILED
+	EventTypeExecution    = "EXECUTION"     // event type: EXECUTION
+	EventTypeExpire       = "EXPIRE"        // event type: EXPIRE
+	EventTypeTrigger      = "TRIGGER"       // event type: TRIGGER, only for parent order
+	EventTypeComplete     = "COMPLETE"      // event type: COMPLETE, only for parent order
 )
 
 type subscribeParams struct {
@@ -48,6 +76,67 @@ type WebSocketClient struct {
 	Con   *websocket.Conn
 	Debug bool
 	Cb    Callback
+
+	// EndpointUrl is the url of realtime api server, e.g. the url of a local stand-in.
+	// DefaultEndpointUrl is used if blank.
+	EndpointUrl string
+
+	// Dialer is used to connect the server. Set Proxy, TLSClientConfig, HandshakeTimeout, ReadBufferSize,
+	// WriteBufferSize and EnableCompression (permessage-deflate) of it as needed.
+	// websocket.DefaultDialer is used if nil.
+	Dialer *websocket.Dialer
+
+	// Logger is the logger of this client. The default logger is used if nil.
+	Logger LeveledLogger
+
+	// Metrics receives the measurements of messages if it's not nil.
+	Metrics Metrics
+
+	// Recorder records every raw message with its receive time if it's not nil, e.g. StreamRecorder.
+	Recorder MessageRecorder
+
+	// Clock is used to sign auth and observes ticker timestamps. Local time is used if nil.
+	// Set the same Clock as Bitflyer.Clock to share the offset.
+	Clock *Clock
+
+	// PingInterval is the interval of pings, e.g. DefaultPingInterval. Pings aren't sent if zero or negative.
+	PingInterval time.Duration
+
+	// ReadTimeout is the time to wait for a message or a pong before Receive fails, e.g. DefaultReadTimeout.
+	// It waits forever if zero or negative.
+	ReadTimeout time.Duration
+
+	// WriteTimeout is the time to wait for writing a message.
+	// DefaultWriteTimeout is used if zero, and it waits forever if negative.
+	WriteTimeout time.Duration
+
+	// StaleTimeouts is the time after which the subscribed channel is stale if nothing is received.
+	// The key is the channel name or its prefix, e.g. "lightning_executions_FX_BTC_JPY" or "lightning_executions_".
+	// Stale channels are notified to Cb if it implements StaleCallback.
+	StaleTimeouts map[string]time.Duration
+
+	// Reconnect makes Receive reconnect when reading fails or a channel is stale, instead of returning.
+	// The subscribed channels are subscribed again, and private ones after authenticating again.
+	// If the authentication fails or isn't answered within DefaultReauthTimeout,
+	// OnErrorOccur is called with each private channel which isn't subscribed again.
+	Reconnect bool
+
+	// ReconnectInterval is the interval of reconnecting. DefaultReconnectInterval is used if zero.
+	ReconnectInterval time.Duration
+
+	// AuthChannels is the private channels subscribed when authentication succeeds.
+	// ChannelChildOrderEvents is subscribed if nil, and nothing is subscribed if empty.
+	AuthChannels []string
+
+	mu          sync.Mutex
+	writeMu     sync.Mutex    // serializes writes to Con
+	closing     chan struct{} // closed by Close
+	receiveDone chan struct{} // closed when Receive returns
+	feeds       feedState
+	provider    CredentialsProvider
+	lastID      int                  // id of the last JSON-RPC call
+	pending     map[int]*pendingCall // JSON-RPC calls waiting for the response
+	replaying   bool                 // Replay is dispatching recorded messages
 }
 
 // Callback is the callback functions when receiving data from websocket.
@@ -75,6 +164,82 @@ type Callback interface {
 	OnErrorOccur(channelName string, err error)
 }
 
+// NopCallback is Callback doing nothing. Embed it to implement only the callbacks you need.
+type NopCallback struct{}
+
+// OnReceiveBoard does nothing.
+func (NopCallback) OnReceiveBoard(channelName string, board *Board) {}
+
+// OnReceiveBoardSnapshot does nothing.
+func (NopCallback) OnReceiveBoardSnapshot(channelName string, board *Board) {}
+
+// OnReceiveExecutions does nothing.
+func (NopCallback) OnReceiveExecutions(channelName string, executions []Execution) {}
+
+// OnReceiveTicker does nothing.
+func (NopCallback) OnReceiveTicker(channelName string, ticker *Ticker) {}
+
+// OnReceiveChildOrderEvents does nothing.
+func (NopCallback) OnReceiveChildOrderEvents(channelName string, event []ChildOrderEvent) {}
+
+// OnReceiveParentOrderEvents does nothing.
+func (NopCallback) OnReceiveParentOrderEvents(channelName string, event []ParentOrderEvent) {}
+
+// OnErrorOccur does nothing.
+func (NopCallback) OnErrorOccur(channelName string, err error) {}
+
+// MultiCallback is Callback calling all of the callbacks in order.
+type MultiCallback []Callback
+
+// OnReceiveBoard calls OnReceiveBoard of all callbacks.
+func (cbs MultiCallback) OnReceiveBoard(channelName string, board *Board) {
+	for _, cb := range cbs {
+		cb.OnReceiveBoard(channelName, board)
+	}
+}
+
+// OnReceiveBoardSnapshot calls OnReceiveBoardSnapshot of all callbacks.
+func (cbs MultiCallback) OnReceiveBoardSnapshot(channelName string, board *Board) {
+	for _, cb := range cbs {
+		cb.OnReceiveBoardSnapshot(channelName, board)
+	}
+}
+
+// OnReceiveExecutions calls OnReceiveExecutions of all callbacks.
+func (cbs MultiCallback) OnReceiveExecutions(channelName string, executions []Execution) {
+	for _, cb := range cbs {
+		cb.OnReceiveExecutions(channelName, executions)
+	}
+}
+
+// OnReceiveTicker calls OnReceiveTicker of all callbacks.
+func (cbs MultiCallback) OnReceiveTicker(channelName string, ticker *Ticker) {
+	for _, cb := range cbs {
+		cb.OnReceiveTicker(channelName, ticker)
+	}
+}
+
+// OnReceiveChildOrderEvents calls OnReceiveChildOrderEvents of all callbacks.
+func (cbs MultiCallback) OnReceiveChildOrderEvents(channelName string, event []ChildOrderEvent) {
+	for _, cb := range cbs {
+		cb.OnReceiveChildOrderEvents(channelName, event)
+	}
+}
+
+// OnReceiveParentOrderEvents calls OnReceiveParentOrderEvents of all callbacks.
+func (cbs MultiCallback) OnReceiveParentOrderEvents(channelName string, event []ParentOrderEvent) {
+	for _, cb := range cbs {
+		cb.OnReceiveParentOrderEvents(channelName, event)
+	}
+}
+
+// OnErrorOccur calls OnErrorOccur of all callbacks.
+func (cbs MultiCallback) OnErrorOccur(channelName string, err error) {
+	for _, cb := range cbs {
+		cb.OnErrorOccur(channelName, err)
+	}
+}
+
 // ChildOrderEvent is type of child order event receiving from websocket.
 type ChildOrderEvent struct {
 	ProductCode            string         `json:"product_code"`              // product_code
@@ -87,10 +252,10 @@ type ChildOrderEvent struct {
 	Reason                 string         `json:"reason"`                    // reason
 	ExecId                 int            `json:"exec_id"`                   // exec_id
 	Side                   string         `json:"side"`                      // side
-	Price                  int            `json:"price"`                     // price
-	Size                   float64        `json:"size"`                      // size
-	Commission             float64        `json:"commission"`                // commission
-	Sfd                    float64        `json:"sfd"`                       // sfd
+	Price                  Decimal        `json:"price"`                     // price
+	Size                   Decimal        `json:"size"`                      // size
+	Commission             Decimal        `json:"commission"`                // commission
+	Sfd                    Decimal        `json:"sfd"`                       // sfd
 }
 
 type EventTime struct {
@@ -142,265 +307,573 @@ type ParentOrderEvent struct {
 	ParameterIndex          int            `json:"parameter_index"`            // parameter_index
 	ChildOrderAcceptanceId  string         `json:"child_order_acceptance_id"`  // child_order_acceptance_id
 	Side                    string         `json:"side"`                       // side
-	Price                   int            `json:"price"`                      // price
-	Size                    float64        `json:"size"`                       // size
+	Price                   Decimal        `json:"price"`                      // price
+	Size                    Decimal        `json:"size"`                       // size
 	ExpireDate              TimeWithSecond `json:"expire_date"`                // expire_date
 }
 
 // Connect connects to bitflyer's realtime api server.
+//
+// WebSocketClient is safe for concurrent use after Connect, except for changing its fields.
+//
+// After Close, it returns ErrStillReceiving until Receive returns, not to be used by Receive reconnecting.
 func (bf *WebSocketClient) Connect() error {
-	url := url2.URL{Scheme: "wss", Host: url, Path: "/json-rpc"}
-	con, _, err := websocket.DefaultDialer.Dial(url.String(), nil)
+	bf.mu.Lock()
+	if bf.closing != nil && bf.receiveDone != nil {
+		select {
+		case <-bf.closing:
+			select {
+			case <-bf.receiveDone:
+			default:
+				bf.mu.Unlock()
+				return ErrStillReceiving
+			}
+		default:
+		}
+	}
+	bf.closing = nil
+	bf.mu.Unlock()
+	return bf.connect()
+}
+
+// connect dials the server and replaces Con.
+func (bf *WebSocketClient) connect() error {
+	endpoint := bf.EndpointUrl
+	if endpoint == "" {
+		endpoint = DefaultEndpointUrl
+	}
+	dialer := bf.Dialer
+	if dialer == nil {
+		dialer = websocket.DefaultDialer
+	}
+	con, res, err := dialer.Dial(endpoint, nil)
 	if err != nil {
+		if res != nil {
+			return fmt.Errorf("failed to connect %v: %v (status=%v)", endpoint, err, res.Status)
+		}
 		return err
 	}
+	bf.mu.Lock()
 	bf.Con = con
+	bf.mu.Unlock()
 	return nil
 }
 
+// conn returns the current connection.
+func (bf *WebSocketClient) conn() *websocket.Conn {
+	bf.mu.Lock()
+	defer bf.mu.Unlock()
+	return bf.Con
+}
+
+// closingChan returns the channel closed by Close. bf.mu must be held.
+func (bf *WebSocketClient) closingChan() chan struct{} {
+	if bf.closing == nil {
+		bf.closing = make(chan struct{})
+	}
+	return bf.closing
+}
+
+// isClosing returns true if Close has been called.
+func (bf *WebSocketClient) isClosing() bool {
+	bf.mu.Lock()
+	closing := bf.closingChan()
+	bf.mu.Unlock()
+	select {
+	case <-closing:
+		return true
+	default:
+		return false
+	}
+}
+
+// Close sends close frame to the server, and waits until Receive returns, that is,
+// the callbacks in progress finish, until ctx is done. Then the connection is closed.
+//
+// Don't call it from a callback, because Receive can't return until the callback returns,
+// so it would wait until ctx is done. Use CloseAsync instead.
+//
+// Receive doesn't reconnect after Close, and writing messages returns ErrClosed. Call Connect to use the client again.
+func (bf *WebSocketClient) Close(ctx context.Context) error {
+	return bf.close(ctx, true)
+}
+
+// CloseAsync is Close without waiting for Receive, which can be called from a callback.
+//
+// Receive returns after the callback in progress, dropping the messages not dispatched yet.
+func (bf *WebSocketClient) CloseAsync() error {
+	return bf.close(context.Background(), false)
+}
+
+// close sends close frame and closes the connection, after waiting for Receive if wait is true.
+func (bf *WebSocketClient) close(ctx context.Context, wait bool) error {
+	bf.mu.Lock()
+	closing := bf.closingChan()
+	select {
+	case <-closing:
+		bf.mu.Unlock()
+		return nil
+	default:
+	}
+	close(closing)
+	con, receiveDone := bf.Con, bf.receiveDone
+	bf.mu.Unlock()
+	if con == nil {
+		return nil
+	}
+
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = bf.writeDeadline()
+	}
+	message := websocket.FormatCloseMessage(websocket.CloseNormalClosure, "")
+	if err := con.WriteControl(websocket.CloseMessage, message, deadline); err != nil && err != websocket.ErrCloseSent {
+		bf.logger().Warn("failed to send close frame", "error", err)
+	}
+	if wait && receiveDone != nil {
+		select {
+		case <-receiveDone:
+		case <-ctx.Done():
+			con.Close()
+			return ctx.Err()
+		}
+	}
+	return con.Close()
+}
+
 // Auth authenticates client to subscribe private channels.
 func (bf *WebSocketClient) Auth(apiKey string, apiSecret string) error {
+	return bf.AuthWithProvider(StaticCredentials{ApiKey: apiKey, ApiSecret: apiSecret})
+}
+
+// AuthWithProvider authenticates client with the current credentials of provider.
+//
+// It doesn't wait for the result, which is notified to Cb if it implements AuthCallback. See AuthContext to wait for it.
+func (bf *WebSocketClient) AuthWithProvider(provider CredentialsProvider) error {
+	_, err := bf.auth(provider, false)
+	return err
+}
+
+// auth sends auth request with the credentials of provider.
+func (bf *WebSocketClient) auth(provider CredentialsProvider, wait bool) (*pendingCall, error) {
+	c, err := provider.Credentials()
+	if err != nil {
+		return nil, err
+	}
+	bf.mu.Lock()
+	bf.provider = provider
+	bf.mu.Unlock()
 
 	// create message
-	timestamp := time.Now().UnixNano() / int64(time.Millisecond)
+	timestamp := bf.Clock.Now().UnixNano() / int64(time.Millisecond)
 	nonce, err := randomHex(16)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	message := strconv.FormatInt(timestamp, 10) + nonce
 
-	// signed message
-	jsonRpc := &jsonRPC2{
-		Version: "2.0",
-		Method:  "auth",
-		Params: authParams{
-			ApiKey:    apiKey,
-			Timestamp: timestamp,
-			Nonce:     nonce,
-			Signature: sign(message, apiSecret),
-		},
-		Id: authJsonRpcId,
-	}
-
-	// send
-	if err := bf.Con.WriteJSON(&jsonRpc); err != nil {
-		return err
-	}
-	return nil
+	// send signed message
+	return bf.call("auth", authParams{
+		ApiKey:    c.ApiKey,
+		Timestamp: timestamp,
+		Nonce:     nonce,
+		Signature: sign(message, c.ApiSecret),
+	}, "", wait)
 }
 
 // SubscribeTicker subscribes ticker.
-func (bf *WebSocketClient) SubscribeTicker(symbol string) {
-	bf.subscribe(channelTicker + symbol)
+func (bf *WebSocketClient) SubscribeTicker(symbol string) error {
+	return bf.subscribe(channelTicker + symbol)
 }
 
 // SubscribeExecutions subscribes executions.
-func (bf *WebSocketClient) SubscribeExecutions(symbol string) {
-	bf.subscribe(channelExecutions + symbol)
+func (bf *WebSocketClient) SubscribeExecutions(symbol string) error {
+	return bf.subscribe(channelExecutions + symbol)
 }
 
 // SubscribeBoard subscribes board.
-func (bf *WebSocketClient) SubscribeBoard(symbol string) {
-	bf.subscribe(channelBoard + symbol)
+func (bf *WebSocketClient) SubscribeBoard(symbol string) error {
+	return bf.subscribe(channelBoard + symbol)
 }
 
 // SubscribeBoardSnapshot subscribes board snapshot.
-func (bf *WebSocketClient) SubscribeBoardSnapshot(symbol string) {
-	bf.subscribe(channelBoardSnapshot + symbol)
+func (bf *WebSocketClient) SubscribeBoardSnapshot(symbol string) error {
+	return bf.subscribe(channelBoardSnapshot + symbol)
 }
 
 // SubscribeChildOrder subscribes child orders.
-func (bf *WebSocketClient) SubscribeChildOrder() {
-	bf.subscribe(channelChildOrder)
+func (bf *WebSocketClient) SubscribeChildOrder() error {
+	return bf.subscribe(channelChildOrder)
 }
 
 // SubscribeParentOrder subscribes parent orders.
-func (bf *WebSocketClient) SubscribeParentOrder() {
-	bf.subscribe(channelParentOrder)
+func (bf *WebSocketClient) SubscribeParentOrder() error {
+	return bf.subscribe(channelParentOrder)
 }
 
 // UnsubscribeTicker unsubscribes 'lightning_ticker_${symbol}'.
-func (bf *WebSocketClient) UnsubscribeTicker(symbol string) {
-	bf.unsubscribe(channelTicker + symbol)
+func (bf *WebSocketClient) UnsubscribeTicker(symbol string) error {
+	return bf.unsubscribe(channelTicker + symbol)
 }
 
 // UnsubscribeExecutions unsubscribes 'lightning_executions_${symbol}'.
-func (bf *WebSocketClient) UnsubscribeExecutions(symbol string) {
-	bf.unsubscribe(channelExecutions + symbol)
+func (bf *WebSocketClient) UnsubscribeExecutions(symbol string) error {
+	return bf.unsubscribe(channelExecutions + symbol)
 }
 
-func (bf *WebSocketClient) UnsubscribeBoard(symbol string) {
-	bf.unsubscribe(channelBoard + symbol)
+// UnsubscribeBoard unsubscribes 'lightning_board_${symbol}'.
+func (bf *WebSocketClient) UnsubscribeBoard(symbol string) error {
+	return bf.unsubscribe(channelBoard + symbol)
 }
 
-func (bf *WebSocketClient) UnsubscribeBoardSnapshot(symbol string) {
-	bf.unsubscribe(channelBoardSnapshot + symbol)
+// UnsubscribeBoardSnapshot unsubscribes 'lightning_board_snapshot_${symbol}'.
+func (bf *WebSocketClient) UnsubscribeBoardSnapshot(symbol string) error {
+	return bf.unsubscribe(channelBoardSnapshot + symbol)
 }
 
-func (bf *WebSocketClient) UnsubscribeChildOrder() {
-	bf.unsubscribe(channelChildOrder)
+// UnsubscribeChildOrder unsubscribes child orders.
+func (bf *WebSocketClient) UnsubscribeChildOrder() error {
+	return bf.unsubscribe(channelChildOrder)
 }
 
-func (bf *WebSocketClient) UnsubscribeParentOrder() {
-	bf.unsubscribe(channelParentOrder)
+// UnsubscribeParentOrder unsubscribes parent orders.
+func (bf *WebSocketClient) UnsubscribeParentOrder() error {
+	return bf.unsubscribe(channelParentOrder)
 }
 
-func (bf WebSocketClient) subscribe(channel string) {
+// subscribe sends subscribe request of channel without waiting for the result.
+// The failure of the request is notified to OnErrorOccur.
+func (bf *WebSocketClient) subscribe(channel string) error {
 	if bf.Debug {
-		logln("Subscribe " + channel)
+		bf.logger().Debug("subscribe", "channel", channel)
 	}
-	_ = bf.writeJson(channel, "subscribe")
+	bf.feeds.subscribed(channel, time.Now())
+	_, err := bf.call("subscribe", &subscribeParams{channel}, channel, false)
+	if err != nil {
+		bf.feeds.unsubscribed(channel)
+	}
+	return err
 }
 
-func (bf WebSocketClient) unsubscribe(channel string) {
+// unsubscribe sends unsubscribe request of channel without waiting for the result.
+func (bf *WebSocketClient) unsubscribe(channel string) error {
 	if bf.Debug {
-		logln("Unsubscribe " + channel)
+		bf.logger().Debug("unsubscribe", "channel", channel)
 	}
-	_ = bf.writeJson(channel, "unsubscribe")
+	bf.feeds.unsubscribed(channel)
+	_, err := bf.call("unsubscribe", &subscribeParams{channel}, channel, false)
+	return err
 }
 
-func (bf WebSocketClient) writeJson(channel string, method string) error {
-	if err := bf.Con.WriteJSON(&jsonRPC2{
-		Version: "2.0",
-		Method:  method,
-		Params:  &subscribeParams{channel}}); err != nil {
+// write sends v as JSON with the write deadline. Writes are serialized since Con doesn't support concurrent writers.
+func (bf *WebSocketClient) write(v interface{}) error {
+	if bf.isClosing() {
+		return ErrClosed
+	}
+	con := bf.conn()
+	if con == nil {
+		return ErrNotConnected
+	}
+	bf.writeMu.Lock()
+	defer bf.writeMu.Unlock()
+	if err := con.SetWriteDeadline(bf.writeDeadline()); err != nil {
 		return err
 	}
-	return nil
+	return con.WriteJSON(v)
+}
+
+// isPrivateChannel returns true if channel requires authentication.
+func isPrivateChannel(channel string) bool {
+	return channel == channelChildOrder || channel == channelParentOrder
 }
 
 // Receive start receiving stream data from websocket.
+//
+// It returns when reading from the connection fails, or reconnects if Reconnect is true.
+// It returns after Close in any case. Messages are recorded by Recorder if it's set.
 func (bf *WebSocketClient) Receive() {
+	receiveDone := make(chan struct{})
+	bf.mu.Lock()
+	bf.receiveDone = receiveDone
+	bf.mu.Unlock()
+	defer close(receiveDone)
 
 	for {
+		bf.receive(bf.conn())
+		if !bf.Reconnect || bf.isClosing() || !bf.reconnect() {
+			bf.logger().Info("finished receiving websocket")
+			return
+		}
+	}
+}
+
+// receive reads messages from con until it fails.
+func (bf *WebSocketClient) receive(con *websocket.Conn) {
+	if con == nil {
+		bf.Cb.OnErrorOccur("", ErrNotConnected)
+		return
+	}
+	done := make(chan struct{})
+	defer close(done)
+	bf.heartbeat(con, done)
+	bf.watchStale(con, done)
+	readTimeout := bf.ReadTimeout
 
-		var res map[string]interface{}
-		if err := bf.Con.ReadJSON(&res); err != nil {
-			logf("Received error: %v\n", err)
+	for {
+		_, data, err := con.ReadMessage()
+		if err != nil {
+			bf.failPending(ErrConnectionLost)
+			if bf.isClosing() {
+				return
+			}
+			bf.logger().Error("failed to receive", "error", err)
 			bf.Cb.OnErrorOccur("", err)
 			return
 		}
+		receivedAt := time.Now()
+		if readTimeout > 0 {
+			con.SetReadDeadline(receivedAt.Add(readTimeout))
+		}
 
-		if bf.Debug {
-			dump(res)
+		if bf.Recorder != nil {
+			if err := bf.Recorder.Record(receivedAt, data); err != nil {
+				bf.logger().Error("failed to record message", "error", err)
+			}
 		}
+		bf.dispatch(data, receivedAt)
+	}
+}
 
-		if method, ok := res["method"]; ok {
-			if method == "channelMessage" {
-				p := res["params"].(map[string]interface{})
-				ch := p["channel"].(string)
-
-				if strings.HasPrefix(ch, channelExecutions) {
-
-					receivedTime := time.Now()
-					message := p["message"].([]interface{})
-					var executions []Execution
-					for _, m := range message {
-						e := m.(map[string]interface{})
-						execDate, err := time.Parse(time.RFC3339Nano, e["exec_date"].(string))
-						if err != nil {
-							logf("Failed to parse time received from executions channel: %s", e["exec_date"].(string))
-							bf.Cb.OnErrorOccur(ch, err)
-						}
-						executions = append(executions, Execution{
-							Id:                         int64(e["id"].(float64)),
-							ExecDate:                   execDate,
-							Price:                      e["price"].(float64),
-							Size:                       e["size"].(float64),
-							Side:                       e["side"].(string),
-							BuyChildOrderAcceptanceId:  e["buy_child_order_acceptance_id"].(string),
-							SellChildOrderAcceptanceId: e["sell_child_order_acceptance_id"].(string),
-							ReceivedTime:               receivedTime,
-						})
-					}
+// reconnect connects again until it succeeds, and subscribes the channels again.
+// It returns false if the client is closed before reconnecting.
+func (bf *WebSocketClient) reconnect() bool {
+	interval := bf.ReconnectInterval
+	if interval <= 0 {
+		interval = DefaultReconnectInterval
+	}
+	if con := bf.conn(); con != nil {
+		con.Close()
+	}
+	bf.mu.Lock()
+	closing := bf.closingChan()
+	bf.mu.Unlock()
+	for {
+		timer := time.NewTimer(interval)
+		select {
+		case <-closing:
+			timer.Stop()
+			return false
+		case <-timer.C:
+		}
+		bf.logger().Info("reconnecting websocket")
+		if err := bf.connect(); err != nil {
+			bf.logger().Error("failed to reconnect", "error", err)
+			bf.Cb.OnErrorOccur("", err)
+			continue
+		}
+		break
+	}
+	if bf.isClosing() {
+		bf.conn().Close()
+		return false
+	}
+	bf.feeds.reset(time.Now())
+
+	bf.mu.Lock()
+	provider := bf.provider
+	bf.mu.Unlock()
+	if provider != nil {
+		// the response is read by this goroutine, so it's waited for by another one
+		call, err := bf.auth(provider, true)
+		if err != nil {
+			bf.reauthFailed(err)
+		} else {
+			go bf.waitReauth(call)
+		}
+	}
+	for _, ch := range bf.feeds.list() {
+		if provider == nil || !isPrivateChannel(ch) {
+			bf.subscribe(ch)
+		}
+	}
+	return true
+}
 
-					bf.Cb.OnReceiveExecutions(ch, executions)
+// waitReauth waits for the result of authentication after reconnecting.
+// The private channels are subscribed again by onAuth if it succeeded.
+func (bf *WebSocketClient) waitReauth(call *pendingCall) {
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultReauthTimeout)
+	defer cancel()
+	if err := bf.wait(ctx, call); err != nil {
+		bf.reauthFailed(err)
+	}
+}
 
-				} else if strings.HasPrefix(ch, channelBoardSnapshot) {
-					bf.Cb.OnReceiveBoardSnapshot(ch, newBoard(p["message"].(map[string]interface{})))
+// reauthFailed notifies that the private channels aren't subscribed again because authentication failed.
+func (bf *WebSocketClient) reauthFailed(err error) {
+	bf.logger().Error("failed to authenticate after reconnecting", "error", err)
+	notified := false
+	for _, ch := range bf.feeds.list() {
+		if isPrivateChannel(ch) {
+			bf.Cb.OnErrorOccur(ch, err)
+			notified = true
+		}
+	}
+	if !notified {
+		bf.Cb.OnErrorOccur("", err)
+	}
+}
 
-				} else if strings.HasPrefix(ch, channelBoard) {
-					bf.Cb.OnReceiveBoard(ch, newBoard(p["message"].(map[string]interface{})))
+// dispatch decodes the message received at receivedAt and calls the callback.
+func (bf *WebSocketClient) dispatch(data []byte, receivedAt time.Time) {
+	var res map[string]interface{}
+	if err := json.Unmarshal(data, &res); err != nil {
+		bf.logger().Error("failed to decode message", "error", err, "message", string(data))
+		bf.incDecodeError("")
+		bf.Cb.OnErrorOccur("", err)
+		return
+	}
 
-				} else if strings.HasPrefix(ch, channelChildOrder) {
+	if bf.Debug {
+		bf.dump(res)
+	}
 
-					// TODO Improve speed (Don't use Marchal and Unmarchal)
-					var events []ChildOrderEvent
-					msg := p["message"].(interface{}).([]interface{})
-					msgJson, err := json.Marshal(&msg)
-					if err != nil {
-						bf.Cb.OnErrorOccur(ch, err)
-					}
-					err = json.Unmarshal(msgJson, &events)
-					if err != nil {
-						logf("Failed to parse ChildOrderEvent: %v", string(msgJson))
-						bf.Cb.OnErrorOccur(ch, err)
-					}
-					bf.Cb.OnReceiveChildOrderEvents(ch, events)
-					//logf("time: %v\n", time.Now().Sub(receivedTime))
+	if method, ok := res["method"]; ok {
+		if method == "channelMessage" {
+			p := res["params"].(map[string]interface{})
+			ch := p["channel"].(string)
+			if bf.Metrics != nil {
+				bf.Metrics.IncMessage(ch)
+			}
+			bf.feeds.received(ch, receivedAt)
 
-				} else if strings.HasPrefix(ch, channelParentOrder) {
+			if strings.HasPrefix(ch, channelExecutions) {
 
-					// TODO: need to implement
-					var events []ParentOrderEvent
-					msg := p["message"].(interface{}).([]interface{})
-					msgJson, err := json.Marshal(&msg)
+				receivedTime := receivedAt
+				message := p["message"].([]interface{})
+				var executions []Execution
+				for _, m := range message {
+					e := m.(map[string]interface{})
+					execDate, err := time.Parse(time.RFC3339Nano, e["exec_date"].(string))
 					if err != nil {
+						bf.logger().Error("failed to parse exec_date", "channel", ch, "exec_date", e["exec_date"])
+						bf.incDecodeError(ch)
 						bf.Cb.OnErrorOccur(ch, err)
 					}
-					err = json.Unmarshal(msgJson, &events)
-					if err != nil {
-						logf("Failed to parse ParentOrderEvent: %v", string(msgJson))
-						bf.Cb.OnErrorOccur(ch, err)
+					executions = append(executions, Execution{
+						Id:                         int64(e["id"].(float64)),
+						ExecDate:                   execDate,
+						Price:                      e["price"].(float64),
+						Size:                       e["size"].(float64),
+						Side:                       e["side"].(string),
+						BuyChildOrderAcceptanceId:  e["buy_child_order_acceptance_id"].(string),
+						SellChildOrderAcceptanceId: e["sell_child_order_acceptance_id"].(string),
+						ReceivedTime:               receivedTime,
+					})
+				}
+
+				if bf.Metrics != nil {
+					for i := range executions {
+						bf.Metrics.ObserveExecutionDelay(ch, executions[i].Delay())
 					}
-					bf.Cb.OnReceiveParentOrderEvents(ch, events)
+				}
+				bf.Cb.OnReceiveExecutions(ch, executions)
 
-				} else if strings.HasPrefix(ch, channelTicker) {
+			} else if strings.HasPrefix(ch, channelBoardSnapshot) {
+				bf.Cb.OnReceiveBoardSnapshot(ch, newBoard(p["message"].(map[string]interface{}), receivedAt))
 
-					t := p["message"].(interface{}).(map[string]interface{})
-					timestamp, err := time.Parse(time.RFC3339Nano, t["timestamp"].(string))
-					if err != nil {
-						logf("Failed to parse time received from ticker channel: %s", t["timestamp"].(string))
-						//errCh <- err
-						bf.Cb.OnErrorOccur(ch, err)
-					}
-					bf.Cb.OnReceiveTicker(ch, &Ticker{
-						ProductCode:     t["product_code"].(string),
-						Timestamp:       TickerTime{&timestamp},
-						TickId:          int64(t["tick_id"].(float64)),
-						BestBid:         t["best_bid"].(float64),
-						BestAsk:         t["best_ask"].(float64),
-						BestBidSize:     t["best_bid_size"].(float64),
-						BestAskSize:     t["best_ask_size"].(float64),
-						TotalBidDepth:   t["total_bid_depth"].(float64),
-						TotalAskDepth:   t["total_ask_depth"].(float64),
-						Ltp:             t["ltp"].(float64),
-						Volume:          t["volume"].(float64),
-						VolumeByProduct: t["volume_by_product"].(float64),
-					})
+			} else if strings.HasPrefix(ch, channelBoard) {
+				bf.Cb.OnReceiveBoard(ch, newBoard(p["message"].(map[string]interface{}), receivedAt))
+
+			} else if strings.HasPrefix(ch, channelChildOrder) {
+
+				// TODO Improve speed (Don't use Marchal and Unmarchal)
+				var events []ChildOrderEvent
+				msg := p["message"].(interface{}).([]interface{})
+				msgJson, err := json.Marshal(&msg)
+				if err != nil {
+					bf.Cb.OnErrorOccur(ch, err)
 				}
-			}
+				err = json.Unmarshal(msgJson, &events)
+				if err != nil {
+					bf.logger().Error("failed to parse child order event", "channel", ch, "message", string(msgJson))
+					bf.incDecodeError(ch)
+					bf.Cb.OnErrorOccur(ch, err)
+				}
+				bf.Cb.OnReceiveChildOrderEvents(ch, events)
+				//logf("time: %v\n", time.Now().Sub(receivedTime))
 
-		} else if id, ok := res["id"]; ok {
-
-			// if res has id and id equals authJsonRpcId, it's a response of request authentication
-			if id.(float64) == authJsonRpcId {
-				if result, ok := res["result"]; ok {
-					if result.(bool) {
-						logln("Succeeded to authenticate.")
-						bf.SubscribeChildOrder()
-						// TODO: subscrive parent child order
-					} else {
-						logln("Failed to authenticate.")
-					}
+			} else if strings.HasPrefix(ch, channelParentOrder) {
+
+				// TODO: need to implement
+				var events []ParentOrderEvent
+				msg := p["message"].(interface{}).([]interface{})
+				msgJson, err := json.Marshal(&msg)
+				if err != nil {
+					bf.Cb.OnErrorOccur(ch, err)
+				}
+				err = json.Unmarshal(msgJson, &events)
+				if err != nil {
+					bf.logger().Error("failed to parse parent order event", "channel", ch, "message", string(msgJson))
+					bf.incDecodeError(ch)
+					bf.Cb.OnErrorOccur(ch, err)
+				}
+				bf.Cb.OnReceiveParentOrderEvents(ch, events)
+
+			} else if strings.HasPrefix(ch, channelTicker) {
+
+				ticker, err := newTicker(p["message"].(map[string]interface{}))
+				if err != nil {
+					bf.logger().Error("failed to parse ticker", "channel", ch, "error", err)
+					bf.incDecodeError(ch)
+					bf.Cb.OnErrorOccur(ch, err)
+				} else if bf.Clock != nil && ticker.Timestamp.Time != nil {
+					bf.Clock.Observe(*ticker.Timestamp.Time, receivedAt)
 				}
+				bf.Cb.OnReceiveTicker(ch, ticker)
+			}
+		}
+
+	} else if id, ok := res["id"].(float64); ok {
+
+		// recorded responses aren't of the calls of this client, and mustn't trigger requests such as subscribe after auth
+		if bf.isReplaying() {
+			return
+		}
+
+		// if res has id, it's a response of the call
+		if call, err := bf.handleResponse(int(id), res); call != nil {
+			if call.method == "auth" {
+				bf.onAuth(err)
 			}
+			call.done <- err
 		}
 	}
-	logln("Finished receive websocket.")
 }
 
-func newBoard(message map[string]interface{}) *Board {
+// isReplaying returns true while Replay dispatches recorded messages.
+func (bf *WebSocketClient) isReplaying() bool {
+	bf.mu.Lock()
+	defer bf.mu.Unlock()
+	return bf.replaying
+}
+
+// setReplaying sets whether Replay dispatches recorded messages.
+func (bf *WebSocketClient) setReplaying(replaying bool) {
+	bf.mu.Lock()
+	defer bf.mu.Unlock()
+	bf.replaying = replaying
+}
+
+func (bf *WebSocketClient) incDecodeError(channel string) {
+	if bf.Metrics != nil {
+		bf.Metrics.IncDecodeError(channel)
+	}
+}
+
+// newBoard creates Board from the message received at receivedAt.
+// Board has no exchange time, so Time is receivedAt.
+func newBoard(message map[string]interface{}, receivedAt time.Time) *Board {
 
 	bidsMessage := message["bids"].([]interface{})
 	var bids = make(map[float64]float64, len(bidsMessage))
@@ -417,13 +890,34 @@ func newBoard(message map[string]interface{}) *Board {
 	}
 
 	return &Board{
-		Time:     time.Now(),
+		Time:     receivedAt,
 		MidPrice: message["mid_price"].(float64),
 		Bids:     bids,
 		Asks:     asks,
 	}
 }
 
+// newTicker creates Ticker from the message of ticker channel.
+//
+// If timestamp can't be parsed, it returns Ticker without timestamp and the error.
+func newTicker(t map[string]interface{}) (*Ticker, error) {
+	timestamp, err := time.Parse(time.RFC3339Nano, t["timestamp"].(string))
+	return &Ticker{
+		ProductCode:     t["product_code"].(string),
+		Timestamp:       TickerTime{&timestamp},
+		TickId:          int64(t["tick_id"].(float64)),
+		BestBid:         t["best_bid"].(float64),
+		BestAsk:         t["best_ask"].(float64),
+		BestBidSize:     t["best_bid_size"].(float64),
+		BestAskSize:     t["best_ask_size"].(float64),
+		TotalBidDepth:   t["total_bid_depth"].(float64),
+		TotalAskDepth:   t["total_ask_depth"].(float64),
+		Ltp:             t["ltp"].(float64),
+		Volume:          t["volume"].(float64),
+		VolumeByProduct: t["volume_by_product"].(float64),
+	}, err
+}
+
 func randomHex(n int) (string, error) {
 	bytes := make([]byte, n)
 	if _, err := rand.Read(bytes); err != nil {
@@ -432,7 +926,9 @@ func randomHex(n int) (string, error) {
 	return hex.EncodeToString(bytes), nil
 }
 
-func dump(data map[string]interface{}) {
+// dump logs the received data in debug mode.
+func (bf *WebSocketClient) dump(data map[string]interface{}) {
+	logger := bf.logger()
 
 	if method, ok := data["method"]; ok {
 		if method == "channelMessage" {
@@ -441,37 +937,33 @@ func dump(data map[string]interface{}) {
 
 			if strings.HasPrefix(ch, channelExecutions) { // for executions
 
-				logln("Received execution >>>")
 				message := p["message"].([]interface{})
 				for _, m := range message {
 					e := m.(map[string]interface{})
 					execDate, err := time.Parse(time.RFC3339Nano, e["exec_date"].(string))
 					if err == nil {
-						logf("[execution] id=%.0f, execDate=%v, side=%s price=%.0f, size=%.3f, buy=%v, sell=%v\n",
-							e["id"], execDate, e["side"], e["price"], e["size"],
-							e["buy_child_order_acceptance_id"], e["sell_child_order_acceptance_id"])
+						logger.Debug("received execution", "channel", ch, "id", e["id"], "exec_date", execDate,
+							"side", e["side"], "price", e["price"], "size", e["size"],
+							"buy", e["buy_child_order_acceptance_id"], "sell", e["sell_child_order_acceptance_id"])
 					}
 				}
-				logln("<<< Received execution")
 
 			} else if strings.HasPrefix(ch, channelBoard) { // for board
 
-				logln("Received board >>>")
 				message := p["message"].(map[string]interface{})
 				bidsMessage := message["bids"].([]interface{})
 				for _, bid := range bidsMessage {
 					b := bid.(map[string]interface{})
-					logf("[board] bid: %.0f %v\n", b["price"], b["size"])
+					logger.Debug("received board", "channel", ch, "bid", b["price"], "size", b["size"])
 				}
 				asksMessage := message["asks"].([]interface{})
 				for _, ask := range asksMessage {
 					a := ask.(map[string]interface{})
-					logf("[board] ask: %.0f %v\n", a["price"], a["size"])
+					logger.Debug("received board", "channel", ch, "ask", a["price"], "size", a["size"])
 				}
-				logln("<<< Received board")
 
 			} else {
-				logln("Received data:", data)
+				logger.Debug("received data", "channel", ch, "data", data)
 			}
 		}
 	}
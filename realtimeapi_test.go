@@ -1,14 +1,54 @@
 package bitflyergo
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
 	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
 	//"os"
 	//"os/signal"
 	//"syscall"
 	"testing"
-	//"time"
+	"time"
+
+	"github.com/gorilla/websocket"
 )
 
+// newTestWebSocket starts the websocket server sending messages and closing the connection,
+// and returns the connection to it.
+func newTestWebSocket(t *testing.T, messages []string) (*websocket.Conn, func()) {
+	endpoint, closeServer := newTestWebSocketServer(t, func(con *websocket.Conn) {
+		for _, msg := range messages {
+			con.WriteMessage(websocket.TextMessage, []byte(msg))
+		}
+	})
+	con, _, err := websocket.DefaultDialer.Dial(endpoint, nil)
+	if err != nil {
+		closeServer()
+		t.Fatal(err)
+	}
+	return con, closeServer
+}
+
+// newTestWebSocketServer starts the websocket server calling handle for each connection,
+// and returns its url.
+func newTestWebSocketServer(t *testing.T, handle func(con *websocket.Conn)) (string, func()) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		con, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+		if err != nil {
+			t.Errorf("failed to upgrade: %v", err)
+			return
+		}
+		defer con.Close()
+		handle(con)
+	}))
+	return "ws" + strings.TrimPrefix(server.URL, "http"), server.Close
+}
+
 type C struct{}
 
 func (c *C) OnReceiveExecutions(channelName string, executions []Execution) {
@@ -62,3 +102,258 @@ func TestReceive(t *testing.T) {
 	//		}
 	//	}
 }
+
+// blockingCallback blocks in OnReceiveExecutions until release is closed.
+type blockingCallback struct {
+	errorCallback
+	received chan struct{}
+	release  chan struct{}
+	finished chan struct{}
+}
+
+func (c *blockingCallback) OnReceiveExecutions(channelName string, executions []Execution) {
+	close(c.received)
+	<-c.release
+	close(c.finished)
+}
+
+func TestClose(t *testing.T) {
+	endpoint, closeServer := newTestWebSocketServer(t, func(con *websocket.Conn) {
+		con.WriteMessage(websocket.TextMessage, []byte(testExecutionsMessage))
+		readAll(con, nil) // replies to close frame
+	})
+	defer closeServer()
+
+	cb := &blockingCallback{received: make(chan struct{}), release: make(chan struct{}), finished: make(chan struct{})}
+	ws := &WebSocketClient{Cb: cb, Reconnect: true, EndpointUrl: endpoint}
+	if err := ws.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	go ws.Receive()
+	<-cb.received
+
+	closed := make(chan error)
+	go func() {
+		closed <- ws.Close(context.Background())
+	}()
+	select {
+	case err := <-closed:
+		t.Fatalf("Close returned during the callback: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(cb.release)
+	if err := <-closed; err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	select {
+	case <-cb.finished:
+	default:
+		t.Error("Close returned before the callback finished")
+	}
+
+	if err := ws.SubscribeTicker(ProductCodeFxBtcJpy); err != ErrClosed {
+		t.Errorf("expected=%v, actual=%v", ErrClosed, err)
+	}
+	if err := ws.Close(context.Background()); err != nil {
+		t.Errorf("second Close: %v", err)
+	}
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	if len(cb.errors) != 0 {
+		t.Errorf("OnErrorOccur is called: %v", cb.errors)
+	}
+}
+
+func TestCloseTimeout(t *testing.T) {
+	stop := make(chan struct{})
+	endpoint, closeServer := newTestWebSocketServer(t, func(con *websocket.Conn) {
+		con.WriteMessage(websocket.TextMessage, []byte(testExecutionsMessage))
+		<-stop // never replies to close frame
+	})
+	defer closeServer()
+	defer close(stop)
+
+	cb := &blockingCallback{received: make(chan struct{}), release: make(chan struct{}), finished: make(chan struct{})}
+	close(cb.release)
+	ws := &WebSocketClient{Cb: cb, EndpointUrl: endpoint}
+	if err := ws.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan struct{})
+	go func() {
+		ws.Receive()
+		close(done)
+	}()
+	<-cb.finished
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := ws.Close(ctx); err != context.DeadlineExceeded {
+		t.Errorf("expected=%v, actual=%v", context.DeadlineExceeded, err)
+	}
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Error("Receive doesn't return after Close")
+	}
+}
+
+// closingCallback closes the client from the callback.
+type closingCallback struct {
+	NopCallback
+	ws     *WebSocketClient
+	closed chan error
+}
+
+func (c *closingCallback) OnReceiveExecutions(channelName string, executions []Execution) {
+	c.closed <- c.ws.CloseAsync()
+}
+
+func TestCloseFromCallback(t *testing.T) {
+	endpoint, closeServer := newTestWebSocketServer(t, func(con *websocket.Conn) {
+		con.WriteMessage(websocket.TextMessage, []byte(testExecutionsMessage))
+		readAll(con, nil)
+	})
+	defer closeServer()
+
+	cb := &closingCallback{closed: make(chan error, 1)}
+	ws := &WebSocketClient{Cb: cb, Reconnect: true, EndpointUrl: endpoint}
+	cb.ws = ws
+	if err := ws.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	started := time.Now()
+	ws.Receive()
+	if err := <-cb.closed; err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if elapsed := time.Since(started); elapsed > 500*time.Millisecond {
+		t.Errorf("Close waited for the callback: %v", elapsed)
+	}
+}
+
+func TestConnectWhileReceivingAfterClose(t *testing.T) {
+	endpoint, closeServer := newTestWebSocketServer(t, func(con *websocket.Conn) {
+		con.WriteMessage(websocket.TextMessage, []byte(testExecutionsMessage))
+		readAll(con, nil)
+	})
+	defer closeServer()
+
+	cb := &blockingCallback{received: make(chan struct{}), release: make(chan struct{}), finished: make(chan struct{})}
+	ws := &WebSocketClient{Cb: cb, Reconnect: true, EndpointUrl: endpoint}
+	if err := ws.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan struct{})
+	go func() {
+		ws.Receive()
+		close(done)
+	}()
+	<-cb.received
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := ws.Close(ctx); err != context.DeadlineExceeded {
+		t.Errorf("expected=%v, actual=%v", context.DeadlineExceeded, err)
+	}
+	if err := ws.Connect(); err != ErrStillReceiving {
+		t.Errorf("expected=%v, actual=%v", ErrStillReceiving, err)
+	}
+	close(cb.release)
+	<-done
+	if err := ws.Connect(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	ws.Con.Close()
+}
+
+func TestConcurrentWrites(t *testing.T) {
+	received := make(chan string, 100)
+	endpoint, closeServer := newTestWebSocketServer(t, func(con *websocket.Conn) {
+		readAll(con, func(data []byte) {
+			received <- string(data)
+		})
+	})
+	defer closeServer()
+
+	ws := &WebSocketClient{Cb: NopCallback{}, EndpointUrl: endpoint}
+	if err := ws.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	go ws.Receive()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if err := ws.SubscribeTicker(fmt.Sprintf("PRODUCT%v", i)); err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	for i := 0; i < 20; i++ {
+		select {
+		case msg := <-received:
+			if !json.Valid([]byte(msg)) {
+				t.Errorf("invalid message: %v", msg)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("received only %v messages", i)
+		}
+	}
+	if err := ws.Close(context.Background()); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestConnectDialer(t *testing.T) {
+	extensions := make(chan string, 1)
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		extensions <- r.Header.Get("Sec-WebSocket-Extensions")
+		con, err := (&websocket.Upgrader{EnableCompression: true}).Upgrade(w, r, nil)
+		if err != nil {
+			t.Errorf("failed to upgrade: %v", err)
+			return
+		}
+		defer con.Close()
+		readAll(con, nil)
+	}))
+	defer server.Close()
+	endpoint := "wss" + strings.TrimPrefix(server.URL, "https")
+
+	// the certificate of the test server isn't trusted by default
+	ws := &WebSocketClient{Cb: NopCallback{}, EndpointUrl: endpoint}
+	if err := ws.Connect(); err == nil {
+		t.Fatal("connected without TLS config")
+	}
+
+	ws.Dialer = &websocket.Dialer{
+		TLSClientConfig:   server.Client().Transport.(*http.Transport).TLSClientConfig,
+		HandshakeTimeout:  time.Second,
+		ReadBufferSize:    1024,
+		WriteBufferSize:   1024,
+		EnableCompression: true,
+	}
+	if err := ws.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	if ext := <-extensions; !strings.Contains(ext, "permessage-deflate") {
+		t.Errorf("compression isn't requested: %q", ext)
+	}
+	if err := ws.Close(context.Background()); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestConnectStatus(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+
+	ws := &WebSocketClient{EndpointUrl: "ws" + strings.TrimPrefix(server.URL, "http")}
+	err := ws.Connect()
+	if err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
@@ -1,12 +1,14 @@
 package bitflyergo
 
 import (
+	"bytes"
 	"encoding/json"
 	"io"
 	"io/ioutil"
-	"log"
 	"net/http"
 	"net/http/httputil"
+	url2 "net/url"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -34,29 +36,84 @@ const (
 	MinimumOrderbleSize  = 0.01            // minimum orderable size
 )
 
+// Parent order const
+const (
+	OrderMethodSimple      = "SIMPLE"     // order method: SIMPLE
+	OrderMethodIfd         = "IFD"        // order method: IFD
+	OrderMethodOco         = "OCO"        // order method: OCO
+	OrderMethodIfdOco      = "IFDOCO"     // order method: IFDOCO
+	ConditionTypeLimit     = "LIMIT"      // condition type: LIMIT
+	ConditionTypeMarket    = "MARKET"     // condition type: MARKET
+	ConditionTypeStop      = "STOP"       // condition type: STOP
+	ConditionTypeStopLimit = "STOP_LIMIT" // condition type: STOP_LIMIT
+	ConditionTypeTrail     = "TRAIL"      // condition type: TRAIL
+)
+
+// Child order const
+const (
+	TimeInForceGtc          = "GTC"       // time in force: GTC
+	TimeInForceIoc          = "IOC"       // time in force: IOC
+	TimeInForceFok          = "FOK"       // time in force: FOK
+	ChildOrderStateActive   = "ACTIVE"    // child order state: ACTIVE
+	ChildOrderStateComplete = "COMPLETED" // child order state: COMPLETED
+	ChildOrderStateCanceled = "CANCELED"  // child order state: CANCELED
+	ChildOrderStateExpired  = "EXPIRED"   // child order state: EXPIRED
+	ChildOrderStateRejected = "REJECTED"  // child order state: REJECTED
+	MaxMinuteToExpire       = 43200       // maximum of minute_to_expire (30 days)
+)
+
 // Private const
 const (
 	baseUrl = "https://api.bitflyer.com" // url for restfull api
 )
 
-// NewBitflyer creates Bitflyer instance.
+// New creates Bitflyer instance configured by opts.
+//
+// By default, it calls API of Japan with the rate limited to DefaultRateLimit requests per DefaultRatePeriod,
+// signs private API with the server time, and doesn't retry because retrying an order may place it twice.
+func New(opts ...Option) *Bitflyer {
+	bf := &Bitflyer{
+		BaseUrl:       baseUrl,
+		ApiVersion:    "1",
+		client:        newHTTPClient(),
+		Debug:         false,
+		RetryInterval: DefaultRetryInterval,
+		Clock:         NewClock(),
+		RateLimiter:   NewRateLimiter(DefaultRateLimit, DefaultRatePeriod),
+	}
+	for _, opt := range opts {
+		opt(bf)
+	}
+	return bf
+}
+
+// NewBitflyer creates Bitflyer instance configured by opts.
+//
+// Unlike New, it has no rate limiter and its http client has no timeout as before.
+// Use WithRateLimiter and WithTimeout to enable them.
+//
+// Deprecated: Use New with WithCredentials and WithRetry.
 func NewBitflyer(
 	apiKey string,
 	apiSecret string,
 	retryStatus []int,
 	retryLimit int,
-	retryInterval time.Duration) *Bitflyer {
-	return &Bitflyer{
-		BaseUrl:       baseUrl,
-		ApiVersion:    "1",
-		apiKey:        apiKey,
-		apiSecret:     apiSecret,
-		client:        &http.Client{},
-		Debug:         false,
-		RetryStatus:   retryStatus,
-		RetryLimit:    retryLimit,
-		RetryInterval: retryInterval,
+	retryInterval time.Duration,
+	opts ...Option) *Bitflyer {
+	return New(append([]Option{
+		WithHTTPClient(&http.Client{Transport: newTransport()}),
+		WithRateLimiter(nil),
+		WithCredentials(apiKey, apiSecret),
+		WithRetry(retryStatus, retryLimit, retryInterval),
+	}, opts...)...)
+}
+
+// apiPath returns path of API without the version and the query string, e.g. PathGetBoard.
+func (bf *Bitflyer) apiPath(path string) string {
+	if i := strings.Index(path, "?"); i >= 0 {
+		path = path[:i]
 	}
+	return strings.TrimPrefix(path, "/v"+bf.ApiVersion)
 }
 
 // getUrl returns a URL to call API including path.
@@ -65,22 +122,38 @@ func (bf *Bitflyer) getUrl(path string) string {
 }
 
 // APIを実行します。指定されたAPIエラーが発生した際はリトライします。
+// GETの場合paramsはクエリ文字列として、POSTの場合はJSONのボディとして送信します。
 func (bf *Bitflyer) callApiWithRetry(method string, path string, params map[string]string) ([]byte, error) {
-	var res []byte
-	var err error
+	if strings.ToUpper(method) == "POST" && params != nil {
+		return bf.callApiWithRetryBody(method, path, nil, params)
+	}
+	return bf.callApiWithRetryBody(method, path, params, nil)
+}
 
-	i := 0
-	for true {
+// APIを実行します。queryはクエリ文字列、bodyはJSONに変換してリクエストボディとして送信します。
+func (bf *Bitflyer) callApiWithRetryBody(method string, path string, query map[string]string, body interface{}) ([]byte, error) {
+	res, err := bf.callApiWithRetryResponse(method, path, query, body)
+	if err != nil {
+		return nil, err
+	}
+	return res.Body, nil
+}
+
+// callApiWithRetryResponse is callApiWithRetryBody returning the response of the final attempt.
+func (bf *Bitflyer) callApiWithRetryResponse(method string, path string, query map[string]string, body interface{}) (*Response, error) {
+	var res *Response
+
+	// 署名と送信で同じ文字列を使うため、クエリとボディは一度だけ生成する
+	path, data, err := makePathAndBody(path, query, body)
+	if err != nil {
+		return nil, err
+	}
 
-		// 認証ヘッダを生成
-		headers := bf.getAuthHeaders(method, path, params)
+	i := 0
+	for {
 
 		// 指定されたメソッドでAPIを実行する
-		if strings.ToLower(method) == "post" {
-			res, err = bf.post(bf.BaseUrl+path, params, headers)
-		} else if strings.ToLower(method) == "get" {
-			res, err = bf.get(bf.BaseUrl+path, params, headers)
-		}
+		res, err = bf.sendPrivate(method, path, data)
 
 		// エラーが発生していないならループ終了
 		if err == nil {
@@ -96,8 +169,10 @@ func (bf *Bitflyer) callApiWithRetry(method string, path string, params map[stri
 					if e.Status == status {
 						i += 1
 						canRetry = true
-						logf("%v\n", e)
-						logf("Retry [%v/%v] %v\n", i, bf.RetryLimit, path)
+						bf.logger().Warn("retry", "path", path, "attempt", i, "limit", bf.RetryLimit, "error", e)
+						if bf.Metrics != nil {
+							bf.Metrics.IncRetry(bf.apiPath(path))
+						}
 						break
 					}
 				}
@@ -106,7 +181,7 @@ func (bf *Bitflyer) callApiWithRetry(method string, path string, params map[stri
 
 		// 発生したエラーがリトライ対象のエラーでない場合
 		if !canRetry {
-			logf("this error doesn't need to retry. %v\n", err)
+			bf.logger().Warn("this error doesn't need to retry", "path", path, "error", err)
 			return nil, err
 		}
 
@@ -116,115 +191,222 @@ func (bf *Bitflyer) callApiWithRetry(method string, path string, params map[stri
 	return res, nil
 }
 
-func (bf *Bitflyer) get(url string, params map[string]string, headers map[string]string) ([]byte, error) {
-	if params != nil {
-		url += makeQueryString(params)
+// APIを一度だけ実行します。出金のように重複して実行してはならないAPIに使用します。
+func (bf *Bitflyer) callApiOnce(method string, path string, query map[string]string, body interface{}) ([]byte, error) {
+	path, data, err := makePathAndBody(path, query, body)
+	if err != nil {
+		return nil, err
+	}
+	res, err := bf.sendPrivate(method, path, data)
+	if err != nil {
+		return nil, err
+	}
+	return res.Body, nil
+}
+
+// makePathAndBody returns path with query string and JSON of body.
+func makePathAndBody(path string, query map[string]string, body interface{}) (string, []byte, error) {
+	path += makeQueryString(query)
+	if body == nil {
+		return path, nil, nil
+	}
+	data, err := json.Marshal(body)
+	if err != nil {
+		return "", nil, err
 	}
-	return bf.request("GET", url, headers, nil)
+	return path, data, nil
 }
 
-func (bf *Bitflyer) post(url string, params map[string]string, headers map[string]string) ([]byte, error) {
+// sendPrivate sends request to private api with authentication headers.
+// The headers are signed from the request passed through the middlewares.
+func (bf *Bitflyer) sendPrivate(method string, path string, data []byte) (*Response, error) {
 	var reader io.Reader
-	if params != nil {
-		paramsJson, err := json.Marshal(params)
+	if data != nil {
+		reader = bytes.NewReader(data)
+	}
+	return bf.request(strings.ToUpper(method), bf.BaseUrl+path, func(req *http.Request) (map[string]string, error) {
+		body, err := requestBody(req)
 		if err != nil {
 			return nil, err
 		}
-		reader = strings.NewReader(string(paramsJson))
+		return bf.getAuthHeaders(req.Method, req.URL.RequestURI(), body)
+	}, reader)
+}
+
+// requestBody returns the body of req, and sets it again so that it can be sent.
+func requestBody(req *http.Request) (string, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return "", nil
+	}
+	data, err := ioutil.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return "", err
+	}
+	req.Body = ioutil.NopCloser(bytes.NewReader(data))
+	req.GetBody = func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(data)), nil
+	}
+	req.ContentLength = int64(len(data))
+	return string(data), nil
+}
+
+func (bf *Bitflyer) get(url string, params map[string]string, headers map[string]string) ([]byte, error) {
+	if params != nil {
+		url += makeQueryString(params)
 	}
-	return bf.request("POST", url, headers, reader)
+	res, err := bf.request("GET", url, func(*http.Request) (map[string]string, error) {
+		return headers, nil
+	}, nil)
+	if err != nil {
+		return nil, err
+	}
+	return res.Body, nil
 }
 
-func (bf *Bitflyer) request(method string, url string, headers map[string]string, reader io.Reader) ([]byte, error) {
+// request sends request to API through the middlewares and returns the response whose status is 200.
+// headers is called with the request passed through the middlewares after waiting for the rate limit.
+func (bf *Bitflyer) request(method string, url string, headers func(req *http.Request) (map[string]string, error), reader io.Reader) (*Response, error) {
 
 	req, err := http.NewRequest(method, url, reader)
 	if err != nil {
 		return nil, err
 	}
+	req, cancel := bf.withPathTimeout(req)
+	defer cancel()
+
+	// send request through middlewares
+	res, err := chain(bf.handler(headers), bf.Middlewares)(req)
+	if err != nil {
+		return nil, err
+	}
+
+	// return error if response status is not 200
+	if res.StatusCode != http.StatusOK {
+		apiErr := &ApiError{}
+		err = json.Unmarshal(res.Body, apiErr)
+		if err != nil {
+			bf.logger().Error("failed to parse error of api", "status", res.StatusCode, "body", string(res.Body))
+			return nil, err
+		}
+		return nil, apiErr
+	}
+	return res, nil
+}
+
+// handler returns the innermost Handler of middlewares, which waits for the rate limit,
+// sets headers and sends the request. The headers are set here so that the signature covers
+// the request modified by the middlewares and ACCESS-TIMESTAMP isn't stale.
+func (bf *Bitflyer) handler(headers func(req *http.Request) (map[string]string, error)) Handler {
+	return func(req *http.Request) (*Response, error) {
+
+		// wait for the rate limit
+		if bf.RateLimiter != nil {
+			wst := time.Now()
+			if err := bf.RateLimiter.Wait(req.Context()); err != nil {
+				return nil, err
+			}
+			if bf.Metrics != nil {
+				bf.Metrics.ObserveRateLimitWait(time.Since(wst))
+			}
+		}
 
-	// add header
-	if headers != nil {
-		for name, value := range headers {
+		// add header
+		h, err := headers(req)
+		if err != nil {
+			return nil, err
+		}
+		for name, value := range h {
 			req.Header.Set(name, value)
 		}
+		return bf.send(req)
 	}
+}
 
+// send sends the request to API.
+func (bf *Bitflyer) send(req *http.Request) (*Response, error) {
 	if bf.Debug {
 		dump, _ := httputil.DumpRequestOut(req, true)
-		logf("%s", dump)
+		bf.logger().Debug("request", "dump", string(dump))
 	}
 
 	// send request
 	st := time.Now()
 	resp, err := bf.client.Do(req)
+	rt := time.Now()
+	if bf.Metrics != nil {
+		status := 0
+		if err == nil {
+			status = resp.StatusCode
+		}
+		bf.Metrics.ObserveRequest(bf.apiPath(req.URL.Path), status, rt.Sub(st))
+	}
 	if bf.Debug {
-		logf(method, url, time.Now().Sub(st))
+		bf.logger().Debug("response", "method", req.Method, "url", req.URL.String(), "elapsed", rt.Sub(st))
 	}
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
 
+	// sample server time
+	if bf.Clock != nil {
+		if date, err := http.ParseTime(resp.Header.Get("Date")); err == nil {
+			bf.Clock.SampleDateHeader(date, st, rt)
+		}
+	}
+
 	// read response body
 	body, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
 		return nil, err
 	}
-
-	// return error if response status is not 200
-	if resp.StatusCode != http.StatusOK {
-		apiErr := &ApiError{}
-		err = json.Unmarshal(body, apiErr)
-		if err != nil {
-			logf("[bitflyergo] catched error of api [%v]\n", apiErr)
-			return nil, err
-		}
-		return nil, apiErr
-	}
-	return body, nil
+	return &Response{StatusCode: resp.StatusCode, Header: resp.Header, Body: body, SentAt: st, Latency: rt.Sub(st)}, nil
 }
 
+// makeQueryString returns query string beginning with '?' whose keys are sorted.
 func makeQueryString(params map[string]string) string {
+	if len(params) == 0 {
+		return ""
+	}
+	keys := make([]string, 0, len(params))
+	for k := range params {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
 	qs := ""
-	if params != nil {
-		qs += "?"
-		for k, v := range params {
-			qs += k + "=" + v + "&"
-		}
+	for _, k := range keys {
+		qs += "&" + url2.QueryEscape(k) + "=" + url2.QueryEscape(params[k])
 	}
-	return qs[0 : len(qs)-1]
+	return "?" + qs[1:]
 }
 
 func (bf *Bitflyer) getDefaultHeaders() map[string]string {
 	headers := map[string]string{}
 	headers["Content-Type"] = "application/json"
-	//headers["User-Agent"] = ""
+	if bf.UserAgent != "" {
+		headers["User-Agent"] = bf.UserAgent
+	}
 	return headers
 }
 
-func (bf *Bitflyer) getAuthHeaders(method string, path string, params map[string]string) map[string]string {
-
-	url := path
-	body := ""
-	if params != nil {
-		if strings.ToUpper(method) == "GET" {
-			url += makeQueryString(params)
-		} else {
-			data, err := json.Marshal(params)
-			if err != nil {
-				log.Fatal(err)
-			}
-			body = string(data)
-		}
+// getAuthHeaders returns headers for private api. path must include query string.
+// ACCESS-TIMESTAMP is the server time estimated by Clock.
+func (bf *Bitflyer) getAuthHeaders(method string, path string, body string) (map[string]string, error) {
+	if bf.Credentials == nil {
+		return nil, ErrNoCredentials
 	}
-
-	ts := strconv.FormatInt(time.Now().Unix(), 10)
-	message := ts + strings.ToUpper(method) + url + body
-	sign := sign(message, bf.apiSecret)
+	c, err := bf.Credentials.Credentials()
+	if err != nil {
+		return nil, err
+	}
+	ts := strconv.FormatInt(bf.Clock.Now().Unix(), 10)
+	message := ts + strings.ToUpper(method) + path + body
+	sign := sign(message, c.ApiSecret)
 
 	headers := bf.getDefaultHeaders()
-	headers["ACCESS-KEY"] = bf.apiKey
+	headers["ACCESS-KEY"] = c.ApiKey
 	headers["ACCESS-TIMESTAMP"] = ts
 	headers["ACCESS-SIGN"] = sign
-	return headers
+	return headers, nil
 }
@@ -0,0 +1,195 @@
+package bitflyergo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrConnectionLost is returned to the calls waiting for the response when the connection is lost.
+var ErrConnectionLost = errors.New("websocket connection was lost before the response")
+
+// RPCError is the error of JSON-RPC call returned by the realtime api server.
+type RPCError struct {
+	Method  string      `json:"-"`       // method of the call
+	Code    int         `json:"code"`    // code
+	Message string      `json:"message"` // message
+	Data    interface{} `json:"data"`    // data
+}
+
+// Error returns the description of the error.
+func (e *RPCError) Error() string {
+	return fmt.Sprintf("%v failed: %v (code=%v, data=%v)", e.Method, e.Message, e.Code, e.Data)
+}
+
+// pendingCall is the JSON-RPC call waiting for the response.
+type pendingCall struct {
+	id      int
+	method  string
+	channel string     // channel of subscribe and unsubscribe
+	wait    bool       // the caller waits for the result
+	late    bool       // the caller of subscribe gave up waiting, and the success subscribes channel again
+	done    chan error // result of the call
+}
+
+// call sends the JSON-RPC request with a unique id and tracks its response.
+// If wait is true, the result is sent to done of the returned call instead of OnErrorOccur.
+func (bf *WebSocketClient) call(method string, params interface{}, channel string, wait bool) (*pendingCall, error) {
+	bf.mu.Lock()
+	bf.lastID++
+	call := &pendingCall{id: bf.lastID, method: method, channel: channel, wait: wait, done: make(chan error, 1)}
+	if bf.pending == nil {
+		bf.pending = map[int]*pendingCall{}
+	}
+	bf.pending[call.id] = call
+	bf.mu.Unlock()
+
+	if err := bf.write(&jsonRPC2{Version: "2.0", Method: method, Params: params, Id: call.id}); err != nil {
+		bf.removeCall(call.id)
+		return nil, err
+	}
+	return call, nil
+}
+
+// wait waits for the result of call until ctx is done.
+func (bf *WebSocketClient) wait(ctx context.Context, call *pendingCall) error {
+	select {
+	case err := <-call.done:
+		return err
+	case <-ctx.Done():
+		bf.removeCall(call.id)
+		return ctx.Err()
+	}
+}
+
+// abandon makes the call of subscribe whose caller gave up waiting late, if it's still pending.
+// It returns false if the response has already been received.
+func (bf *WebSocketClient) abandon(call *pendingCall) bool {
+	bf.mu.Lock()
+	defer bf.mu.Unlock()
+	if _, ok := bf.pending[call.id]; !ok {
+		return false
+	}
+	call.wait = false
+	call.late = true
+	return true
+}
+
+// dropLateSubscribes removes the late calls of subscribe of channel, so that they don't subscribe it again.
+func (bf *WebSocketClient) dropLateSubscribes(channel string) {
+	bf.mu.Lock()
+	defer bf.mu.Unlock()
+	for id, call := range bf.pending {
+		if call.late && call.channel == channel {
+			delete(bf.pending, id)
+		}
+	}
+}
+
+// removeCall removes the call of id from the pending calls and returns it.
+func (bf *WebSocketClient) removeCall(id int) *pendingCall {
+	bf.mu.Lock()
+	defer bf.mu.Unlock()
+	call, ok := bf.pending[id]
+	if !ok {
+		return nil
+	}
+	delete(bf.pending, id)
+	return call
+}
+
+// failPending fails all of the pending calls with err, e.g. when the connection is lost.
+func (bf *WebSocketClient) failPending(err error) {
+	bf.mu.Lock()
+	pending := bf.pending
+	bf.pending = nil
+	bf.mu.Unlock()
+	for _, call := range pending {
+		call.done <- err
+	}
+}
+
+// handleResponse removes the call of id from the pending calls and returns it with the error of the response.
+// It returns nil if the response is unknown. The caller must send the result to done of the call.
+func (bf *WebSocketClient) handleResponse(id int, res map[string]interface{}) (*pendingCall, error) {
+	call := bf.removeCall(id)
+	if call == nil {
+		bf.logger().Warn("received unknown response", "id", id)
+		return nil, nil
+	}
+	err := responseError(call.method, res)
+	if err == nil && call.late {
+		bf.logger().Info("subscribed after the caller gave up waiting", "channel", call.channel)
+		bf.feeds.subscribed(call.channel, time.Now())
+	}
+	if err != nil && call.method != "auth" { // the result of auth is handled by onAuth
+		bf.logger().Error("json-rpc call failed", "method", call.method, "channel", call.channel, "error", err)
+		if call.method == "subscribe" {
+			bf.feeds.unsubscribed(call.channel)
+		}
+		if !call.wait {
+			bf.Cb.OnErrorOccur(call.channel, err)
+		}
+	}
+	return call, err
+}
+
+// responseError returns RPCError if the response of method isn't successful.
+func responseError(method string, res map[string]interface{}) error {
+	if e, ok := res["error"].(map[string]interface{}); ok {
+		rpcErr := &RPCError{Method: method, Data: e["data"]}
+		if code, ok := e["code"].(float64); ok {
+			rpcErr.Code = int(code)
+		}
+		rpcErr.Message, _ = e["message"].(string)
+		return rpcErr
+	}
+	if result, ok := res["result"].(bool); ok && !result {
+		return &RPCError{Method: method, Message: "result is false"}
+	}
+	return nil
+}
+
+// Subscribe subscribes channel such as "lightning_executions_FX_BTC_JPY", and waits for the result until ctx is done.
+//
+// If ctx is done before the result, channel isn't regarded as subscribed until the result is received.
+// If it succeeds later, channel is regarded as subscribed again, and if it fails, the error is notified
+// to OnErrorOccur. Unsubscribe discards the late result.
+func (bf *WebSocketClient) Subscribe(ctx context.Context, channel string) error {
+	bf.feeds.subscribed(channel, time.Now())
+	call, err := bf.call("subscribe", &subscribeParams{channel}, channel, true)
+	if err != nil {
+		bf.feeds.unsubscribed(channel)
+		return err
+	}
+	select {
+	case err := <-call.done:
+		return err
+	case <-ctx.Done():
+
+		// unsubscribed before abandoning, so that the late success isn't overwritten
+		bf.feeds.unsubscribed(channel)
+		if !bf.abandon(call) {
+
+			// the response has just been received
+			if err := <-call.done; err != nil {
+				return err
+			}
+			bf.feeds.subscribed(channel, time.Now())
+			return nil
+		}
+		return ctx.Err()
+	}
+}
+
+// Unsubscribe unsubscribes channel, and waits for the result until ctx is done.
+func (bf *WebSocketClient) Unsubscribe(ctx context.Context, channel string) error {
+	bf.dropLateSubscribes(channel)
+	bf.feeds.unsubscribed(channel)
+	call, err := bf.call("unsubscribe", &subscribeParams{channel}, channel, true)
+	if err != nil {
+		return err
+	}
+	return bf.wait(ctx, call)
+}
@@ -0,0 +1,222 @@
+package bitflyergo
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// rpcRequest is the JSON-RPC request received by the test server.
+type rpcRequest struct {
+	Method string `json:"method"`
+	Params struct {
+		Channel string `json:"channel"`
+		ApiKey  string `json:"api_key"`
+	} `json:"params"`
+	Id int `json:"id"`
+}
+
+// respondRPC responds to the requests by respond until con fails. No response is sent if respond returns nil.
+func respondRPC(con *websocket.Conn, respond func(req rpcRequest) map[string]interface{}) {
+	readAll(con, func(data []byte) {
+		var req rpcRequest
+		json.Unmarshal(data, &req)
+		if res := respond(req); res != nil {
+			res["jsonrpc"] = "2.0"
+			res["id"] = req.Id
+			con.WriteJSON(res)
+		}
+	})
+}
+
+// errorCallback stores errors notified to OnErrorOccur.
+type errorCallback struct {
+	NopCallback
+	mu       sync.Mutex
+	channels []string
+	errors   []error
+}
+
+func (c *errorCallback) OnErrorOccur(channelName string, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.channels = append(c.channels, channelName)
+	c.errors = append(c.errors, err)
+}
+
+// newRPCTestClient connects WebSocketClient to the server responding by respond, and starts receiving.
+func newRPCTestClient(t *testing.T, cb Callback, respond func(req rpcRequest) map[string]interface{}) (*WebSocketClient, func()) {
+	endpoint, closeServer := newTestWebSocketServer(t, func(con *websocket.Conn) {
+		respondRPC(con, respond)
+	})
+	ws := &WebSocketClient{Cb: cb, EndpointUrl: endpoint, Logger: NewStdLogger(nil)}
+	ws.Logger.(*StdLogger).Level = LevelError + 1
+	if err := ws.Connect(); err != nil {
+		closeServer()
+		t.Fatal(err)
+	}
+	done := make(chan struct{})
+	go func() {
+		ws.Receive()
+		close(done)
+	}()
+	return ws, func() {
+		ws.Con.Close()
+		<-done
+		closeServer()
+	}
+}
+
+func subscribeResponder(req rpcRequest) map[string]interface{} {
+	if req.Params.Channel == "invalid" {
+		return map[string]interface{}{"error": map[string]interface{}{"code": -32602, "message": "invalid channel"}}
+	}
+	return map[string]interface{}{"result": true}
+}
+
+func TestSubscribeWait(t *testing.T) {
+	ws, closeClient := newRPCTestClient(t, NopCallback{}, subscribeResponder)
+	defer closeClient()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	if err := ws.Subscribe(ctx, channelExecutions+ProductCodeFxBtcJpy); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	err := ws.Subscribe(ctx, "invalid")
+	rpcErr, ok := err.(*RPCError)
+	if !ok {
+		t.Fatalf("expected RPCError, actual=%v", err)
+	}
+	if rpcErr.Method != "subscribe" || rpcErr.Code != -32602 || rpcErr.Message != "invalid channel" {
+		t.Errorf("unexpected error: %#v", rpcErr)
+	}
+	channels := ws.feeds.list()
+	if len(channels) != 1 || channels[0] != channelExecutions+ProductCodeFxBtcJpy {
+		t.Errorf("subscribed channels: %v", channels)
+	}
+	if err := ws.Unsubscribe(ctx, channelExecutions+ProductCodeFxBtcJpy); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if channels := ws.feeds.list(); len(channels) != 0 {
+		t.Errorf("subscribed channels: %v", channels)
+	}
+}
+
+func TestSubscribeTimeout(t *testing.T) {
+	ws, closeClient := newRPCTestClient(t, NopCallback{}, func(req rpcRequest) map[string]interface{} {
+		if req.Method == "subscribe" {
+			time.Sleep(100 * time.Millisecond)
+		}
+		return map[string]interface{}{"result": true}
+	})
+	defer closeClient()
+	channel := channelTicker + ProductCodeFxBtcJpy
+
+	subscribe := func(channel string) {
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		if err := ws.Subscribe(ctx, channel); err != context.DeadlineExceeded {
+			t.Errorf("expected=%v, actual=%v", context.DeadlineExceeded, err)
+		}
+		if channels := ws.feeds.list(); len(channels) != 0 {
+			t.Errorf("subscribed channels: %v", channels)
+		}
+	}
+
+	// the late success subscribes channel again
+	subscribe(channel)
+	deadline := time.Now().Add(time.Second)
+	for len(ws.feeds.list()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if channels := ws.feeds.list(); len(channels) != 1 || channels[0] != channel {
+		t.Errorf("subscribed channels: %v", channels)
+	}
+
+	// Unsubscribe discards the late result
+	if err := ws.Unsubscribe(context.Background(), channel); err != nil {
+		t.Fatal(err)
+	}
+	subscribe(channel)
+	if err := ws.Unsubscribe(context.Background(), channel); err != nil {
+		t.Fatal(err)
+	}
+	if channels := ws.feeds.list(); len(channels) != 0 {
+		t.Errorf("subscribed channels: %v", channels)
+	}
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	if len(ws.pending) != 0 {
+		t.Errorf("pending: %v", ws.pending)
+	}
+}
+
+func TestSubscribeConnectionLost(t *testing.T) {
+	ws, closeClient := newRPCTestClient(t, NopCallback{}, func(req rpcRequest) map[string]interface{} {
+		return nil
+	})
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		closeClient()
+	}()
+	if err := ws.Subscribe(context.Background(), channelTicker+ProductCodeFxBtcJpy); err != ErrConnectionLost {
+		t.Errorf("expected=%v, actual=%v", ErrConnectionLost, err)
+	}
+}
+
+func TestSubscribeError(t *testing.T) {
+	cb := &errorCallback{}
+	var mu sync.Mutex
+	ids := map[int]bool{}
+	ws, closeClient := newRPCTestClient(t, cb, func(req rpcRequest) map[string]interface{} {
+		mu.Lock()
+		ids[req.Id] = true
+		mu.Unlock()
+		return subscribeResponder(req)
+	})
+
+	if err := ws.SubscribeTicker(ProductCodeFxBtcJpy); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := ws.subscribe("invalid"); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := ws.UnsubscribeTicker(ProductCodeFxBtcJpy); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	closeClient()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(ids) != 3 {
+		t.Errorf("ids aren't unique: %v", ids)
+	}
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	// the failed subscription and the read error after closing
+	if len(cb.errors) != 2 || cb.channels[0] != "invalid" {
+		t.Fatalf("errors: %v %v", cb.channels, cb.errors)
+	}
+	if _, ok := cb.errors[0].(*RPCError); !ok {
+		t.Errorf("expected RPCError, actual=%v", cb.errors[0])
+	}
+}
+
+func TestSubscribeNotConnected(t *testing.T) {
+	ws := &WebSocketClient{Cb: NopCallback{}}
+	if err := ws.SubscribeExecutions(ProductCodeFxBtcJpy); err != ErrNotConnected {
+		t.Errorf("expected=%v, actual=%v", ErrNotConnected, err)
+	}
+	if err := ws.Subscribe(context.Background(), channelChildOrder); err != ErrNotConnected {
+		t.Errorf("expected=%v, actual=%v", ErrNotConnected, err)
+	}
+	if channels := ws.feeds.list(); len(channels) != 0 {
+		t.Errorf("subscribed channels: %v", channels)
+	}
+}
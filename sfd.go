@@ -0,0 +1,174 @@
+package bitflyergo
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// SfdTier is the tier of SFD (Swap For Difference).
+//
+// Rate is applied to the executions widening the divergence between FX_BTC_JPY and BTC_JPY
+// when the absolute divergence is Threshold or more.
+type SfdTier struct {
+	Threshold float64 // divergence, e.g. 0.05 means 5%
+	Rate      float64 // rate of fee, e.g. 0.0025 means 0.25%
+}
+
+// DefaultSfdTiers is the tiers of SFD published by bitFlyer. They must be sorted by Threshold.
+var DefaultSfdTiers = []SfdTier{
+	{Threshold: 0.05, Rate: 0.0025},
+	{Threshold: 0.10, Rate: 0.005},
+	{Threshold: 0.15, Rate: 0.01},
+	{Threshold: 0.20, Rate: 0.02},
+}
+
+// SfdEvent is the event emitted when the divergence crosses the threshold of tier.
+//
+// Tier is -1 when the divergence is less than the lowest threshold.
+type SfdEvent struct {
+	Divergence   float64   // divergence, (FX_BTC_JPY / BTC_JPY) - 1
+	PreviousTier int       // index of the previous tier
+	Tier         int       // index of the current tier
+	Rate         float64   // rate of the current tier
+	Time         time.Time // time of the ticker which caused the event
+}
+
+// SfdMonitor calculates SFD from the tickers of BTC_JPY and FX_BTC_JPY.
+//
+// Create it by NewSfdMonitor, set it to WebSocketClient.Cb (combine with MultiCallback if needed)
+// and call Subscribe.
+type SfdMonitor struct {
+	NopCallback
+
+	// Tiers is the tiers of SFD. DefaultSfdTiers is used if nil.
+	Tiers []SfdTier
+
+	// OnTierChange is called when the divergence crosses the threshold of tier. It may be nil.
+	OnTierChange func(event SfdEvent)
+
+	mu   sync.Mutex
+	spot float64
+	fx   float64
+	tier int
+	time time.Time
+}
+
+// NewSfdMonitor creates SfdMonitor with DefaultSfdTiers.
+func NewSfdMonitor(onTierChange func(event SfdEvent)) *SfdMonitor {
+	return &SfdMonitor{Tiers: DefaultSfdTiers, OnTierChange: onTierChange, tier: -1}
+}
+
+// Subscribe subscribes the tickers of BTC_JPY and FX_BTC_JPY.
+func (m *SfdMonitor) Subscribe(ws *WebSocketClient) {
+	ws.SubscribeTicker(ProductCodeBtcJpy)
+	ws.SubscribeTicker(ProductCodeFxBtcJpy)
+}
+
+// OnReceiveTicker updates the divergence.
+func (m *SfdMonitor) OnReceiveTicker(channelName string, ticker *Ticker) {
+	m.Update(ticker)
+}
+
+// Update updates the divergence by the ticker of BTC_JPY or FX_BTC_JPY. The other tickers are ignored.
+func (m *SfdMonitor) Update(ticker *Ticker) {
+	m.mu.Lock()
+	switch ticker.ProductCode {
+	case ProductCodeBtcJpy:
+		m.spot = ticker.Ltp
+	case ProductCodeFxBtcJpy:
+		m.fx = ticker.Ltp
+	default:
+		m.mu.Unlock()
+		return
+	}
+	if ticker.Timestamp.Time != nil {
+		m.time = *ticker.Timestamp.Time
+	}
+	if m.spot <= 0 || m.fx <= 0 {
+		m.mu.Unlock()
+		return
+	}
+	d := m.fx/m.spot - 1
+	prev := m.tier
+	m.tier = m.tierOf(d)
+	event := SfdEvent{Divergence: d, PreviousTier: prev, Tier: m.tier, Rate: m.rateOf(m.tier), Time: m.time}
+	m.mu.Unlock()
+
+	if prev != event.Tier && m.OnTierChange != nil {
+		m.OnTierChange(event)
+	}
+}
+
+// Divergence returns the current divergence. ok is false until both tickers are received.
+func (m *SfdMonitor) Divergence() (divergence float64, ok bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.spot <= 0 || m.fx <= 0 {
+		return 0, false
+	}
+	return m.fx/m.spot - 1, true
+}
+
+// Tier returns the current tier. ok is false if SFD isn't applied now.
+func (m *SfdMonitor) Tier() (tier SfdTier, ok bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.tier < 0 {
+		return SfdTier{}, false
+	}
+	return m.tiers()[m.tier], true
+}
+
+// EstimateFee returns SFD which the order of FX_BTC_JPY would incur if it's executed at price.
+//
+// If price is zero, the last traded price of FX_BTC_JPY is used.
+// The fee is zero if the order narrows the divergence, since SFD is charged only to the
+// executions widening it: buy when FX_BTC_JPY is higher than BTC_JPY, and sell when lower.
+func (m *SfdMonitor) EstimateFee(side string, price Decimal, size Decimal) Decimal {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.spot <= 0 {
+		return Zero
+	}
+	p := price.Float64()
+	if price.IsZero() {
+		p = m.fx
+	}
+	d := p/m.spot - 1
+	if (side == SideBuy && d <= 0) || (side == SideSell && d >= 0) {
+		return Zero
+	}
+	rate := m.rateOf(m.tierOf(d))
+	if rate == 0 {
+		return Zero
+	}
+	return NewDecimalFromFloat(p).Mul(size).Mul(NewDecimalFromFloat(rate))
+}
+
+// tierOf returns the index of tier applied to divergence, or -1. m.mu must be held.
+func (m *SfdMonitor) tierOf(divergence float64) int {
+	abs := math.Abs(divergence)
+	tier := -1
+	for i, t := range m.tiers() {
+		if abs >= t.Threshold {
+			tier = i
+		}
+	}
+	return tier
+}
+
+// rateOf returns the rate of tier. m.mu must be held.
+func (m *SfdMonitor) rateOf(tier int) float64 {
+	if tier < 0 {
+		return 0
+	}
+	return m.tiers()[tier].Rate
+}
+
+func (m *SfdMonitor) tiers() []SfdTier {
+	if m.Tiers == nil {
+		return DefaultSfdTiers
+	}
+	return m.Tiers
+}
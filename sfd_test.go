@@ -0,0 +1,44 @@
+package bitflyergo
+
+import (
+	"testing"
+)
+
+func TestSfdMonitor(t *testing.T) {
+	var events []SfdEvent
+	m := NewSfdMonitor(func(e SfdEvent) {
+		events = append(events, e)
+	})
+	var cb Callback = MultiCallback{&NopCallback{}, m}
+
+	cb.OnReceiveTicker("lightning_ticker_BTC_JPY", &Ticker{ProductCode: ProductCodeBtcJpy, Ltp: 1000000})
+	if _, ok := m.Divergence(); ok {
+		t.Fatal("divergence must not be known before receiving FX_BTC_JPY.")
+	}
+	cb.OnReceiveTicker("lightning_ticker_FX_BTC_JPY", &Ticker{ProductCode: ProductCodeFxBtcJpy, Ltp: 1040000})
+	if len(events) != 0 {
+		t.Fatalf("%v\n", events)
+	}
+	cb.OnReceiveTicker("lightning_ticker_FX_BTC_JPY", &Ticker{ProductCode: ProductCodeFxBtcJpy, Ltp: 1101000})
+	if len(events) != 1 || events[0].PreviousTier != -1 || events[0].Tier != 1 || events[0].Rate != 0.005 {
+		t.Fatalf("%v\n", events)
+	}
+	tier, ok := m.Tier()
+	if !ok || tier.Threshold != 0.10 {
+		t.Fatalf("%v\n", tier)
+	}
+
+	// buy widens the divergence, sell narrows it
+	fee := m.EstimateFee(SideBuy, Zero, MustParseDecimal("0.1"))
+	if fee.String() != "550.5" {
+		t.Fatalf("Expect: 550.5, Actual: %v", fee)
+	}
+	if fee := m.EstimateFee(SideSell, Zero, MustParseDecimal("0.1")); !fee.IsZero() {
+		t.Fatalf("Expect: 0, Actual: %v", fee)
+	}
+
+	cb.OnReceiveTicker("lightning_ticker_BTC_JPY", &Ticker{ProductCode: ProductCodeBtcJpy, Ltp: 1100000})
+	if len(events) != 2 || events[1].Tier != -1 {
+		t.Fatalf("%v\n", events)
+	}
+}
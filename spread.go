@@ -0,0 +1,229 @@
+package bitflyergo
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// SpreadOpportunity is the executable spread found by SpreadScanner.
+//
+// It means buying BuyProduct at its best ask and selling SellProduct at its best bid makes Profit.
+//
+// The quote time is the exchange time for tickers, but boards have no exchange time,
+// so it is the time when the board was received. The latency of boards is receive-side only
+// and doesn't include the delay between the exchange and the client.
+type SpreadOpportunity struct {
+	BuyProduct    string        // product to buy
+	SellProduct   string        // product to sell
+	BuyPrice      Decimal       // best ask of BuyProduct
+	SellPrice     Decimal       // best bid of SellProduct
+	Size          Decimal       // executable size limited by the sizes of the best prices
+	Spread        Decimal       // SellPrice - BuyPrice
+	SpreadRate    float64       // Spread / BuyPrice
+	Commission    Decimal       // commission of both orders
+	Profit        Decimal       // Spread * Size - Commission
+	BuyQuoteTime  time.Time     // time of the quote of BuyProduct
+	SellQuoteTime time.Time     // time of the quote of SellProduct
+	Time          time.Time     // time when the opportunity was found
+	Latency       time.Duration // Time - the older quote time
+}
+
+// topOfBook is the best prices of product.
+type topOfBook struct {
+	bid     Decimal
+	bidSize Decimal
+	ask     Decimal
+	askSize Decimal
+	time    time.Time // exchange time of ticker, or receive time of board
+}
+
+// SpreadScanner finds the executable spreads between products such as BTC_JPY, FX_BTC_JPY and futures.
+//
+// It takes the best prices from tickers, or from boards if SubscribeBoards is used.
+// Set it to WebSocketClient.Cb (combine with MultiCallback if needed).
+type SpreadScanner struct {
+	NopCallback
+
+	// Products is the products to scan.
+	Products []string
+
+	// Commissions is the commission rate of each product, e.g. the result of GetTradingCommission.
+	Commissions map[string]float64
+
+	// MinProfit is the minimum profit to report.
+	MinProfit Decimal
+
+	// OnOpportunity is called when an opportunity is found on the update of quotes. It may be nil.
+	OnOpportunity func(o SpreadOpportunity)
+
+	mu     sync.Mutex
+	quotes map[string]topOfBook
+	boards map[string]*Board
+}
+
+// NewSpreadScanner creates SpreadScanner of products.
+func NewSpreadScanner(products []string, commissions map[string]float64, onOpportunity func(o SpreadOpportunity)) *SpreadScanner {
+	return &SpreadScanner{
+		Products:      products,
+		Commissions:   commissions,
+		OnOpportunity: onOpportunity,
+	}
+}
+
+// Subscribe subscribes the tickers of all products.
+func (s *SpreadScanner) Subscribe(ws *WebSocketClient) {
+	for _, p := range s.Products {
+		ws.SubscribeTicker(p)
+	}
+}
+
+// SubscribeBoards subscribes the boards of all products.
+func (s *SpreadScanner) SubscribeBoards(ws *WebSocketClient) {
+	for _, p := range s.Products {
+		ws.SubscribeBoardSnapshot(p)
+		ws.SubscribeBoard(p)
+	}
+}
+
+// OnReceiveTicker updates the best prices by ticker.
+func (s *SpreadScanner) OnReceiveTicker(channelName string, ticker *Ticker) {
+	q := topOfBook{
+		bid:     NewDecimalFromFloat(ticker.BestBid),
+		bidSize: NewDecimalFromFloat(ticker.BestBidSize),
+		ask:     NewDecimalFromFloat(ticker.BestAsk),
+		askSize: NewDecimalFromFloat(ticker.BestAskSize),
+	}
+	if ticker.Timestamp.Time != nil {
+		q.time = *ticker.Timestamp.Time
+	}
+	s.update(ticker.ProductCode, q)
+}
+
+// OnReceiveBoardSnapshot replaces the board of product.
+func (s *SpreadScanner) OnReceiveBoardSnapshot(channelName string, board *Board) {
+	s.updateBoard(strings.TrimPrefix(channelName, channelBoardSnapshot), board, true)
+}
+
+// OnReceiveBoard applies the difference of the board of product.
+func (s *SpreadScanner) OnReceiveBoard(channelName string, board *Board) {
+	s.updateBoard(strings.TrimPrefix(channelName, channelBoard), board, false)
+}
+
+func (s *SpreadScanner) updateBoard(productCode string, board *Board, snapshot bool) {
+	s.mu.Lock()
+	if s.boards == nil {
+		s.boards = map[string]*Board{}
+	}
+	b, ok := s.boards[productCode]
+	if snapshot || !ok {
+		b = &Board{}
+		s.boards[productCode] = b
+	}
+	b.Merge(board)
+	bid, bidSize, _ := b.BestBid()
+	ask, askSize, _ := b.BestAsk()
+	q := topOfBook{
+		bid:     NewDecimalFromFloat(bid),
+		bidSize: NewDecimalFromFloat(bidSize),
+		ask:     NewDecimalFromFloat(ask),
+		askSize: NewDecimalFromFloat(askSize),
+		time:    b.Time,
+	}
+	s.mu.Unlock()
+	s.update(productCode, q)
+}
+
+// update updates the best prices of product and reports the opportunities involving it.
+func (s *SpreadScanner) update(productCode string, q topOfBook) {
+	s.mu.Lock()
+	if s.quotes == nil {
+		s.quotes = map[string]topOfBook{}
+	}
+	s.quotes[productCode] = q
+	var found []SpreadOpportunity
+	now := time.Now()
+	for _, other := range s.Products {
+		if other == productCode {
+			continue
+		}
+		if o, ok := s.evaluate(productCode, other, now); ok {
+			found = append(found, o)
+		}
+		if o, ok := s.evaluate(other, productCode, now); ok {
+			found = append(found, o)
+		}
+	}
+	s.mu.Unlock()
+
+	if s.OnOpportunity != nil {
+		for _, o := range found {
+			s.OnOpportunity(o)
+		}
+	}
+}
+
+// Scan returns all opportunities for the current quotes.
+func (s *SpreadScanner) Scan() []SpreadOpportunity {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var found []SpreadOpportunity
+	now := time.Now()
+	for _, buy := range s.Products {
+		for _, sell := range s.Products {
+			if buy == sell {
+				continue
+			}
+			if o, ok := s.evaluate(buy, sell, now); ok {
+				found = append(found, o)
+			}
+		}
+	}
+	return found
+}
+
+// evaluate returns the opportunity buying buyProduct and selling sellProduct. s.mu must be held.
+func (s *SpreadScanner) evaluate(buyProduct string, sellProduct string, now time.Time) (SpreadOpportunity, bool) {
+	buy, ok := s.quotes[buyProduct]
+	if !ok || buy.ask.Sign() <= 0 || buy.askSize.Sign() <= 0 {
+		return SpreadOpportunity{}, false
+	}
+	sell, ok := s.quotes[sellProduct]
+	if !ok || sell.bid.Sign() <= 0 || sell.bidSize.Sign() <= 0 {
+		return SpreadOpportunity{}, false
+	}
+	size := buy.askSize
+	if sell.bidSize.LessThan(size) {
+		size = sell.bidSize
+	}
+	spread := sell.bid.Sub(buy.ask)
+	commission := Notional(buy.ask, size).Mul(NewDecimalFromFloat(s.Commissions[buyProduct])).
+		Add(Notional(sell.bid, size).Mul(NewDecimalFromFloat(s.Commissions[sellProduct])))
+	profit := spread.Mul(size).Sub(commission)
+	if profit.Sign() <= 0 || profit.LessThan(s.MinProfit) {
+		return SpreadOpportunity{}, false
+	}
+	oldest := buy.time
+	if oldest.IsZero() || (!sell.time.IsZero() && sell.time.Before(oldest)) {
+		oldest = sell.time
+	}
+	var latency time.Duration
+	if !oldest.IsZero() {
+		latency = now.Sub(oldest)
+	}
+	return SpreadOpportunity{
+		BuyProduct:    buyProduct,
+		SellProduct:   sellProduct,
+		BuyPrice:      buy.ask,
+		SellPrice:     sell.bid,
+		Size:          size,
+		Spread:        spread,
+		SpreadRate:    spread.Float64() / buy.ask.Float64(),
+		Commission:    commission,
+		Profit:        profit,
+		BuyQuoteTime:  buy.time,
+		SellQuoteTime: sell.time,
+		Time:          now,
+		Latency:       latency,
+	}, true
+}
@@ -0,0 +1,56 @@
+package bitflyergo
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestSpreadScanner(t *testing.T) {
+	var found []SpreadOpportunity
+	s := NewSpreadScanner([]string{ProductCodeBtcJpy, ProductCodeFxBtcJpy},
+		map[string]float64{ProductCodeBtcJpy: 0.001}, func(o SpreadOpportunity) {
+			found = append(found, o)
+		})
+
+	var message map[string]interface{}
+	_ = json.Unmarshal([]byte(`{"product_code":"BTC_JPY","timestamp":"2019-04-11T05:14:12.3739915Z",
+		"tick_id":25965446,"best_bid":1000000,"best_ask":1000100,"best_bid_size":0.1,"best_ask_size":0.5,
+		"total_bid_depth":1,"total_ask_depth":1,"ltp":1000000,"volume":1,"volume_by_product":1}`), &message)
+	ticker, err := newTicker(message)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.OnReceiveTicker(channelTicker+ProductCodeBtcJpy, ticker)
+
+	// FX_BTC_JPY from board: best bid 1003000 (0.2) against best ask of BTC_JPY 1000100 (0.5)
+	s.OnReceiveBoardSnapshot(channelBoardSnapshot+ProductCodeFxBtcJpy, &Board{
+		MidPrice: 1003500,
+		Bids:     map[float64]float64{1003000: 0.2, 1002000: 1},
+		Asks:     map[float64]float64{1004000: 0.3},
+	})
+	if len(found) != 1 {
+		t.Fatalf("%v\n", found)
+	}
+	o := found[0]
+	if o.BuyProduct != ProductCodeBtcJpy || o.SellProduct != ProductCodeFxBtcJpy ||
+		!o.Size.Equal(MustParseDecimal("0.2")) || !o.Spread.Equal(NewDecimalFromInt(2900)) {
+		t.Fatalf("%v\n", o)
+	}
+	// 1000100 * 0.2 * 0.001 and 2900 * 0.2 - 200.02 without the error of float64
+	if !o.Commission.Equal(MustParseDecimal("200.02")) || !o.Profit.Equal(MustParseDecimal("379.98")) || o.Latency <= 0 {
+		t.Fatalf("%v\n", o)
+	}
+
+	// MinProfit filters the opportunity
+	s.MinProfit = NewDecimalFromInt(400)
+	if len(s.Scan()) != 0 {
+		t.Fatalf("%v\n", s.Scan())
+	}
+	s.MinProfit = Zero
+
+	// the spread disappears when the bids are removed
+	s.OnReceiveBoard(channelBoard+ProductCodeFxBtcJpy, &Board{Bids: map[float64]float64{1003000: 0, 1002000: 0}})
+	if len(s.Scan()) != 0 {
+		t.Fatalf("%v\n", s.Scan())
+	}
+}
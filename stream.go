@@ -0,0 +1,153 @@
+package bitflyergo
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// ErrNotConnected is returned when WebSocketClient sends a message without connection, e.g. in replay.
+var ErrNotConnected = errors.New("websocket is not connected")
+
+// Speeds of Replay.
+const (
+	ReplayMaxSpeed = 0 // replays messages as fast as possible
+	ReplayRealTime = 1 // replays messages at the recorded intervals
+)
+
+// MessageRecorder records raw messages received from websocket.
+type MessageRecorder interface {
+	Record(receivedAt time.Time, message []byte) error
+}
+
+// recordedMessage is a line of the recorded stream.
+type recordedMessage struct {
+	ReceivedAt time.Time       `json:"received_at"`       // received_at
+	Message    json.RawMessage `json:"message,omitempty"` // message if it's valid JSON
+	Text       string          `json:"text,omitempty"`    // message if it isn't valid JSON
+}
+
+// StreamRecorder writes raw messages with their receive times to gzip compressed JSON lines.
+type StreamRecorder struct {
+	mu     sync.Mutex
+	closer io.Closer
+	gz     *gzip.Writer
+	enc    *json.Encoder
+}
+
+// NewStreamRecorder creates StreamRecorder writing to the file of path. The file is truncated if it exists.
+func NewStreamRecorder(path string) (*StreamRecorder, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return nil, err
+	}
+	r := NewStreamRecorderWriter(f)
+	r.closer = f
+	return r, nil
+}
+
+// NewStreamRecorderWriter creates StreamRecorder writing to w.
+func NewStreamRecorderWriter(w io.Writer) *StreamRecorder {
+	gz := gzip.NewWriter(w)
+	return &StreamRecorder{gz: gz, enc: json.NewEncoder(gz)}
+}
+
+// Record writes the message received at receivedAt.
+func (r *StreamRecorder) Record(receivedAt time.Time, message []byte) error {
+	m := recordedMessage{ReceivedAt: receivedAt}
+	if json.Valid(message) {
+		m.Message = message
+	} else {
+		m.Text = string(message)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.enc.Encode(&m)
+}
+
+// Flush writes the buffered messages.
+func (r *StreamRecorder) Flush() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.gz.Flush()
+}
+
+// Close writes the buffered messages and closes the file.
+func (r *StreamRecorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	err := r.gz.Close()
+	if r.closer != nil {
+		if cerr := r.closer.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// Replay feeds the messages recorded by StreamRecorder to ws.Cb through the same dispatch as Receive.
+//
+// speed is the rate of replay: ReplayRealTime keeps the recorded intervals, 10 replays 10 times faster,
+// and ReplayMaxSpeed replays without waiting. Messages are dispatched with the recorded receive times,
+// so that Execution.Delay and Board.Time are the same as recorded. ws doesn't need to be connected.
+// Recorded responses of JSON-RPC calls are ignored, so that nothing is sent, e.g. subscribe after auth.
+func Replay(ctx context.Context, r io.Reader, ws *WebSocketClient, speed float64) error {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return err
+	}
+	defer gz.Close()
+	ws.setReplaying(true)
+	defer ws.setReplaying(false)
+
+	scanner := bufio.NewScanner(gz)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	var first time.Time
+	started := time.Now()
+	for scanner.Scan() {
+		var m recordedMessage
+		if err := json.Unmarshal(scanner.Bytes(), &m); err != nil {
+			return err
+		}
+		if first.IsZero() {
+			first = m.ReceivedAt
+		}
+		if speed > 0 {
+			at := started.Add(time.Duration(float64(m.ReceivedAt.Sub(first)) / speed))
+			if wait := time.Until(at); wait > 0 {
+				timer := time.NewTimer(wait)
+				select {
+				case <-ctx.Done():
+					timer.Stop()
+					return ctx.Err()
+				case <-timer.C:
+				}
+			}
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		data := []byte(m.Message)
+		if m.Message == nil {
+			data = []byte(m.Text)
+		}
+		ws.dispatch(data, m.ReceivedAt)
+	}
+	return scanner.Err()
+}
+
+// ReplayFile replays the file of path. See Replay.
+func ReplayFile(ctx context.Context, path string, ws *WebSocketClient, speed float64) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return Replay(ctx, f, ws, speed)
+}
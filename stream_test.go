@@ -0,0 +1,161 @@
+package bitflyergo
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const testExecutionsMessage = `{"jsonrpc":"2.0","method":"channelMessage","params":{"channel":"lightning_executions_FX_BTC_JPY",` +
+	`"message":[{"id":1,"side":"BUY","price":900000,"size":0.01,"exec_date":"2019-10-16T14:58:22.39Z",` +
+	`"buy_child_order_acceptance_id":"a","sell_child_order_acceptance_id":"b"}]}}`
+
+// streamCallback stores received executions and errors.
+type streamCallback struct {
+	NopCallback
+	executions []Execution
+	errors     []error
+}
+
+func (c *streamCallback) OnReceiveExecutions(channelName string, executions []Execution) {
+	c.executions = append(c.executions, executions...)
+}
+
+func (c *streamCallback) OnErrorOccur(channelName string, err error) {
+	c.errors = append(c.errors, err)
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	con, closeServer := newTestWebSocket(t, []string{testExecutionsMessage, "invalid"})
+	defer closeServer()
+	var b bytes.Buffer
+	recorder := NewStreamRecorderWriter(&b)
+	live := &streamCallback{}
+	ws := &WebSocketClient{Con: con, Cb: live, Recorder: recorder, Logger: NewStdLogger(nil)}
+	ws.Logger.(*StdLogger).Level = LevelError + 1
+	ws.Receive()
+	if err := recorder.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	replayed := &streamCallback{}
+	ws = &WebSocketClient{Cb: replayed, Logger: ws.Logger}
+	if err := Replay(context.Background(), &b, ws, ReplayMaxSpeed); err != nil {
+		t.Fatal(err)
+	}
+	if len(live.executions) != 1 || len(replayed.executions) != 1 {
+		t.Fatalf("executions: live=%v, replayed=%v", live.executions, replayed.executions)
+	}
+	if !replayed.executions[0].ReceivedTime.Equal(live.executions[0].ReceivedTime) {
+		t.Errorf("ReceivedTime: expected=%v, actual=%v",
+			live.executions[0].ReceivedTime, replayed.executions[0].ReceivedTime)
+	}
+	if replayed.executions[0].Delay() != live.executions[0].Delay() {
+		t.Errorf("Delay: expected=%v, actual=%v", live.executions[0].Delay(), replayed.executions[0].Delay())
+	}
+	// the invalid message and the read error after the server closed
+	if len(live.errors) != 2 {
+		t.Errorf("live errors: %v", live.errors)
+	}
+	if len(replayed.errors) != 1 {
+		t.Errorf("replayed errors: %v", replayed.errors)
+	}
+}
+
+func TestReplaySpeed(t *testing.T) {
+	var b bytes.Buffer
+	recorder := NewStreamRecorderWriter(&b)
+	at := time.Date(2019, 10, 16, 14, 58, 22, 0, time.UTC)
+	recorder.Record(at, []byte(testExecutionsMessage))
+	recorder.Record(at.Add(400*time.Millisecond), []byte(testExecutionsMessage))
+	recorder.Close()
+
+	cb := &streamCallback{}
+	started := time.Now()
+	if err := Replay(context.Background(), &b, &WebSocketClient{Cb: cb}, 4); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(started); elapsed < 100*time.Millisecond || elapsed > 350*time.Millisecond {
+		t.Errorf("elapsed: %v", elapsed)
+	}
+	if len(cb.executions) != 2 {
+		t.Errorf("executions: %v", cb.executions)
+	}
+}
+
+func TestReplayCancel(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bitflyergo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "stream.jsonl.gz")
+	recorder, err := NewStreamRecorder(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := time.Now()
+	recorder.Record(at, []byte(testExecutionsMessage))
+	recorder.Record(at.Add(time.Hour), []byte(testExecutionsMessage))
+	if err := recorder.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	cb := &streamCallback{}
+	if err := ReplayFile(ctx, path, &WebSocketClient{Cb: cb}, ReplayRealTime); err != context.DeadlineExceeded {
+		t.Errorf("expected=%v, actual=%v", context.DeadlineExceeded, err)
+	}
+	if len(cb.executions) != 1 {
+		t.Errorf("executions: %v", cb.executions)
+	}
+}
+
+// boardCallback stores received boards.
+type boardCallback struct {
+	authCallback
+	boards []*Board
+}
+
+func (c *boardCallback) OnReceiveBoard(channelName string, board *Board) {
+	c.boards = append(c.boards, board)
+}
+
+func TestReplayBoardAndResponse(t *testing.T) {
+	var b bytes.Buffer
+	recorder := NewStreamRecorderWriter(&b)
+	receivedAt := time.Date(2019, 10, 16, 14, 58, 22, 0, time.UTC)
+	recorder.Record(receivedAt, []byte(`{"jsonrpc":"2.0","method":"channelMessage","params":{"channel":"lightning_board_FX_BTC_JPY",`+
+		`"message":{"mid_price":900000,"bids":[{"price":899000,"size":0.1}],"asks":[]}}}`))
+	recorder.Record(receivedAt, []byte(`{"jsonrpc":"2.0","id":1,"result":true}`))
+	if err := recorder.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	cb := &boardCallback{authCallback: authCallback{results: make(chan error, 1)}}
+	ws := &WebSocketClient{Cb: cb, Logger: NewStdLogger(nil)}
+	ws.Logger.(*StdLogger).Level = LevelError + 1
+	ws.pending = map[int]*pendingCall{1: {id: 1, method: "auth", done: make(chan error, 1)}}
+	if err := Replay(context.Background(), &b, ws, ReplayMaxSpeed); err != nil {
+		t.Fatal(err)
+	}
+	if len(cb.boards) != 1 || !cb.boards[0].Time.Equal(receivedAt) {
+		t.Errorf("boards: %v", cb.boards)
+	}
+	select {
+	case err := <-cb.results:
+		t.Errorf("OnAuth is called by the recorded response: %v", err)
+	default:
+	}
+	if len(cb.errors) != 0 {
+		t.Errorf("errors: %v", cb.errors)
+	}
+	if ws.isReplaying() {
+		t.Error("still replaying")
+	}
+}
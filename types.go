@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"strconv"
 	"time"
 )
 
@@ -25,15 +26,43 @@ func (tt TimeWithSecond) MarshalJSON() ([]byte, error) {
 
 // Bitflyer is bitFlyer api client.
 type Bitflyer struct {
-	BaseUrl       string        // base url
-	ApiVersion    string        // api version
-	apiKey        string        // api key
-	apiSecret     string        // api secret
-	Debug         bool          // if true, debug mode
-	RetryLimit    int           // retry limit
-	RetryStatus   []int         // status to retry
-	RetryInterval time.Duration // retry interval
+	BaseUrl       string              // base url
+	ApiVersion    string              // api version
+	Credentials   CredentialsProvider // credentials to sign private api
+	Debug         bool                // if true, debug mode
+	RetryLimit    int                 // retry limit
+	RetryStatus   []int               // status to retry
+	RetryInterval time.Duration       // retry interval
+	UserAgent     string              // User-Agent header. not sent if blank
 	client        *http.Client
+
+	// Timeouts is the timeout of each path such as PathSendChildOrder, overriding the client timeout.
+	Timeouts map[string]time.Duration
+
+	// EnableWithdraw must be true to call Withdraw.
+	// It is false by default so that funds can't be withdrawn accidentally.
+	EnableWithdraw bool
+
+	// OrderGate refuses or delays child orders if it's not nil, e.g. HealthMonitor.
+	OrderGate OrderGate
+
+	// Clock is sampled by the responses and used to sign private API. Local time is used if nil.
+	Clock *Clock
+
+	// RateLimiter limits the rate of requests if it's not nil.
+	RateLimiter RateLimiter
+
+	// Logger is the logger of this instance. The default logger is used if nil.
+	Logger LeveledLogger
+
+	// Metrics receives the measurements of requests if it's not nil.
+	Metrics Metrics
+
+	// Middlewares wrap every request in order, the first one being the outermost.
+	Middlewares []Middleware
+
+	// Journal records every order action and its result if it's not nil, e.g. journal.Writer.
+	Journal Journal
 }
 
 // Execution is one of the execution history
@@ -45,7 +74,7 @@ type Execution struct {
 	Side                       string    `json:"side"`                           // side
 	BuyChildOrderAcceptanceId  string    `json:"buy_child_order_acceptance_id"`  // buy_child_order_acceptance_id
 	SellChildOrderAcceptanceId string    `json:"sell_child_order_acceptance_id"` // sell_child_order_acceptance_id
-	ReceivedTime               time.Time `json:receivedTime`                     // receivedTime
+	ReceivedTime               time.Time `json:"receivedTime"`                   // receivedTime
 }
 
 // Delay returns delayed time of execution.
@@ -61,6 +90,65 @@ type Board struct {
 	Asks     map[float64]float64 `json:"asks"`      // asks
 }
 
+// BestBid returns the highest bid price and its size. ok is false if there is no bid.
+func (b *Board) BestBid() (price float64, size float64, ok bool) {
+	for p, s := range b.Bids {
+		if !ok || p > price {
+			price, size, ok = p, s, true
+		}
+	}
+	return
+}
+
+// BestAsk returns the lowest ask price and its size. ok is false if there is no ask.
+func (b *Board) BestAsk() (price float64, size float64, ok bool) {
+	for p, s := range b.Asks {
+		if !ok || p < price {
+			price, size, ok = p, s, true
+		}
+	}
+	return
+}
+
+// Merge applies the difference of board received from 'lightning_board_' channel.
+//
+// The price whose size is 0 and the prices crossing mid price are removed from the board.
+func (b *Board) Merge(diff *Board) {
+	merge := func(dst map[float64]float64, src map[float64]float64) {
+		for p, s := range src {
+			if s == 0 {
+				delete(dst, p)
+			} else {
+				dst[p] = s
+			}
+		}
+	}
+	if b.Bids == nil {
+		b.Bids = map[float64]float64{}
+	}
+	if b.Asks == nil {
+		b.Asks = map[float64]float64{}
+	}
+	merge(b.Bids, diff.Bids)
+	merge(b.Asks, diff.Asks)
+	if diff.MidPrice > 0 {
+		b.MidPrice = diff.MidPrice
+
+		// remove the stale prices crossing mid price
+		for p := range b.Bids {
+			if p >= b.MidPrice {
+				delete(b.Bids, p)
+			}
+		}
+		for p := range b.Asks {
+			if p <= b.MidPrice {
+				delete(b.Asks, p)
+			}
+		}
+	}
+	b.Time = diff.Time
+}
+
 // Market is the return value of '/getmarkets' API.
 type Market struct {
 	ProductCode string `json:"product_code"` // product_code
@@ -98,9 +186,14 @@ func (tt *TickerTime) UnmarshalJSON(data []byte) error {
 
 // BoardState is board's state.
 type BoardState struct {
-	Health string             `json:"health"` // health
-	State  string             `json:"state"`  // state
-	Data   map[string]float64 `json:"data"`   // data
+	Health string         `json:"health"` // health
+	State  string         `json:"state"`  // state
+	Data   BoardStateData `json:"data"`   // data
+}
+
+// BoardStateData is the additional data of board state.
+type BoardStateData struct {
+	SpecialQuotation float64 `json:"special_quotation"` // special_quotation, only for futures
 }
 
 // Health is market health state.
@@ -110,17 +203,17 @@ type Health struct {
 
 // Collateral is the collateral of account.
 type Collateral struct {
-	Collateral        float64 `json:"collateral"`         // collateral
-	OpenPositionPnl   float64 `json:"open_position_pnl"`  // open_position_pnl
-	RequireCollateral float64 `json:"require_collateral"` // require_collateral
+	Collateral        Decimal `json:"collateral"`         // collateral
+	OpenPositionPnl   Decimal `json:"open_position_pnl"`  // open_position_pnl
+	RequireCollateral Decimal `json:"require_collateral"` // require_collateral
 	KeepRate          float64 `json:"keep_rate"`          // keep_rate
 }
 
 // Balance is the balance of account.
 type Balance struct {
-	CurrencyCode string `json:"currency_code"` // currency_code
-	Amount       int64  `json:"amount"`        // amount
-	Available    int64  `json:"available"`     // available
+	CurrencyCode string  `json:"currency_code"` // currency_code
+	Amount       Decimal `json:"amount"`        // amount
+	Available    Decimal `json:"available"`     // available
 }
 
 // ChildOrder is own child orders.
@@ -130,17 +223,17 @@ type ChildOrder struct {
 	ProductCode            string         `json:"product_code"`              // product_code
 	Side                   string         `json:"side"`                      // side
 	ChildOrderType         string         `json:"child_order_type"`          // child_order_type
-	Price                  float64        `json:"price"`                     // price
-	AveragePrice           float64        `json:"average_price"`             // average_price
-	Size                   float64        `json:"size"`                      // size
+	Price                  Decimal        `json:"price"`                     // price
+	AveragePrice           Decimal        `json:"average_price"`             // average_price
+	Size                   Decimal        `json:"size"`                      // size
 	ChildOrderState        string         `json:"child_order_state"`         // child_order_state
 	ExpireDate             TimeWithSecond `json:"expire_date"`               // expire_date
 	ChildOrderDate         TimeWithSecond `json:"child_order_date"`          // child_order_date
 	ChildOrderAcceptanceId string         `json:"child_order_acceptance_id"` // child_order_acceptance_id
-	OutstandingSize        float64        `json:"outstanding_size"`          // outstanding_size
-	CancelSize             float64        `json:"cancel_size"`               // cancel_size
-	ExecutedSize           float64        `json:"executed_size"`             // executed_size
-	TotalCommission        float64        `json:"total_commission"`          // total_commission
+	OutstandingSize        Decimal        `json:"outstanding_size"`          // outstanding_size
+	CancelSize             Decimal        `json:"cancel_size"`               // cancel_size
+	ExecutedSize           Decimal        `json:"executed_size"`             // executed_size
+	TotalCommission        Decimal        `json:"total_commission"`          // total_commission
 	Executions             []MyExecution
 }
 
@@ -148,15 +241,15 @@ type ChildOrder struct {
 type Position struct {
 	ProductCode         string         `json:"product_code"`          // product_code
 	Side                string         `json:"side"`                  // side
-	Price               float64        `json:"price"`                 // price
-	Size                float64        `json:"size"`                  // size
-	Commission          float64        `json:"commission"`            // commission
-	SwapPointAccumulate float64        `json:"swap_point_accumulate"` // swap_point_accumulate
-	RequireCollateral   float64        `json:"require_collateral"`    // require_collateral
+	Price               Decimal        `json:"price"`                 // price
+	Size                Decimal        `json:"size"`                  // size
+	Commission          Decimal        `json:"commission"`            // commission
+	SwapPointAccumulate Decimal        `json:"swap_point_accumulate"` // swap_point_accumulate
+	RequireCollateral   Decimal        `json:"require_collateral"`    // require_collateral
 	OpenDate            TimeWithSecond `json:"open_date"`             // open_date
 	Leverage            float64        `json:"leverage"`              // leverage
-	Pnl                 float64        `json:"pnl"`                   // pnl
-	Std                 float64        `json:"sfd"`                   // sfd
+	Pnl                 Decimal        `json:"pnl"`                   // pnl
+	Std                 Decimal        `json:"sfd"`                   // sfd
 }
 
 // ApiError is lightning api error.
@@ -177,9 +270,400 @@ type MyExecution struct {
 	Id                     int64      `json:"id"`                        // id
 	ChildOrderId           string     `json:"child_order_id"`            // child_order_id
 	Side                   string     `json:"side"`                      // side
-	Price                  float64    `json:"price"`                     // price
-	Size                   float64    `json:"size"`                      // size
-	Commission             float64    `json:"commission"`                // commission
+	Price                  Decimal    `json:"price"`                     // price
+	Size                   Decimal    `json:"size"`                      // size
+	Commission             Decimal    `json:"commission"`                // commission
 	ExecDate               TickerTime `json:"exec_date"`                 // exec_date
 	ChildOrderAcceptanceId string     `json:"child_order_acceptance_id"` // child_order_acceptance_id
 }
+
+// Pagination is the paging parameters of the apis which accept 'count', 'before' and 'after'.
+type Pagination struct {
+	Count  int   // count
+	Before int64 // before
+	After  int64 // after
+}
+
+// setParams sets non-zero paging parameters to params.
+func (p *Pagination) setParams(params map[string]string) {
+	if p == nil {
+		return
+	}
+	if p.Count > 0 {
+		params["count"] = strconv.Itoa(p.Count)
+	}
+	if p.Before > 0 {
+		params["before"] = strconv.FormatInt(p.Before, 10)
+	}
+	if p.After > 0 {
+		params["after"] = strconv.FormatInt(p.After, 10)
+	}
+}
+
+// BalanceHistory is the return value of '/me/getbalancehistory' API.
+type BalanceHistory struct {
+	Id           int64          `json:"id"`            // id
+	TradeDate    TimeWithSecond `json:"trade_date"`    // trade_date
+	EventDate    TimeWithSecond `json:"event_date"`    // event_date
+	ProductCode  string         `json:"product_code"`  // product_code
+	CurrencyCode string         `json:"currency_code"` // currency_code
+	TradeType    string         `json:"trade_type"`    // trade_type
+	Price        Decimal        `json:"price"`         // price
+	Amount       Decimal        `json:"amount"`        // amount
+	Quantity     Decimal        `json:"quantity"`      // quantity
+	Commission   Decimal        `json:"commission"`    // commission
+	Balance      Decimal        `json:"balance"`       // balance
+	OrderId      string         `json:"order_id"`      // order_id
+}
+
+// CollateralHistory is the return value of '/me/getcollateralhistory' API.
+type CollateralHistory struct {
+	Id           int64          `json:"id"`            // id
+	CurrencyCode string         `json:"currency_code"` // currency_code
+	Change       Decimal        `json:"change"`        // change
+	Amount       Decimal        `json:"amount"`        // amount
+	ReasonCode   string         `json:"reason_code"`   // reason_code
+	Date         TimeWithSecond `json:"date"`          // date
+}
+
+// CollateralAccount is the collateral of each currency.
+type CollateralAccount struct {
+	CurrencyCode string  `json:"currency_code"` // currency_code
+	Amount       Decimal `json:"amount"`        // amount
+}
+
+// TradingCommission is the return value of '/me/gettradingcommission' API.
+type TradingCommission struct {
+	CommissionRate float64 `json:"commission_rate"` // commission_rate
+}
+
+// ParentOrderParameter is one of the orders composing parent order.
+type ParentOrderParameter struct {
+	ProductCode   string  `json:"product_code"`   // product_code
+	ConditionType string  `json:"condition_type"` // condition_type
+	Side          string  `json:"side"`           // side
+	Size          Decimal `json:"size"`           // size
+	Price         Decimal `json:"price"`          // price
+	TriggerPrice  Decimal `json:"trigger_price"`  // trigger_price
+	Offset        Decimal `json:"offset"`         // offset
+}
+
+// MarshalJSON marshals parameter without price, trigger_price and offset of zero.
+func (p ParentOrderParameter) MarshalJSON() ([]byte, error) {
+	m := map[string]interface{}{
+		"product_code":   p.ProductCode,
+		"condition_type": p.ConditionType,
+		"side":           p.Side,
+		"size":           p.Size,
+	}
+	if !p.Price.IsZero() {
+		m["price"] = p.Price
+	}
+	if !p.TriggerPrice.IsZero() {
+		m["trigger_price"] = p.TriggerPrice
+	}
+	if !p.Offset.IsZero() {
+		m["offset"] = p.Offset
+	}
+	return json.Marshal(m)
+}
+
+// ParentOrderRequest is the request of '/me/sendparentorder' API.
+type ParentOrderRequest struct {
+	OrderMethod    string                 `json:"order_method"`               // order_method
+	MinuteToExpire int                    `json:"minute_to_expire,omitempty"` // minute_to_expire
+	TimeInForce    string                 `json:"time_in_force,omitempty"`    // time_in_force
+	Parameters     []ParentOrderParameter `json:"parameters"`                 // parameters
+}
+
+// ParentOrder is own parent order.
+type ParentOrder struct {
+	Id                      int64          `json:"id"`                         // id
+	ParentOrderId           string         `json:"parent_order_id"`            // parent_order_id
+	ProductCode             string         `json:"product_code"`               // product_code
+	Side                    string         `json:"side"`                       // side
+	ParentOrderType         string         `json:"parent_order_type"`          // parent_order_type
+	Price                   Decimal        `json:"price"`                      // price
+	AveragePrice            Decimal        `json:"average_price"`              // average_price
+	Size                    Decimal        `json:"size"`                       // size
+	ParentOrderState        string         `json:"parent_order_state"`         // parent_order_state
+	ExpireDate              TimeWithSecond `json:"expire_date"`                // expire_date
+	ParentOrderDate         TimeWithSecond `json:"parent_order_date"`          // parent_order_date
+	ParentOrderAcceptanceId string         `json:"parent_order_acceptance_id"` // parent_order_acceptance_id
+	OutstandingSize         Decimal        `json:"outstanding_size"`           // outstanding_size
+	CancelSize              Decimal        `json:"cancel_size"`                // cancel_size
+	ExecutedSize            Decimal        `json:"executed_size"`              // executed_size
+	TotalCommission         Decimal        `json:"total_commission"`           // total_commission
+}
+
+// ParentOrderDetail is the return value of '/me/getparentorder' API.
+type ParentOrderDetail struct {
+	Id                      int64                  `json:"id"`                         // id
+	ParentOrderId           string                 `json:"parent_order_id"`            // parent_order_id
+	OrderMethod             string                 `json:"order_method"`               // order_method
+	ExpireDate              TimeWithSecond         `json:"expire_date"`                // expire_date
+	TimeInForce             string                 `json:"time_in_force"`              // time_in_force
+	Parameters              []ParentOrderParameter `json:"parameters"`                 // parameters
+	ParentOrderAcceptanceId string                 `json:"parent_order_acceptance_id"` // parent_order_acceptance_id
+}
+
+// Address is the return value of '/me/getaddresses' API.
+type Address struct {
+	Type         string `json:"type"`          // type
+	CurrencyCode string `json:"currency_code"` // currency_code
+	Address      string `json:"address"`       // address
+}
+
+// CoinIn is the return value of '/me/getcoinins' API.
+type CoinIn struct {
+	Id           int64          `json:"id"`            // id
+	OrderId      string         `json:"order_id"`      // order_id
+	CurrencyCode string         `json:"currency_code"` // currency_code
+	Amount       Decimal        `json:"amount"`        // amount
+	Address      string         `json:"address"`       // address
+	TxHash       string         `json:"tx_hash"`       // tx_hash
+	Status       string         `json:"status"`        // status
+	EventDate    TimeWithSecond `json:"event_date"`    // event_date
+}
+
+// CoinOut is the return value of '/me/getcoinouts' API.
+type CoinOut struct {
+	Id            int64          `json:"id"`             // id
+	OrderId       string         `json:"order_id"`       // order_id
+	CurrencyCode  string         `json:"currency_code"`  // currency_code
+	Amount        Decimal        `json:"amount"`         // amount
+	Address       string         `json:"address"`        // address
+	TxHash        string         `json:"tx_hash"`        // tx_hash
+	Fee           Decimal        `json:"fee"`            // fee
+	AdditionalFee Decimal        `json:"additional_fee"` // additional_fee
+	Status        string         `json:"status"`         // status
+	EventDate     TimeWithSecond `json:"event_date"`     // event_date
+}
+
+// BankAccount is the return value of '/me/getbankaccounts' API.
+type BankAccount struct {
+	Id            int64  `json:"id"`             // id
+	IsVerified    bool   `json:"is_verified"`    // is_verified
+	BankName      string `json:"bank_name"`      // bank_name
+	BranchName    string `json:"branch_name"`    // branch_name
+	AccountType   string `json:"account_type"`   // account_type
+	AccountNumber string `json:"account_number"` // account_number
+	AccountName   string `json:"account_name"`   // account_name
+}
+
+// Deposit is the return value of '/me/getdeposits' API.
+type Deposit struct {
+	Id           int64          `json:"id"`            // id
+	OrderId      string         `json:"order_id"`      // order_id
+	CurrencyCode string         `json:"currency_code"` // currency_code
+	Amount       Decimal        `json:"amount"`        // amount
+	Status       string         `json:"status"`        // status
+	EventDate    TimeWithSecond `json:"event_date"`    // event_date
+}
+
+// Withdrawal is the return value of '/me/getwithdrawals' API.
+type Withdrawal struct {
+	Id           int64          `json:"id"`            // id
+	OrderId      string         `json:"order_id"`      // order_id
+	CurrencyCode string         `json:"currency_code"` // currency_code
+	Amount       Decimal        `json:"amount"`        // amount
+	Status       string         `json:"status"`        // status
+	EventDate    TimeWithSecond `json:"event_date"`    // event_date
+}
+
+// WithdrawRequest is the request of '/me/withdraw' API.
+type WithdrawRequest struct {
+	CurrencyCode  string  `json:"currency_code"`   // currency_code
+	BankAccountId int64   `json:"bank_account_id"` // bank_account_id
+	Amount        Decimal `json:"amount"`          // amount
+	Code          string  `json:"code,omitempty"`  // two-factor authentication code
+}
+
+// FundingRate is the return value of '/getfundingrate' API.
+type FundingRate struct {
+	CurrentFundingRate        float64        `json:"current_funding_rate"`         // current_funding_rate
+	NextFundingRateSettleDate TimeWithSecond `json:"next_funding_rate_settledate"` // next_funding_rate_settledate
+}
+
+// CorporateLeverage is the return value of '/getcorporateleverage' API.
+//
+// NextMax and NextStartDate are nil if the change of leverage isn't scheduled.
+type CorporateLeverage struct {
+	CurrentMax       float64         `json:"current_max"`       // current_max
+	CurrentStartDate TimeWithSecond  `json:"current_startdate"` // current_startdate
+	NextMax          *float64        `json:"next_max"`          // next_max
+	NextStartDate    *TimeWithSecond `json:"next_startdate"`    // next_startdate
+}
+
+// Chat is the return value of '/getchats' API.
+type Chat struct {
+	Nickname string         `json:"nickname"` // nickname
+	Message  string         `json:"message"`  // message
+	Date     TimeWithSecond `json:"date"`     // date
+}
+
+// ChildOrderRequest is the request of '/me/sendchildorder' API.
+type ChildOrderRequest struct {
+	ProductCode    string  // product_code
+	ChildOrderType string  // child_order_type, ChildOrderTypeLimit or ChildOrderTypeMarket
+	Side           string  // side, SideBuy or SideSell
+	Price          Decimal // price, required for limit order
+	Size           Decimal // size
+	MinuteToExpire int     // minute_to_expire, 0 means the default of the exchange
+	TimeInForce    string  // time_in_force, blank means TimeInForceGtc
+
+	// Extra is the other parameters sent as they are, e.g. the ones added to the api later.
+	// It's only sent when set explicitly by the caller, and doesn't override the fields above.
+	Extra map[string]string
+}
+
+// Validate checks the request before sending it to the exchange.
+func (r *ChildOrderRequest) Validate() error {
+	if r.ProductCode == "" {
+		return fmt.Errorf("product_code is required")
+	}
+	switch r.ChildOrderType {
+	case ChildOrderTypeLimit:
+		if r.Price.Sign() <= 0 {
+			return fmt.Errorf("price must be positive for limit order. [%v]", r.Price)
+		}
+	case ChildOrderTypeMarket:
+		if !r.Price.IsZero() {
+			return fmt.Errorf("price can not be specified for market order. [%v]", r.Price)
+		}
+	default:
+		return fmt.Errorf("invalid child_order_type. [%v]", r.ChildOrderType)
+	}
+	if r.Side != SideBuy && r.Side != SideSell {
+		return fmt.Errorf("invalid side. [%v]", r.Side)
+	}
+	if r.Size.LessThan(NewDecimalFromFloat(MinimumOrderbleSize)) {
+		return fmt.Errorf("Sizes less than %v can not be ordered. [%v]", MinimumOrderbleSize, r.Size)
+	}
+	if r.MinuteToExpire < 0 || r.MinuteToExpire > MaxMinuteToExpire {
+		return fmt.Errorf("minute_to_expire must be between 0 and %v. [%v]", MaxMinuteToExpire, r.MinuteToExpire)
+	}
+	switch r.TimeInForce {
+	case "", TimeInForceGtc, TimeInForceIoc, TimeInForceFok:
+	default:
+		return fmt.Errorf("invalid time_in_force. [%v]", r.TimeInForce)
+	}
+	return nil
+}
+
+// MarshalJSON marshals request to the body of '/me/sendchildorder' API.
+func (r ChildOrderRequest) MarshalJSON() ([]byte, error) {
+	m := map[string]interface{}{
+		"product_code":     r.ProductCode,
+		"child_order_type": r.ChildOrderType,
+		"side":             r.Side,
+		"size":             r.Size,
+	}
+	if r.ChildOrderType == ChildOrderTypeLimit {
+		m["price"] = r.Price
+	}
+	if r.MinuteToExpire > 0 {
+		m["minute_to_expire"] = r.MinuteToExpire
+	}
+	if r.TimeInForce != "" {
+		m["time_in_force"] = r.TimeInForce
+	}
+	for k, v := range r.Extra {
+		if _, ok := m[k]; !ok && !childOrderKeys[k] {
+			m[k] = v
+		}
+	}
+	return json.Marshal(m)
+}
+
+// childOrderKeys is the parameters of '/me/sendchildorder' API held by the fields of ChildOrderRequest.
+var childOrderKeys = map[string]bool{
+	"product_code":     true,
+	"child_order_type": true,
+	"side":             true,
+	"price":            true,
+	"size":             true,
+	"minute_to_expire": true,
+	"time_in_force":    true,
+}
+
+// newChildOrderRequest creates ChildOrderRequest from the optional parameters of SendChildOrder.
+// Unknown parameters are rejected so that typos aren't sent silently.
+func newChildOrderRequest(productCode string, childOrderType string,
+	side string, size float64, params map[string]string) (*ChildOrderRequest, error) {
+
+	req := &ChildOrderRequest{
+		ProductCode:    productCode,
+		ChildOrderType: childOrderType,
+		Side:           side,
+		Size:           NewDecimalFromFloat(size),
+	}
+	for k, v := range params {
+		var err error
+		switch k {
+		case "price":
+			req.Price, err = ParseDecimal(v)
+		case "minute_to_expire":
+			req.MinuteToExpire, err = strconv.Atoi(v)
+		case "time_in_force":
+			req.TimeInForce = v
+		default:
+			return nil, fmt.Errorf("unknown parameter of child order. [%v]", k)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid parameter '%v'. [%v] %v", k, v, err)
+		}
+	}
+	return req, nil
+}
+
+// ChildOrderFilter is the condition of '/me/getchildorders' API.
+type ChildOrderFilter struct {
+	ProductCode            string // product_code
+	ChildOrderState        string // child_order_state
+	ChildOrderId           string // child_order_id
+	ChildOrderAcceptanceId string // child_order_acceptance_id
+	ParentOrderId          string // parent_order_id
+	Pagination
+}
+
+// params returns the query parameters of the filter.
+func (f *ChildOrderFilter) params() map[string]string {
+	params := map[string]string{"product_code": f.ProductCode}
+	setIfNotBlank(params, "child_order_state", f.ChildOrderState)
+	setIfNotBlank(params, "child_order_id", f.ChildOrderId)
+	setIfNotBlank(params, "child_order_acceptance_id", f.ChildOrderAcceptanceId)
+	setIfNotBlank(params, "parent_order_id", f.ParentOrderId)
+	f.Pagination.setParams(params)
+	return params
+}
+
+// MyExecutionFilter is the condition of '/me/getexecutions' API.
+type MyExecutionFilter struct {
+	ProductCode            string // product_code
+	ChildOrderId           string // child_order_id
+	ChildOrderAcceptanceId string // child_order_acceptance_id
+	Pagination
+}
+
+// params returns the query parameters of the filter.
+func (f *MyExecutionFilter) params() map[string]string {
+	params := map[string]string{"product_code": f.ProductCode}
+	setIfNotBlank(params, "child_order_id", f.ChildOrderId)
+	setIfNotBlank(params, "child_order_acceptance_id", f.ChildOrderAcceptanceId)
+	f.Pagination.setParams(params)
+	return params
+}
+
+func setIfNotBlank(params map[string]string, key string, value string) {
+	if value != "" {
+		params[key] = value
+	}
+}
+
+// OrderAck is the acknowledgement of the child order accepted by the exchange.
+type OrderAck struct {
+	ChildOrderAcceptanceId string        `json:"child_order_acceptance_id"` // child_order_acceptance_id
+	SentAt                 time.Time     `json:"sent_at"`                   // time when the final attempt was sent
+	Latency                time.Duration `json:"latency"`                   // round-trip time of the final attempt
+}